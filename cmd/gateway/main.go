@@ -5,9 +5,11 @@ import (
 	"errors"
 	"flag"
 	"os"
+	"sync"
 
 	adapterconfig "api-gateway/internal/adapter/config"
 	domainconfig "api-gateway/internal/domain/config"
+	"api-gateway/internal/router"
 	"api-gateway/internal/server"
 
 	"github.com/rs/zerolog"
@@ -26,13 +28,33 @@ func main() {
 		logger.Fatal().Err(err).Msg("failed to load config")
 	}
 
-	reloadCh := make(chan struct{}, 1)
-	loader.Watch(func(_ *domainconfig.Config) {
+	reloadCh := make(chan *domainconfig.Config, 1)
+	var deliverMu sync.Mutex
+	deliver := func(cfg *domainconfig.Config) {
+		// Only the latest config matters; replace one still pending. The lock
+		// keeps the watcher and the admin API from blocking each other.
+		deliverMu.Lock()
+		defer deliverMu.Unlock()
 		select {
-		case reloadCh <- struct{}{}:
+		case <-reloadCh:
 		default:
 		}
-	})
+		reloadCh <- cfg
+	}
+	loader.Watch(deliver)
+	reload := func() error {
+		cfg, err := loader.ReloadConfig()
+		if err != nil {
+			return err
+		}
+		deliver(cfg)
+		return nil
+	}
+
+	// Router state outlives each server so reloads keep rate limit counters
+	// and switches flipped through the admin API.
+	state := router.NewState()
+	defer state.Close()
 
 	for {
 		cfg := loader.Get()
@@ -40,7 +62,7 @@ func main() {
 			logger.Fatal().Msg("configuration is not available")
 		}
 
-		srv := server.New(cfg, logger)
+		srv := server.New(cfg, logger, state, server.Admin{Reload: reload, Routes: loader})
 		err = srv.Start(reloadCh)
 		if errors.Is(err, server.ErrReloadRequested) {
 			logger.Info().Msg("configuration reloaded")
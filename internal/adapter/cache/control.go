@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directives holds the parsed Cache-Control directives the gateway acts on.
+// Durations are negative when the directive is absent.
+type Directives struct {
+	NoStore              bool
+	NoCache              bool
+	Private              bool
+	Public               bool
+	MustRevalidate       bool
+	MaxAge               time.Duration
+	SMaxAge              time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+func ParseCacheControl(value string) Directives {
+	d := Directives{
+		MaxAge:               -1,
+		SMaxAge:              -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			d.NoStore = true
+		case "no-cache":
+			d.NoCache = true
+		case "private":
+			d.Private = true
+		case "public":
+			d.Public = true
+		case "must-revalidate", "proxy-revalidate":
+			d.MustRevalidate = true
+		case "max-age":
+			d.MaxAge = parseSeconds(arg)
+		case "s-maxage":
+			d.SMaxAge = parseSeconds(arg)
+		case "stale-while-revalidate":
+			d.StaleWhileRevalidate = parseSeconds(arg)
+		case "stale-if-error":
+			d.StaleIfError = parseSeconds(arg)
+		}
+	}
+
+	return d
+}
+
+// Freshness returns how long a response stays fresh in a shared cache and
+// whether the response said anything about it.
+func Freshness(header http.Header, now time.Time) (time.Duration, bool) {
+	d := ParseCacheControl(header.Get("Cache-Control"))
+	if d.SMaxAge >= 0 {
+		return d.SMaxAge, true
+	}
+	if d.MaxAge >= 0 {
+		return d.MaxAge, true
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0, true
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		if ttl := t.Sub(now); ttl > 0 {
+			return ttl, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func parseSeconds(value string) time.Duration {
+	seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	d := ParseCacheControl("public, max-age=60, s-maxage=120, stale-if-error=300")
+	assert.True(t, d.Public)
+	assert.Equal(t, time.Minute, d.MaxAge)
+	assert.Equal(t, 2*time.Minute, d.SMaxAge)
+	assert.Equal(t, 5*time.Minute, d.StaleIfError)
+	assert.Equal(t, time.Duration(-1), d.StaleWhileRevalidate)
+
+	d = ParseCacheControl("no-store, private")
+	assert.True(t, d.NoStore)
+	assert.True(t, d.Private)
+	assert.Equal(t, time.Duration(-1), d.MaxAge)
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	_, ok := Freshness(header, now)
+	assert.False(t, ok)
+
+	header.Set("Expires", now.Add(time.Hour).Format(http.TimeFormat))
+	fresh, ok := Freshness(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, fresh)
+
+	header.Set("Cache-Control", "max-age=30")
+	fresh, _ = Freshness(header, now)
+	assert.Equal(t, 30*time.Second, fresh)
+
+	header.Set("Cache-Control", "max-age=30, s-maxage=10")
+	fresh, _ = Freshness(header, now)
+	assert.Equal(t, 10*time.Second, fresh)
+
+	header = http.Header{}
+	header.Set("Expires", "0")
+	fresh, ok = Freshness(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), fresh)
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/domain/cache"
+)
+
+func TestMemoryStore_GetSet(t *testing.T) {
+	store := NewMemoryStore(1024)
+	ctx := context.Background()
+
+	_, ok := store.Get(ctx, "/a")
+	assert.False(t, ok)
+
+	store.Set(ctx, "/a", &cache.Entry{StatusCode: 200, Body: []byte("hello")})
+	entry, ok := store.Get(ctx, "/a")
+	assert.True(t, ok)
+	assert.Equal(t, "hello", string(entry.Body))
+
+	store.Delete(ctx, "/a")
+	_, ok = store.Get(ctx, "/a")
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), store.Bytes())
+}
+
+func TestMemoryStore_EvictsByBytes(t *testing.T) {
+	store := NewMemoryStore(100)
+	ctx := context.Background()
+
+	store.Set(ctx, "/a", &cache.Entry{Body: make([]byte, 40)})
+	store.Set(ctx, "/b", &cache.Entry{Body: make([]byte, 40)})
+	store.Get(ctx, "/a")
+	store.Set(ctx, "/c", &cache.Entry{Body: make([]byte, 40)})
+
+	_, ok := store.Get(ctx, "/b")
+	assert.False(t, ok)
+	_, ok = store.Get(ctx, "/a")
+	assert.True(t, ok)
+	assert.LessOrEqual(t, store.Bytes(), int64(100))
+
+	store.Set(ctx, "/huge", &cache.Entry{Body: make([]byte, 200)})
+	_, ok = store.Get(ctx, "/huge")
+	assert.False(t, ok)
+}
+
+func TestMemoryStore_Purge(t *testing.T) {
+	store := NewMemoryStore(0)
+	ctx := context.Background()
+
+	store.Set(ctx, "/api/users/1", &cache.Entry{})
+	store.Set(ctx, "/api/users/2", &cache.Entry{})
+	store.Set(ctx, "/api/orders/1", &cache.Entry{})
+
+	assert.Equal(t, 2, store.Purge(ctx, "/api/users"))
+	assert.Equal(t, 1, store.Len())
+	assert.Equal(t, 1, store.Purge(ctx, ""))
+	assert.Equal(t, 0, store.Len())
+}
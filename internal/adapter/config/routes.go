@@ -0,0 +1,303 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/domain/config"
+)
+
+// Route returns the current route with the given ID.
+func (v *ViperLoader) Route(id string) (config.Route, error) {
+	cfg := v.Get()
+	i, err := findRoute(cfg.Routes, id)
+	if err != nil {
+		return config.Route{}, err
+	}
+	return cfg.Routes[i], nil
+}
+
+// CreateRoute adds a route given in config file form, as JSON, after the
+// existing ones.
+func (v *ViperLoader) CreateRoute(body []byte, actor string) (config.Route, error) {
+	route, err := decodeRoute(body)
+	if err != nil {
+		return config.Route{}, err
+	}
+
+	err = v.changeRoutes(config.RouteChange{Actor: actor, Action: config.RouteCreated, Route: route.ID(), After: config.Redact(route)},
+		func(routes []config.Route) ([]config.Route, error) {
+			if _, err := findRoute(routes, route.ID()); err == nil {
+				return nil, domain.ErrConflict
+			}
+			return append(routes, route), nil
+		})
+	return route, err
+}
+
+// UpdateRoute replaces the route with the given ID as long as its ETag still
+// matches etag. The route keeps its position, which decides its precedence.
+func (v *ViperLoader) UpdateRoute(id, etag string, body []byte, actor string) (config.Route, error) {
+	route, err := decodeRoute(body)
+	if err != nil {
+		return config.Route{}, err
+	}
+
+	change := config.RouteChange{Actor: actor, Action: config.RouteUpdated, Route: id, After: config.Redact(route)}
+	err = v.changeRoutes(change, func(routes []config.Route) ([]config.Route, error) {
+		i, err := findRoute(routes, id)
+		if err != nil {
+			return nil, err
+		}
+		if routes[i].ETag() != etag {
+			return nil, domain.ErrVersionMismatch
+		}
+		if _, err := findRoute(routes, route.ID()); err == nil && route.ID() != id {
+			return nil, domain.ErrConflict
+		}
+		routes[i] = route
+		return routes, nil
+	})
+	return route, err
+}
+
+// DeleteRoute removes the route with the given ID as long as its ETag still
+// matches etag.
+func (v *ViperLoader) DeleteRoute(id, etag, actor string) error {
+	return v.changeRoutes(config.RouteChange{Actor: actor, Action: config.RouteDeleted, Route: id},
+		func(routes []config.Route) ([]config.Route, error) {
+			i, err := findRoute(routes, id)
+			if err != nil {
+				return nil, err
+			}
+			if routes[i].ETag() != etag {
+				return nil, domain.ErrVersionMismatch
+			}
+			return slices.Delete(routes, i, i+1), nil
+		})
+}
+
+// RouteChanges returns up to limit audit log entries, newest first.
+func (v *ViperLoader) RouteChanges(limit int) ([]config.RouteChange, error) {
+	store := v.Get().RouteStore
+	if store == nil {
+		return nil, errRouteStoreDisabled
+	}
+
+	file, err := os.Open(store.AuditPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return []config.RouteChange{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	changes := []config.RouteChange{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var change config.RouteChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			continue
+		}
+		changes = append(changes, change)
+		if limit > 0 && len(changes) > limit {
+			changes = changes[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	slices.Reverse(changes)
+	return changes, nil
+}
+
+var errRouteStoreDisabled = errors.New("route store is not configured")
+
+// changeRoutes applies edit to the current routes, validates the result
+// like a config file, persists it and hands the new config to the watch
+// callback, which applies it like a file change.
+func (v *ViperLoader) changeRoutes(change config.RouteChange, edit func([]config.Route) ([]config.Route, error)) error {
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+
+	cfg := v.Get()
+	if cfg.RouteStore == nil {
+		return errRouteStoreDisabled
+	}
+
+	routes, err := edit(slices.Clone(cfg.Routes))
+	if err != nil {
+		return err
+	}
+	next := *cfg
+	next.Routes = routes
+	if err := next.Validate(); err != nil {
+		return domain.ErrConfigInvalid.With(err)
+	}
+
+	if change.Action != config.RouteCreated {
+		if i, err := findRoute(cfg.Routes, change.Route); err == nil {
+			change.Before = config.Redact(cfg.Routes[i])
+		}
+	}
+
+	// The audit entry goes first, so no change is applied unrecorded; a
+	// failed store write leaves an entry for a version that never existed.
+	stored := config.StoredRoutes{Version: v.routesVersion + 1, Routes: routes}
+	change.Time = time.Now().UTC()
+	change.Version = stored.Version
+	if err := appendRouteChange(cfg.RouteStore.AuditPath(), change); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	if err := writeStoredRoutes(cfg.RouteStore.Path, stored); err != nil {
+		return err
+	}
+	v.routesVersion = stored.Version
+
+	v.mu.Lock()
+	v.cfg = &next
+	onChange := v.onChange
+	v.mu.Unlock()
+
+	if onChange != nil {
+		onChange(&next)
+	}
+	return nil
+}
+
+// applyStoredRoutes replaces the routes read from the config file with
+// those of the route store, once it has any.
+func (v *ViperLoader) applyStoredRoutes(cfg *config.Config) error {
+	if cfg.RouteStore == nil || cfg.RouteStore.Path == "" {
+		return nil
+	}
+
+	stored, err := readStoredRoutes(cfg.RouteStore.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		v.routesVersion = 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	v.routesVersion = stored.Version
+	if stored.Version > 0 {
+		cfg.Routes = stored.Routes
+	}
+	return nil
+}
+
+func findRoute(routes []config.Route, id string) (int, error) {
+	for i, route := range routes {
+		if route.ID() == id {
+			return i, nil
+		}
+	}
+	return -1, domain.ErrNotFound
+}
+
+// decodeRoute decodes a JSON route with the same key handling and type
+// conversions as the config file.
+func decodeRoute(body []byte) (config.Route, error) {
+	var route config.Route
+	vp := viper.New()
+	vp.SetConfigType("json")
+	if err := vp.ReadConfig(bytes.NewReader(body)); err != nil {
+		return route, domain.ErrConfigInvalid.With(fmt.Errorf("route is not a JSON object: %w", err))
+	}
+	if err := vp.Unmarshal(&route); err != nil {
+		return route, domain.ErrConfigInvalid.With(fmt.Errorf("failed to decode route: %w", err))
+	}
+	// Routes are read back with secrets redacted; storing such a route would
+	// replace the secrets with the placeholder.
+	if data, _ := json.Marshal(config.AsMap(route)); bytes.Contains(data, []byte(config.RedactedValue)) {
+		return route, domain.ErrConfigInvalid.With(fmt.Errorf("route contains %s values; send secrets in full", config.RedactedValue))
+	}
+	return route, nil
+}
+
+func readStoredRoutes(path string) (config.StoredRoutes, error) {
+	var stored config.StoredRoutes
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return stored, err
+	}
+
+	vp := viper.New()
+	vp.SetConfigType("json")
+	if err := vp.ReadConfig(bytes.NewReader(data)); err != nil {
+		return stored, fmt.Errorf("failed to read route store: %w", err)
+	}
+	if err := vp.Unmarshal(&stored); err != nil {
+		return stored, fmt.Errorf("failed to unmarshal route store: %w", err)
+	}
+	return stored, nil
+}
+
+// writeStoredRoutes replaces the store through a rename, so a crash leaves
+// either the old or the new routes.
+func writeStoredRoutes(path string, stored config.StoredRoutes) error {
+	data, err := json.MarshalIndent(config.AsMap(stored), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode route store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write route store: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write route store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write route store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write route store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write route store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write route store: %w", err)
+	}
+	return nil
+}
+
+func appendRouteChange(path string, change config.RouteChange) error {
+	line, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/domain/config"
+)
+
+func loadTestConfig(t *testing.T, dir string) *ViperLoader {
+	t.Helper()
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+route_store:
+  path: `+filepath.Join(dir, "routes.json")+`
+routes:
+  - path: "/api/users/*"
+    upstream: "http://users:8080"
+`), 0o644))
+
+	loader := NewViperLoader()
+	_, err := loader.Load(context.Background(), path)
+	assert.NoError(t, err)
+	return loader
+}
+
+func TestRouteChanges(t *testing.T) {
+	dir := t.TempDir()
+	loader := loadTestConfig(t, dir)
+
+	var applied []*config.Config
+	loader.Watch(func(cfg *config.Config) { applied = append(applied, cfg) })
+
+	created, err := loader.CreateRoute([]byte(`{"path":"/api/orders/*","upstream":"http://orders:8080","timeout_ms":"3000"}`), "ann")
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, created.TimeoutMs)
+	assert.Len(t, applied, 1)
+	assert.Len(t, loader.Get().Routes, 2)
+
+	_, err = loader.CreateRoute([]byte(`{"path":"/api/orders/*","upstream":"http://other"}`), "ann")
+	assert.ErrorIs(t, err, domain.ErrConflict)
+
+	// Validation is the one applied to config files.
+	_, err = loader.CreateRoute([]byte(`{"path":"/r","redirect":{"to":"/x","status":200}}`), "ann")
+	assert.ErrorIs(t, err, domain.ErrConfigInvalid)
+	_, err = loader.CreateRoute([]byte(`not json`), "ann")
+	assert.ErrorIs(t, err, domain.ErrConfigInvalid)
+
+	route, err := loader.Route("GET /api/users/*")
+	assert.NoError(t, err)
+	_, err = loader.UpdateRoute("GET /api/users/*", "stale", []byte(`{"path":"/api/users/*","upstream":"http://users-v2"}`), "bob")
+	assert.ErrorIs(t, err, domain.ErrVersionMismatch)
+	updated, err := loader.UpdateRoute("GET /api/users/*", route.ETag(), []byte(`{"path":"/api/users/*","upstream":"http://users-v2"}`), "bob")
+	assert.NoError(t, err)
+	assert.NotEqual(t, route.ETag(), updated.ETag())
+	assert.Equal(t, "http://users-v2", loader.Get().Routes[0].Upstream)
+
+	assert.ErrorIs(t, loader.DeleteRoute("GET /missing", "x", "bob"), domain.ErrNotFound)
+	assert.NoError(t, loader.DeleteRoute("GET /api/orders/*", created.ETag(), "bob"))
+	assert.Len(t, applied, 3)
+
+	changes, err := loader.RouteChanges(10)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, config.RouteDeleted, changes[0].Action)
+	assert.Equal(t, int64(3), changes[0].Version)
+	assert.Equal(t, "bob", changes[1].Actor)
+	assert.Equal(t, "http://users:8080", changes[1].Before["upstream"])
+	assert.Equal(t, "http://users-v2", changes[1].After["upstream"])
+	assert.Equal(t, config.RouteCreated, changes[2].Action)
+
+	// Stored routes replace those of the config file after a restart.
+	restarted := loadTestConfig(t, dir)
+	assert.Len(t, restarted.Get().Routes, 1)
+	assert.Equal(t, "http://users-v2", restarted.Get().Routes[0].Upstream)
+	_, err = restarted.CreateRoute([]byte(`{"path":"/b","upstream":"http://b"}`), "ann")
+	assert.NoError(t, err)
+	changes, err = restarted.RouteChanges(1)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, int64(4), changes[0].Version)
+}
+
+func TestRouteChanges_NoStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("routes:\n  - path: /a\n    upstream: http://a\n"), 0o644))
+
+	loader := NewViperLoader()
+	_, err := loader.Load(context.Background(), path)
+	assert.NoError(t, err)
+
+	_, err = loader.CreateRoute([]byte(`{"path":"/b","upstream":"http://b"}`), "ann")
+	assert.Error(t, err)
+	assert.Len(t, loader.Get().Routes, 1)
+}
+
+func TestRouteChanges_MethodsOnOnePath(t *testing.T) {
+	loader := loadTestConfig(t, t.TempDir())
+
+	post, err := loader.CreateRoute([]byte(`{"path":"/api/users/*","methods":["POST"],"upstream":"http://writer"}`), "ann")
+	assert.NoError(t, err)
+	assert.Equal(t, "POST /api/users/*", post.ID())
+	assert.Len(t, loader.Get().Routes, 2)
+
+	get, err := loader.Route("GET /api/users/*")
+	assert.NoError(t, err)
+	_, err = loader.UpdateRoute("POST /api/users/*", post.ETag(), []byte(`{"path":"/api/users/*","methods":["POST"],"upstream":"http://writer-v2"}`), "ann")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://users:8080", loader.Get().Routes[0].Upstream)
+	assert.Equal(t, "http://writer-v2", loader.Get().Routes[1].Upstream)
+
+	assert.NoError(t, loader.DeleteRoute("GET /api/users/*", get.ETag(), "ann"))
+	assert.Len(t, loader.Get().Routes, 1)
+	_, err = loader.Route("POST /api/users/*")
+	assert.NoError(t, err)
+}
+
+func TestRouteChanges_RejectsRedactedSecrets(t *testing.T) {
+	loader := loadTestConfig(t, t.TempDir())
+
+	created, err := loader.CreateRoute([]byte(`{"path":"/b","upstream":"http://b","headers":{"Authorization":"Bearer s3cret"}}`), "ann")
+	assert.NoError(t, err)
+
+	redacted := config.Redact(created)
+	assert.Equal(t, config.RedactedValue, redacted["headers"].(map[string]interface{})["authorization"])
+	body, err := json.Marshal(redacted)
+	assert.NoError(t, err)
+	_, err = loader.UpdateRoute(created.ID(), created.ETag(), body, "ann")
+	assert.ErrorIs(t, err, domain.ErrConfigInvalid)
+
+	route, err := loader.Route(created.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer s3cret", route.Headers["authorization"])
+}
+
+func TestRouteChanges_AuditFailureRejectsChange(t *testing.T) {
+	dir := t.TempDir()
+	loader := loadTestConfig(t, dir)
+	// A directory where the audit log should be cannot be appended to.
+	assert.NoError(t, os.Mkdir(loader.Get().RouteStore.AuditPath(), 0o755))
+
+	_, err := loader.CreateRoute([]byte(`{"path":"/b","upstream":"http://b"}`), "ann")
+	assert.Error(t, err)
+	assert.Len(t, loader.Get().Routes, 1)
+	_, err = os.Stat(filepath.Join(dir, "routes.json"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestRouteChanges_KeepsCaseOfCookiePaths(t *testing.T) {
+	loader := loadTestConfig(t, t.TempDir())
+
+	created, err := loader.CreateRoute([]byte(`{"path":"/b","upstream":"http://b","cookies":{
+		"paths":[{"from":"/Api","to":"/b/Api"}]}}`), "ann")
+	assert.NoError(t, err)
+	assert.Equal(t, []config.FieldRename{{From: "/Api", To: "/b/Api"}}, created.Cookies.Paths)
+}
+
+func TestRouteChanges_KeepsCaseOfQueryNames(t *testing.T) {
+	loader := loadTestConfig(t, t.TempDir())
+
+	created, err := loader.CreateRoute([]byte(`{"path":"/b","upstream":"http://b","rewrite":{"query":{
+		"rename":[{"from":"userId","to":"user_id"}],
+		"add":[{"name":"apiKey","value":"k3y"}]}}}`), "ann")
+	assert.NoError(t, err)
+
+	query := created.Rewrite.Query
+	assert.Equal(t, []config.FieldRename{{From: "userId", To: "user_id"}}, query.Rename)
+	assert.Equal(t, []config.QueryParam{{Name: "apiKey", Value: "k3y"}}, query.Add)
+}
@@ -16,6 +16,12 @@ type ViperLoader struct {
 	cfg     *config.Config
 	watcher *fsnotify.Watcher
 	path    string
+	// reloadMu serializes reloads and route changes from the watcher and
+	// the admin API, which share viper's global state.
+	reloadMu sync.Mutex
+	onChange func(*config.Config)
+	// routesVersion is the version of the route store last read or written.
+	routesVersion int64
 }
 
 func NewViperLoader() *ViperLoader {
@@ -51,6 +57,14 @@ func (v *ViperLoader) Load(ctx context.Context, path string) (*config.Config, er
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := v.applyStoredRoutes(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	v.mu.Lock()
 	v.cfg = cfg
 	v.mu.Unlock()
@@ -78,7 +92,13 @@ func (v *ViperLoader) setupWatcher() error {
 	return nil
 }
 
+// Watch calls callback with every config accepted after Load, from file
+// changes and from route changes made through the admin API.
 func (v *ViperLoader) Watch(callback func(*config.Config)) {
+	v.mu.Lock()
+	v.onChange = callback
+	v.mu.Unlock()
+
 	if v.watcher == nil {
 		return
 	}
@@ -113,20 +133,40 @@ func (v *ViperLoader) Get() *config.Config {
 }
 
 func (v *ViperLoader) Reload() *config.Config {
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Printf("failed to reload config: %v\n", err)
+	cfg, err := v.ReloadConfig()
+	if err != nil {
+		fmt.Printf("%v, keeping the previous config\n", err)
 		return nil
 	}
+	return cfg
+}
+
+// ReloadConfig re-reads the config file. An invalid config is rejected with
+// the reasons and the previous one stays current.
+func (v *ViperLoader) ReloadConfig() (*config.Config, error) {
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to reload config: %w", err)
+	}
 
 	cfg := &config.Config{}
 	if err := viper.Unmarshal(cfg); err != nil {
-		fmt.Printf("failed to unmarshal config: %v\n", err)
-		return nil
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	if err := v.applyStoredRoutes(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
 	v.mu.Lock()
 	v.cfg = cfg
 	v.mu.Unlock()
 
-	return cfg
+	return cfg, nil
 }
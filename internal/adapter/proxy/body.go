@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// BodyRules describe a JSON body transform, applied in the order unwrap,
+// remove, rename, add, wrap. Fields are dot-separated paths such as
+// "user.name" or "items.0.id"; the JSONPath forms "$.user.name" and
+// "items[0].id" are accepted too, and "*" matches every member of an object
+// or array. String values of Add are text/template strings rendered against
+// TemplateData; other values are inserted as they are.
+type BodyRules struct {
+	Unwrap string
+	Remove []string
+	Rename map[string]string
+	Add    map[string]interface{}
+	Wrap   string
+}
+
+type BodyTransform struct {
+	unwrap []string
+	remove [][]string
+	rename [][2][]string
+	add    []bodyValue
+	wrap   []string
+}
+
+type bodyValue struct {
+	path  []string
+	value interface{}
+	tmpl  *template.Template
+}
+
+func NewBodyTransform(rules BodyRules) (*BodyTransform, error) {
+	t := &BodyTransform{
+		unwrap: fieldPath(rules.Unwrap),
+		wrap:   fieldPath(rules.Wrap),
+	}
+
+	for _, field := range rules.Remove {
+		path := fieldPath(field)
+		if path == nil {
+			return nil, fmt.Errorf("remove: empty field")
+		}
+		t.remove = append(t.remove, path)
+	}
+
+	for _, from := range sortedKeys(rules.Rename) {
+		fromPath, toPath := fieldPath(from), fieldPath(rules.Rename[from])
+		if fromPath == nil || toPath == nil {
+			return nil, fmt.Errorf("rename %q: empty field", from)
+		}
+		t.rename = append(t.rename, [2][]string{fromPath, toPath})
+	}
+
+	for _, field := range sortedKeys(rules.Add) {
+		value := bodyValue{path: fieldPath(field), value: rules.Add[field]}
+		if value.path == nil {
+			return nil, fmt.Errorf("add: empty field")
+		}
+		if text, ok := value.value.(string); ok && strings.Contains(text, "{{") {
+			tmpl, err := compileTemplate(field, text)
+			if err != nil {
+				return nil, fmt.Errorf("add %s: %w", field, err)
+			}
+			value.tmpl = tmpl
+		}
+		t.add = append(t.add, value)
+	}
+
+	return t, nil
+}
+
+// Apply returns the transformed body. Bodies that are not valid JSON are
+// returned unchanged.
+func (t *BodyTransform) Apply(body []byte, data *TemplateData) []byte {
+	if t == nil || len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return body
+	}
+
+	if t.unwrap != nil {
+		if inner, ok := lookupField(doc, t.unwrap); ok {
+			doc = inner
+		}
+	}
+
+	for _, path := range t.remove {
+		last := path[len(path)-1]
+		doc = eachField(doc, path[:len(path)-1], func(parent interface{}) interface{} {
+			return deleteKey(parent, last)
+		})
+	}
+
+	for _, rename := range t.rename {
+		from, to := rename[0], rename[1]
+		shared := sharedPrefix(from, to)
+		doc = eachField(doc, from[:shared], func(node interface{}) interface{} {
+			value, ok := lookupField(node, from[shared:])
+			if !ok {
+				return node
+			}
+			node = eachField(node, from[shared:len(from)-1], func(parent interface{}) interface{} {
+				return deleteKey(parent, from[len(from)-1])
+			})
+			return setField(node, to[shared:], value)
+		})
+	}
+
+	for _, add := range t.add {
+		value, ok := add.render(data)
+		if !ok {
+			continue
+		}
+		wildcard := lastWildcard(add.path)
+		doc = eachField(doc, add.path[:wildcard+1], func(node interface{}) interface{} {
+			return setField(node, add.path[wildcard+1:], value)
+		})
+	}
+
+	if t.wrap != nil {
+		doc = setField(nil, t.wrap, doc)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func (v bodyValue) render(data *TemplateData) (interface{}, bool) {
+	if v.tmpl == nil {
+		return v.value, true
+	}
+
+	var buf bytes.Buffer
+	if err := v.tmpl.Execute(&buf, data); err != nil {
+		return nil, false
+	}
+	return buf.String(), true
+}
+
+// transformBody applies t to an uncompressed JSON body and drops the now
+// stale Content-Length, which is recomputed when the body is sent.
+func transformBody(t *BodyTransform, header http.Header, body []byte, data *TemplateData) []byte {
+	if t == nil || !isJSON(header.Get("Content-Type")) {
+		return body
+	}
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return body
+	}
+
+	header.Del("Content-Length")
+	return t.Apply(body, data)
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func fieldPath(field string) []string {
+	field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+	field = strings.NewReplacer("[", ".", "]", "").Replace(field)
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ".")
+}
+
+// eachField calls fn on every node reached by path, fanning out on "*", and
+// stores what fn returns in its place.
+func eachField(node interface{}, path []string, fn func(interface{}) interface{}) interface{} {
+	if len(path) == 0 {
+		return fn(node)
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			for key, child := range n {
+				n[key] = eachField(child, path[1:], fn)
+			}
+		} else if child, ok := n[path[0]]; ok {
+			n[path[0]] = eachField(child, path[1:], fn)
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			for i, child := range n {
+				n[i] = eachField(child, path[1:], fn)
+			}
+		} else if i, ok := arrayIndex(n, path[0]); ok {
+			n[i] = eachField(n[i], path[1:], fn)
+		}
+	}
+	return node
+}
+
+func lookupField(node interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[key]
+			if !ok {
+				return nil, false
+			}
+			node = child
+		case []interface{}:
+			i, ok := arrayIndex(n, key)
+			if !ok {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// setField stores value at path, creating missing objects on the way. Paths
+// through scalars or past the end of an array are left alone.
+func setField(node interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		n[path[0]] = setField(n[path[0]], path[1:], value)
+		return n
+	case []interface{}:
+		if i, ok := arrayIndex(n, path[0]); ok {
+			n[i] = setField(n[i], path[1:], value)
+		}
+		return n
+	case nil:
+		return map[string]interface{}{path[0]: setField(nil, path[1:], value)}
+	}
+	return node
+}
+
+func deleteKey(node interface{}, key string) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		delete(n, key)
+	case []interface{}:
+		if i, ok := arrayIndex(n, key); ok {
+			return append(n[:i:i], n[i+1:]...)
+		}
+	}
+	return node
+}
+
+func arrayIndex(array []interface{}, key string) (int, bool) {
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || i >= len(array) {
+		return 0, false
+	}
+	return i, true
+}
+
+// sharedPrefix is how many leading segments two field paths share, leaving
+// at least the last segment of each.
+func sharedPrefix(a, b []string) int {
+	n := 0
+	for n < len(a)-1 && n < len(b)-1 && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func lastWildcard(path []string) int {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == "*" {
+			return i
+		}
+	}
+	return -1
+}
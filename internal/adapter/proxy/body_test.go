@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyTransform_Apply(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules BodyRules
+		body  string
+		want  string
+	}{
+		{
+			name:  "remove rename and add",
+			rules: BodyRules{Remove: []string{"internal"}, Rename: map[string]string{"userName": "user_name"}, Add: map[string]interface{}{"source": "gateway", "version": 2}},
+			body:  `{"userName":"ann","internal":true,"age":30}`,
+			want:  `{"age":30,"source":"gateway","user_name":"ann","version":2}`,
+		},
+		{
+			name:  "nested paths and jsonpath syntax",
+			rules: BodyRules{Remove: []string{"$.user.password"}, Rename: map[string]string{"user.mail": "contact.email"}},
+			body:  `{"user":{"name":"ann","mail":"a@example.com","password":"x"}}`,
+			want:  `{"contact":{"email":"a@example.com"},"user":{"name":"ann"}}`,
+		},
+		{
+			name:  "wildcards and indexes",
+			rules: BodyRules{Remove: []string{"items.*.secret", "items[1]"}, Rename: map[string]string{"items.*.Id": "items.*.id"}},
+			body:  `{"items":[{"Id":1,"secret":"a"},{"Id":2,"secret":"b"},{"Id":3}]}`,
+			want:  `{"items":[{"id":1},{"id":3}]}`,
+		},
+		{
+			name:  "unwrap envelope",
+			rules: BodyRules{Unwrap: "data"},
+			body:  `{"data":{"id":1},"meta":{}}`,
+			want:  `{"id":1}`,
+		},
+		{
+			name:  "wrap envelope",
+			rules: BodyRules{Wrap: "payload.item"},
+			body:  `[1,2]`,
+			want:  `{"payload":{"item":[1,2]}}`,
+		},
+		{
+			name:  "large numbers and html kept",
+			rules: BodyRules{Add: map[string]interface{}{"x": "a<b"}},
+			body:  `{"id":12345678901234567890}`,
+			want:  `{"id":12345678901234567890,"x":"a<b"}`,
+		},
+		{
+			name:  "invalid json untouched",
+			rules: BodyRules{Remove: []string{"a"}},
+			body:  `not json`,
+			want:  `not json`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := NewBodyTransform(tt.rules)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(transform.Apply([]byte(tt.body), &TemplateData{})))
+		})
+	}
+}
+
+func TestBodyTransform_Templates(t *testing.T) {
+	transform, err := NewBodyTransform(BodyRules{
+		Add: map[string]interface{}{"owner.id": "{{.Claims.sub}}", "account": "{{.Params.id}}"},
+	})
+	assert.NoError(t, err)
+
+	out := transform.Apply([]byte(`{"name":"x"}`), &TemplateData{
+		Params: map[string]string{"id": "42"},
+		Claims: map[string]string{"sub": "user-1"},
+	})
+	assert.JSONEq(t, `{"name":"x","account":"42","owner":{"id":"user-1"}}`, string(out))
+
+	_, err = NewBodyTransform(BodyRules{Add: map[string]interface{}{"a": "{{.Nope}}"}})
+	assert.Error(t, err)
+	_, err = NewBodyTransform(BodyRules{Remove: []string{"$"}})
+	assert.Error(t, err)
+}
+
+func TestIsJSON(t *testing.T) {
+	assert.True(t, isJSON("application/json"))
+	assert.True(t, isJSON("application/json; charset=utf-8"))
+	assert.True(t, isJSON("application/problem+json"))
+	assert.False(t, isJSON("text/plain"))
+	assert.False(t, isJSON(""))
+}
+
+func TestForward_BodyRules(t *testing.T) {
+	var gotBody string
+	var gotLength int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody, gotLength = string(body), r.ContentLength
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "38")
+		_, _ = w.Write([]byte(`{"result":{"user_name":"ann","id":7}}` + "\n"))
+	}))
+	defer upstream.Close()
+
+	request, err := NewBodyTransform(BodyRules{
+		Rename: map[string]string{"userName": "user_name"},
+		Add:    map[string]interface{}{"created_by": "{{.UserID}}"},
+	})
+	assert.NoError(t, err)
+	response, err := NewBodyTransform(BodyRules{
+		Unwrap: "result",
+		Rename: map[string]string{"user_name": "userName"},
+	})
+	assert.NoError(t, err)
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("user_id", "u-1")
+		return c.Next()
+	})
+	app.Post("/users", client.Forward(RouteConfig{
+		Upstream:     upstream.URL,
+		RequestBody:  request,
+		ResponseBody: response,
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"userName":"ann"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, `{"user_name":"ann","created_by":"u-1"}`, gotBody)
+	assert.Equal(t, int64(len(gotBody)), gotLength)
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"userName":"ann","id":7}`, string(body))
+	assert.Equal(t, strconv.Itoa(len(body)), resp.Header.Get("Content-Length"))
+}
+
+func TestForward_BodyRulesSkipNonJSON(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(`{"result":1}`))
+	}))
+	defer upstream.Close()
+
+	response, err := NewBodyTransform(BodyRules{Unwrap: "result"})
+	assert.NoError(t, err)
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app := fiber.New()
+	app.Get("/", client.Forward(RouteConfig{Upstream: upstream.URL, ResponseBody: response}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"result":1}`, string(body))
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"api-gateway/internal/domain/proxy"
+)
+
+// maxDifferences bounds how many differences are reported per response pair.
+const maxDifferences = 20
+
+// defaultIgnoredHeaders differ between any two responses or follow from a
+// body difference that is reported on its own.
+var defaultIgnoredHeaders = []string{"Date", "Content-Length", "X-Request-ID"}
+
+// Comparison reports structural differences between a primary and a shadow
+// response: status, end-to-end headers and, for JSON, the decoded body.
+// Ignored fields use the body rule path syntax, e.g. "meta.*.trace_id".
+type Comparison struct {
+	ignoreHeaders map[string]bool
+	ignoreFields  [][]string
+}
+
+func NewComparison(ignoreHeaders, ignoreFields []string) *Comparison {
+	c := &Comparison{ignoreHeaders: make(map[string]bool)}
+	for _, name := range append(append(append([]string{}, defaultIgnoredHeaders...), hopByHopHeaders...), ignoreHeaders...) {
+		c.ignoreHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, field := range ignoreFields {
+		c.ignoreFields = append(c.ignoreFields, fieldPath(field))
+	}
+	return c
+}
+
+// Compare lists the differences, each prefixed with its kind: "status",
+// "header" or "body".
+func (c *Comparison) Compare(primary, shadow *proxy.Response) []string {
+	if c == nil {
+		c = NewComparison(nil, nil)
+	}
+
+	var differences []string
+	if primary.StatusCode != shadow.StatusCode {
+		differences = append(differences, fmt.Sprintf("status %d != %d", primary.StatusCode, shadow.StatusCode))
+	}
+	differences = append(differences, c.compareHeaders(primary.Header, shadow.Header)...)
+	differences = append(differences, c.compareBodies(primary, shadow)...)
+
+	if len(differences) > maxDifferences {
+		differences = differences[:maxDifferences]
+	}
+	return differences
+}
+
+func (c *Comparison) compareHeaders(primary, shadow http.Header) []string {
+	names := make(map[string]struct{})
+	for name := range primary {
+		names[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+	for name := range shadow {
+		names[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+
+	var differences []string
+	for _, name := range sortedKeys(names) {
+		if c.ignoreHeaders[name] {
+			continue
+		}
+		a, b := primary.Values(name), shadow.Values(name)
+		if !reflect.DeepEqual(a, b) {
+			differences = append(differences, fmt.Sprintf("header %s %q != %q", name, strings.Join(a, ", "), strings.Join(b, ", ")))
+		}
+	}
+	return differences
+}
+
+func (c *Comparison) compareBodies(primary, shadow *proxy.Response) []string {
+	if isJSON(primary.Header.Get("Content-Type")) && isJSON(shadow.Header.Get("Content-Type")) &&
+		primary.Header.Get("Content-Encoding") == "" && shadow.Header.Get("Content-Encoding") == "" {
+		a, errA := decodeJSON(primary.Body)
+		b, errB := decodeJSON(shadow.Body)
+		if errA == nil && errB == nil {
+			var differences []string
+			c.compareValues(nil, a, b, &differences)
+			return differences
+		}
+	}
+
+	if !bytes.Equal(primary.Body, shadow.Body) {
+		return []string{fmt.Sprintf("body %d bytes != %d bytes", len(primary.Body), len(shadow.Body))}
+	}
+	return nil
+}
+
+func (c *Comparison) compareValues(path []string, a, b interface{}, differences *[]string) {
+	if c.ignored(path) || len(*differences) >= maxDifferences {
+		return
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]struct{}, len(av)+len(bv))
+		for key := range av {
+			keys[key] = struct{}{}
+		}
+		for key := range bv {
+			keys[key] = struct{}{}
+		}
+		for _, key := range sortedKeys(keys) {
+			field := append(path[:len(path):len(path)], key)
+			childA, inA := av[key]
+			childB, inB := bv[key]
+			switch {
+			case !inB:
+				c.report(field, "missing in shadow", differences)
+			case !inA:
+				c.report(field, "only in shadow", differences)
+			default:
+				c.compareValues(field, childA, childB, differences)
+			}
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if len(av) != len(bv) {
+			c.report(path, fmt.Sprintf("length %d != %d", len(av), len(bv)), differences)
+		}
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			c.compareValues(append(path[:len(path):len(path)], fmt.Sprint(i)), av[i], bv[i], differences)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) && !sameNumber(a, b) {
+		c.report(path, fmt.Sprintf("%s != %s", jsonText(a), jsonText(b)), differences)
+	}
+}
+
+// sameNumber treats numbers written differently, such as 1 and 1.0, as equal.
+func sameNumber(a, b interface{}) bool {
+	na, okA := a.(json.Number)
+	nb, okB := b.(json.Number)
+	if !okA || !okB {
+		return false
+	}
+	fa, errA := na.Float64()
+	fb, errB := nb.Float64()
+	return errA == nil && errB == nil && fa == fb
+}
+
+func (c *Comparison) report(path []string, detail string, differences *[]string) {
+	if c.ignored(path) {
+		return
+	}
+	*differences = append(*differences, fmt.Sprintf("body $%s %s", jsonPath(path), detail))
+}
+
+// ignored reports whether path is covered by an ignored field; "*" matches
+// any single key or index.
+func (c *Comparison) ignored(path []string) bool {
+	for _, pattern := range c.ignoreFields {
+		if len(pattern) == 0 || len(pattern) > len(path) {
+			continue
+		}
+		matched := true
+		for i, segment := range pattern {
+			if segment != "*" && segment != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeJSON(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func jsonPath(path []string) string {
+	var b strings.Builder
+	for _, segment := range path {
+		b.WriteString(".")
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+func jsonText(v interface{}) string {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(text)
+}
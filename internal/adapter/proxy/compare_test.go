@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/domain/proxy"
+)
+
+func jsonResponse(status int, body string) *proxy.Response {
+	return &proxy.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       []byte(body),
+	}
+}
+
+func TestComparison_Compare(t *testing.T) {
+	tests := []struct {
+		name          string
+		ignoreHeaders []string
+		ignoreFields  []string
+		primary       *proxy.Response
+		shadow        *proxy.Response
+		want          []string
+	}{
+		{
+			name:    "formatting and key order ignored",
+			primary: jsonResponse(200, `{"a":1,"b":[1,2]}`),
+			shadow:  jsonResponse(200, "{\n  \"b\": [1, 2],\n  \"a\": 1.0\n}"),
+		},
+		{
+			name:    "status and structure",
+			primary: jsonResponse(200, `{"user":{"name":"ann","tags":["x"]},"old":true}`),
+			shadow:  jsonResponse(404, `{"user":{"name":"bob","tags":["x","y"]},"new":1}`),
+			want: []string{
+				"status 200 != 404",
+				"body $.new only in shadow",
+				"body $.old missing in shadow",
+				`body $.user.name "ann" != "bob"`,
+				"body $.user.tags length 1 != 2",
+			},
+		},
+		{
+			name:         "ignored fields",
+			ignoreFields: []string{"meta", "items[*].etag"},
+			primary:      jsonResponse(200, `{"meta":{"at":1},"items":[{"id":1,"etag":"a"}]}`),
+			shadow:       jsonResponse(200, `{"meta":{"at":2},"items":[{"id":1,"etag":"b"}]}`),
+		},
+		{
+			name:          "headers",
+			ignoreHeaders: []string{"x-version"},
+			primary: &proxy.Response{StatusCode: 200, Header: http.Header{
+				"Cache-Control": []string{"max-age=60"}, "Date": []string{"Mon"}, "X-Version": []string{"1"},
+			}},
+			shadow: &proxy.Response{StatusCode: 200, Header: http.Header{
+				"Cache-Control": []string{"no-store"}, "Date": []string{"Tue"}, "X-Version": []string{"2"},
+			}},
+			want: []string{`header Cache-Control "max-age=60" != "no-store"`},
+		},
+		{
+			name:    "non-JSON bodies compared as bytes",
+			primary: &proxy.Response{StatusCode: 200, Header: http.Header{}, Body: []byte("abc")},
+			shadow:  &proxy.Response{StatusCode: 200, Header: http.Header{}, Body: []byte("abcd")},
+			want:    []string{"body 3 bytes != 4 bytes"},
+		},
+		{
+			name:    "type change",
+			primary: jsonResponse(200, `{"id":1}`),
+			shadow:  jsonResponse(200, `{"id":"1"}`),
+			want:    []string{`body $.id 1 != "1"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewComparison(tt.ignoreHeaders, tt.ignoreFields).Compare(tt.primary, tt.shadow)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestComparison_BoundsDifferences(t *testing.T) {
+	primary := jsonResponse(200, `[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0]`)
+	shadow := jsonResponse(200, `[1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1]`)
+
+	assert.Len(t, (*Comparison)(nil).Compare(primary, shadow), maxDifferences)
+}
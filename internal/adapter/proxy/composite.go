@@ -0,0 +1,385 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// CompositeFailedHeader lists the calls of a composite response that failed,
+// whether or not a fallback stood in for them.
+const CompositeFailedHeader = "X-Composite-Failed"
+
+// CompositeCall is one upstream call of a composite route. URL is a
+// text/template rendered against TemplateData plus .Calls, the decoded JSON
+// responses of the calls listed in DependsOn, e.g.
+// "http://orders/users/{{.Calls.user.id}}/orders". Values are escaped as a
+// path segment, or as a query component after the "?"; {{raw .X}} inserts
+// one unescaped.
+type CompositeCall struct {
+	Name   string
+	Method string
+	URL    string
+	// Timeout bounds the call on its own; the route timeout still applies.
+	Timeout time.Duration
+	// DependsOn names earlier calls that must finish first.
+	DependsOn []string
+	// Required fails the whole request when the call fails and has no
+	// Fallback.
+	Required bool
+	// Fallback is JSON used in place of the response of a failed call.
+	Fallback string
+}
+
+type CompositeOptions struct {
+	Calls []CompositeCall
+	// Merge maps a source, "<call>" or "<call>.<field>", to a field of the
+	// response document. Without it the document has one member per call.
+	Merge []CompositeField
+	// ForwardHeaders are copied from the client request to every call.
+	ForwardHeaders []string
+}
+
+type CompositeField struct {
+	From string
+	To   string
+}
+
+// Composite fans a request out to several upstreams, running calls in
+// parallel as their dependencies allow, and merges the JSON responses into
+// one document.
+type Composite struct {
+	calls   []compositeCall
+	merge   []compositeField
+	forward []string
+}
+
+type compositeCall struct {
+	CompositeCall
+	url      *template.Template
+	deps     []int
+	fallback []byte
+}
+
+type compositeField struct {
+	call int
+	from []string
+	to   []string
+}
+
+// compositeData is what call URL templates render against.
+type compositeData struct {
+	*TemplateData
+	Calls map[string]interface{}
+}
+
+type callResult struct {
+	value  interface{}
+	ok     bool
+	failed bool
+	err    error
+}
+
+var errDependencyFailed = errors.New("dependency failed")
+
+func NewComposite(opts CompositeOptions) (*Composite, error) {
+	if len(opts.Calls) == 0 {
+		return nil, errors.New("composite needs at least one call")
+	}
+
+	comp := &Composite{forward: opts.ForwardHeaders}
+	index := make(map[string]int, len(opts.Calls))
+	for i, call := range opts.Calls {
+		if call.Name == "" {
+			return nil, fmt.Errorf("call %d: missing name", i)
+		}
+		if _, dup := index[call.Name]; dup {
+			return nil, fmt.Errorf("call %q: duplicate name", call.Name)
+		}
+		if call.Method == "" {
+			call.Method = http.MethodGet
+		}
+
+		tmpl, err := template.New(call.Name).Option("missingkey=zero").Funcs(urlFuncs).Parse(call.URL)
+		if err != nil {
+			return nil, fmt.Errorf("call %q: url: %w", call.Name, err)
+		}
+		inQuery := false
+		escapeActions(tmpl.Tree, tmpl.Tree.Root, &inQuery)
+
+		compiled := compositeCall{CompositeCall: call, url: tmpl}
+		for _, dep := range call.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("call %q: depends on %q, which is not an earlier call", call.Name, dep)
+			}
+			compiled.deps = append(compiled.deps, j)
+		}
+		if call.Fallback != "" {
+			if !json.Valid([]byte(call.Fallback)) {
+				return nil, fmt.Errorf("call %q: fallback is not valid JSON", call.Name)
+			}
+			compiled.fallback = []byte(call.Fallback)
+		}
+
+		index[call.Name] = i
+		comp.calls = append(comp.calls, compiled)
+	}
+
+	for _, field := range opts.Merge {
+		from := fieldPath(field.From)
+		if len(from) == 0 {
+			return nil, fmt.Errorf("merge %q: empty source", field.From)
+		}
+		i, ok := index[from[0]]
+		if !ok {
+			return nil, fmt.Errorf("merge %q: unknown call %q", field.From, from[0])
+		}
+		comp.merge = append(comp.merge, compositeField{call: i, from: from[1:], to: fieldPath(field.To)})
+	}
+
+	return comp, nil
+}
+
+// Compose serves a composite route. A required call that fails without a
+// fallback turns the response into a 502; other failures leave their part
+// of the document out and are listed in CompositeFailedHeader.
+func (c *HTTPClient) Compose(comp *Composite) fiber.Handler {
+	return func(ctx fiber.Ctx) error {
+		data := templateData(ctx)
+
+		header := make(http.Header)
+		for _, name := range comp.forward {
+			if value := ctx.Get(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+		if data.RequestID != "" {
+			header.Set("X-Request-ID", data.RequestID)
+		}
+
+		reqCtx := context.Context(ctx.Context())
+		if timeout, _ := ctx.Locals("request_timeout").(time.Duration); timeout > 0 {
+			var cancel context.CancelFunc
+			reqCtx, cancel = context.WithTimeout(reqCtx, timeout)
+			defer cancel()
+		}
+
+		results := comp.run(reqCtx, c, data, header)
+
+		var failed []string
+		for i, call := range comp.calls {
+			result := results[i]
+			if result.failed {
+				failed = append(failed, call.Name)
+			}
+			if call.Required && !result.ok {
+				ctx.Locals("upstream_error", result.err)
+				return ctx.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+					"error":   fmt.Sprintf("composite call %q failed", call.Name),
+					"details": errorMessage(result.err),
+				})
+			}
+		}
+
+		if len(failed) > 0 {
+			ctx.Set(CompositeFailedHeader, strings.Join(failed, ","))
+		}
+		return ctx.JSON(comp.document(results))
+	}
+}
+
+func (comp *Composite) run(ctx context.Context, c *HTTPClient, data *TemplateData, header http.Header) []callResult {
+	results := make([]callResult, len(comp.calls))
+	done := make([]chan struct{}, len(comp.calls))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	for i := range comp.calls {
+		go func() {
+			defer close(done[i])
+
+			call := &comp.calls[i]
+			calls := make(map[string]interface{}, len(call.deps))
+			for _, j := range call.deps {
+				<-done[j]
+				if !results[j].ok {
+					results[i] = call.fail(fmt.Errorf("%w: %s", errDependencyFailed, comp.calls[j].Name))
+					return
+				}
+				calls[comp.calls[j].Name] = results[j].value
+			}
+
+			value, err := call.do(ctx, c, &compositeData{TemplateData: data, Calls: calls}, header)
+			if err != nil {
+				results[i] = call.fail(err)
+				return
+			}
+			results[i] = callResult{value: value, ok: true}
+		}()
+	}
+
+	for i := range done {
+		<-done[i]
+	}
+	return results
+}
+
+// urlFuncs escape the values of call URL templates; escapeActions appends
+// them to every action.
+var urlFuncs = template.FuncMap{
+	"pathescape":  urlEscaper(url.PathEscape),
+	"queryescape": urlEscaper(url.QueryEscape),
+	"raw":         urlEscaper(func(s string) string { return s }),
+}
+
+func urlEscaper(escape func(string) string) func(interface{}) string {
+	return func(v interface{}) string {
+		if v == nil {
+			return ""
+		}
+		return escape(fmt.Sprint(v))
+	}
+}
+
+// escapeActions makes every action in list escape what it prints, as a path
+// segment until a "?" has been seen and as a query component after it.
+// Actions that already end in one of urlFuncs or urlquery are left alone.
+func escapeActions(tree *parse.Tree, list *parse.ListNode, inQuery *bool) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if bytes.ContainsRune(n.Text, '?') {
+				*inQuery = true
+			}
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 || escaped(n.Pipe) {
+				continue
+			}
+			name := "pathescape"
+			if *inQuery {
+				name = "queryescape"
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(name).SetTree(tree).SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			escapeActions(tree, n.List, inQuery)
+			escapeActions(tree, n.ElseList, inQuery)
+		case *parse.RangeNode:
+			escapeActions(tree, n.List, inQuery)
+			escapeActions(tree, n.ElseList, inQuery)
+		case *parse.WithNode:
+			escapeActions(tree, n.List, inQuery)
+			escapeActions(tree, n.ElseList, inQuery)
+		}
+	}
+}
+
+func escaped(pipe *parse.PipeNode) bool {
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	ident, ok := last.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return false
+	}
+	_, known := urlFuncs[ident.Ident]
+	return known || ident.Ident == "urlquery"
+}
+
+func (call *compositeCall) do(ctx context.Context, c *HTTPClient, data *compositeData, header http.Header) (interface{}, error) {
+	var target bytes.Buffer
+	if err := call.url.Execute(&target, data); err != nil {
+		return nil, fmt.Errorf("render url: %w", err)
+	}
+
+	if call.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, call.Timeout)
+		defer cancel()
+	}
+
+	req := NewRequest(call.Method, target.String(), nil)
+	req.Header = cloneHeaders(header)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("upstream returned %d", resp.StatusCode)
+	}
+
+	value, err := decodeJSON(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %w", err)
+	}
+	return value, nil
+}
+
+func (call *compositeCall) fail(err error) callResult {
+	if call.fallback == nil {
+		return callResult{failed: true, err: err}
+	}
+	value, _ := decodeJSON(call.fallback)
+	return callResult{value: value, ok: true, failed: true, err: err}
+}
+
+func (comp *Composite) document(results []callResult) interface{} {
+	if len(comp.merge) == 0 {
+		doc := make(map[string]interface{}, len(comp.calls))
+		for i, call := range comp.calls {
+			if results[i].ok {
+				doc[call.Name] = results[i].value
+			}
+		}
+		return doc
+	}
+
+	var doc interface{} = map[string]interface{}{}
+	for _, field := range comp.merge {
+		if !results[field.call].ok {
+			continue
+		}
+		if value, ok := lookupField(results[field.call].value, field.from); ok {
+			doc = setField(doc, field.to, copyJSON(value))
+		}
+	}
+	return doc
+}
+
+// copyJSON deep-copies a decoded JSON value so a response merged into
+// several fields is not shared between them.
+func copyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			out[key] = copyJSON(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = copyJSON(child)
+		}
+		return out
+	}
+	return value
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCompositeUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"` + r.PathValue("id") + `","name":"ann","account":"a-1"}`))
+	})
+	mux.HandleFunc("/accounts/{id}/orders", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"items":[{"account":"` + r.PathValue("id") + `","lang":"` + r.Header.Get("Accept-Language") + `"}]}`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	upstream := httptest.NewServer(mux)
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func decodeBody(t *testing.T, resp *http.Response) map[string]interface{} {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &doc))
+	return doc
+}
+
+func TestCompose_MergesWithDependencies(t *testing.T) {
+	upstream := newCompositeUpstream(t)
+	comp, err := NewComposite(CompositeOptions{
+		Calls: []CompositeCall{
+			{Name: "user", URL: upstream.URL + "/users/{{.Params.id}}", Required: true},
+			{Name: "orders", URL: upstream.URL + "/accounts/{{.Calls.user.account}}/orders", DependsOn: []string{"user"}},
+		},
+		Merge: []CompositeField{
+			{From: "user.name", To: "profile.name"},
+			{From: "orders.items", To: "profile.orders"},
+		},
+		ForwardHeaders: []string{"Accept-Language"},
+	})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Get("/home/:id", client.Compose(comp))
+
+	req := httptest.NewRequest(http.MethodGet, "/home/7", nil)
+	req.Header.Set("Accept-Language", "de")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(CompositeFailedHeader))
+
+	assert.Equal(t, map[string]interface{}{
+		"profile": map[string]interface{}{
+			"name":   "ann",
+			"orders": []interface{}{map[string]interface{}{"account": "a-1", "lang": "de"}},
+		},
+	}, decodeBody(t, resp))
+}
+
+func TestCompose_PartialFailure(t *testing.T) {
+	upstream := newCompositeUpstream(t)
+	comp, err := NewComposite(CompositeOptions{
+		Calls: []CompositeCall{
+			{Name: "user", URL: upstream.URL + "/users/{{.Params.id}}"},
+			{Name: "recs", URL: upstream.URL + "/slow", Timeout: 20 * time.Millisecond, Fallback: `[]`},
+			{Name: "ads", URL: upstream.URL + "/broken"},
+			{Name: "feed", URL: upstream.URL + "/accounts/x/orders", DependsOn: []string{"ads"}},
+		},
+	})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Get("/home/:id", client.Compose(comp))
+
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/home/7", nil))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "recs,ads,feed", resp.Header.Get(CompositeFailedHeader))
+
+	doc := decodeBody(t, resp)
+	assert.Equal(t, []interface{}{}, doc["recs"])
+	assert.Contains(t, doc, "user")
+	assert.NotContains(t, doc, "ads")
+	assert.NotContains(t, doc, "feed")
+}
+
+func TestCompose_RequiredCallFails(t *testing.T) {
+	upstream := newCompositeUpstream(t)
+	comp, err := NewComposite(CompositeOptions{
+		Calls: []CompositeCall{
+			{Name: "user", URL: upstream.URL + "/users/{{.Params.id}}"},
+			{Name: "ads", URL: upstream.URL + "/broken", Required: true},
+		},
+	})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Get("/home/:id", client.Compose(comp))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/home/7", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, `composite call "ads" failed`, decodeBody(t, resp)["error"])
+}
+
+func TestNewComposite_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CompositeOptions
+	}{
+		{"no calls", CompositeOptions{}},
+		{"missing name", CompositeOptions{Calls: []CompositeCall{{URL: "http://a"}}}},
+		{"duplicate name", CompositeOptions{Calls: []CompositeCall{{Name: "a", URL: "http://a"}, {Name: "a", URL: "http://b"}}}},
+		{"later dependency", CompositeOptions{Calls: []CompositeCall{{Name: "a", URL: "http://a", DependsOn: []string{"b"}}, {Name: "b", URL: "http://b"}}}},
+		{"bad template", CompositeOptions{Calls: []CompositeCall{{Name: "a", URL: "http://a/{{.Params.id"}}}},
+		{"bad fallback", CompositeOptions{Calls: []CompositeCall{{Name: "a", URL: "http://a", Fallback: "{"}}}},
+		{"unknown merge source", CompositeOptions{Calls: []CompositeCall{{Name: "a", URL: "http://a"}}, Merge: []CompositeField{{From: "b.x", To: "x"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewComposite(tt.opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewComposite_EscapesURLValues(t *testing.T) {
+	comp, err := NewComposite(CompositeOptions{Calls: []CompositeCall{{
+		Name: "a",
+		URL:  `http://a/users/{{.Params.id}}/{{.Calls.user.n}}?q={{.Claims.q}}&raw={{raw .Params.id}}{{if .UserID}}&u={{.UserID}}{{end}}&m={{.Calls.user.missing}}`,
+	}}})
+	require.NoError(t, err)
+
+	data := &compositeData{
+		TemplateData: &TemplateData{
+			UserID: "ann&admin=1",
+			Params: map[string]string{"id": "../x?y"},
+			Claims: map[string]string{"q": "a b&c=d"},
+		},
+		Calls: map[string]interface{}{"user": map[string]interface{}{"n": 42.0}},
+	}
+
+	var target bytes.Buffer
+	require.NoError(t, comp.calls[0].url.Execute(&target, data))
+	assert.Equal(t, "http://a/users/..%2Fx%3Fy/42?q=a+b%26c%3Dd&raw=../x?y&u=ann%26admin%3D1&m=", target.String())
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CookieRewrite adjusts upstream Set-Cookie headers for cookies that assume
+// the upstream is served at its own host and root path.
+type CookieRewrite struct {
+	// Domains maps an upstream cookie domain to the public one; "*" matches
+	// any domain and an empty target removes the attribute.
+	Domains map[string]string
+	// Paths maps an upstream path prefix to the public prefix.
+	Paths    map[string]string
+	Secure   bool
+	HTTPOnly bool
+	SameSite string
+}
+
+func (r *CookieRewrite) Apply(header http.Header) {
+	if r == nil {
+		return
+	}
+
+	values := header.Values("Set-Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	rewritten := make([]string, 0, len(values))
+	for _, value := range values {
+		rewritten = append(rewritten, r.rewrite(value))
+	}
+	header["Set-Cookie"] = rewritten
+}
+
+func (r *CookieRewrite) rewrite(value string) string {
+	cookie, err := http.ParseSetCookie(value)
+	if err != nil {
+		return value
+	}
+
+	if to, ok := r.Domains[strings.TrimPrefix(cookie.Domain, ".")]; ok && cookie.Domain != "" {
+		cookie.Domain = to
+	} else if to, ok := r.Domains["*"]; ok && cookie.Domain != "" {
+		cookie.Domain = to
+	}
+
+	if cookie.Path != "" {
+		cookie.Path = rewritePathPrefix(cookie.Path, r.Paths)
+	}
+
+	if r.Secure {
+		cookie.Secure = true
+	}
+	if r.HTTPOnly {
+		cookie.HttpOnly = true
+	}
+	switch strings.ToLower(r.SameSite) {
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+		cookie.Secure = true
+	}
+
+	return cookie.String()
+}
+
+// rewritePathPrefix applies the longest matching prefix mapping.
+func rewritePathPrefix(path string, prefixes map[string]string) string {
+	best := ""
+	for from := range prefixes {
+		if strings.HasPrefix(path, from) && len(from) > len(best) {
+			best = from
+		}
+	}
+	if best == "" {
+		return path
+	}
+	return prefixes[best] + strings.TrimPrefix(path, best)
+}
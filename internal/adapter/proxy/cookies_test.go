@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCookieRewrite_Apply(t *testing.T) {
+	rewrite := &CookieRewrite{
+		Domains:  map[string]string{"users.internal": "api.example.com"},
+		Paths:    map[string]string{"/": "/users/", "/admin": "/users/admin"},
+		Secure:   true,
+		SameSite: "Lax",
+	}
+
+	header := http.Header{}
+	header.Add("Set-Cookie", "session=abc; Domain=users.internal; Path=/admin/panel; HttpOnly")
+	header.Add("Set-Cookie", "prefs=dark; Path=/")
+	header.Add("Set-Cookie", "broken")
+
+	rewrite.Apply(header)
+
+	cookies := header.Values("Set-Cookie")
+	assert.Len(t, cookies, 3)
+	assert.Equal(t, "session=abc; Path=/users/admin/panel; Domain=api.example.com; HttpOnly; Secure; SameSite=Lax", cookies[0])
+	assert.Equal(t, "prefs=dark; Path=/users/; Secure; SameSite=Lax", cookies[1])
+	assert.Equal(t, "broken", cookies[2])
+}
+
+func TestCookieRewrite_DropDomainAndSameSiteNone(t *testing.T) {
+	rewrite := &CookieRewrite{Domains: map[string]string{"*": ""}, SameSite: "none"}
+
+	header := http.Header{}
+	header.Set("Set-Cookie", "id=1; Domain=.svc.cluster.local")
+	rewrite.Apply(header)
+
+	assert.Equal(t, "id=1; Secure; SameSite=None", header.Get("Set-Cookie"))
+}
+
+func TestForward_PreservesMultiValueHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "a=1; Path=/")
+		w.Header().Add("Set-Cookie", "b=2; Path=/")
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Add("Link", `</style.css>; rel=preload`)
+		w.Header().Add("Link", `</app.js>; rel=preload`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app := fiber.New()
+	app.Get("/app/*", client.Forward(RouteConfig{
+		Upstream:    upstream.URL,
+		StripPrefix: "/app",
+		Cookies:     &CookieRewrite{Paths: map[string]string{"/": "/app/"}},
+	}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/app/index", nil))
+	assert.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+
+	assert.ElementsMatch(t, []string{"a=1; Path=/app/", "b=2; Path=/app/"}, resp.Header.Values("Set-Cookie"))
+	assert.Equal(t, []string{"Origin", "Accept-Encoding"}, resp.Header.Values("Vary"))
+	assert.Len(t, resp.Header.Values("Link"), 2)
+}
@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+)
+
+const DefaultIndexFile = "index.html"
+
+type FileServerOptions struct {
+	// Root is the directory files are served from; nothing outside it is
+	// reachable, including through symlinks.
+	Root        string
+	StripPrefix string
+	// Index is served for directories, and for unknown paths when SPA is
+	// set. It defaults to index.html.
+	Index string
+	// SPA serves the root index for paths without a file extension that do
+	// not exist, so client-side routes load the app.
+	SPA bool
+	// Precompressed serves name.br or name.gz instead of name when the
+	// client accepts that encoding.
+	Precompressed bool
+	// MaxAge sets Cache-Control on files other than the index, which is
+	// always revalidated.
+	MaxAge time.Duration
+}
+
+// FileServer serves GET and HEAD requests from a directory with content
+// types, ETags, conditional and range requests handled by http.ServeContent.
+type FileServer struct {
+	opts FileServerOptions
+	root string
+}
+
+// precompressedVariants are tried in order of preference.
+var precompressedVariants = []struct {
+	encoding, suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func NewFileServer(opts FileServerOptions) (*FileServer, error) {
+	if opts.Index == "" {
+		opts.Index = DefaultIndexFile
+	}
+
+	root, err := filepath.Abs(opts.Root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file root: %w", err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("file root %q is not a directory", opts.Root)
+	}
+	return &FileServer{opts: opts, root: root}, nil
+}
+
+func (s *FileServer) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(s)
+}
+
+func (s *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, s.opts.StripPrefix))
+	file, info, err := s.open(name)
+	index := err == nil && path.Base(info.Name()) == s.opts.Index
+	if errors.Is(err, fs.ErrNotExist) && s.opts.SPA && path.Ext(name) == "" && !hidden(name) {
+		name = "/" + s.opts.Index
+		file, info, err = s.open(name)
+		index = true
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	defer file.Close()
+
+	header := w.Header()
+	if contentType := mime.TypeByExtension(path.Ext(info.Name())); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	etagSuffix := ""
+	if s.opts.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		// Ranges refer to the identity encoding, so they are served from
+		// the original file.
+		if r.Header.Get("Range") == "" {
+			for _, variant := range precompressedVariants {
+				if !acceptsEncoding(r.Header.Get("Accept-Encoding"), variant.encoding) {
+					continue
+				}
+				encoded, encodedInfo, err := s.open(name + variant.suffix)
+				if err != nil {
+					continue
+				}
+				defer encoded.Close()
+				file, info, etagSuffix = encoded, encodedInfo, "-"+variant.encoding
+				header.Set("Content-Encoding", variant.encoding)
+				break
+			}
+		}
+	}
+
+	header.Set("ETag", fmt.Sprintf(`"%x-%x%s"`, info.ModTime().UnixNano(), info.Size(), etagSuffix))
+	switch {
+	case index:
+		header.Set("Cache-Control", "no-cache")
+	case s.opts.MaxAge > 0:
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(s.opts.MaxAge.Seconds())))
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// open opens a regular file below the root, or the index of a directory.
+// Hidden files and directories are never served.
+func (s *FileServer) open(name string) (*os.File, fs.FileInfo, error) {
+	if hidden(name) {
+		return nil, nil, fs.ErrNotExist
+	}
+
+	full, err := s.resolve(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		if full, err = s.resolve(path.Join(name, s.opts.Index)); err != nil {
+			return nil, nil, err
+		}
+		if info, err = os.Stat(full); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fs.ErrNotExist
+	}
+
+	file, err := os.Open(full)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// resolve maps a cleaned URL path to a file path, following symlinks only
+// as long as they stay below the root.
+func (s *FileServer) resolve(name string) (string, error) {
+	full, err := filepath.EvalSymlinks(filepath.Join(s.root, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	if full != s.root && !strings.HasPrefix(full, s.root+string(filepath.Separator)) {
+		return "", fs.ErrNotExist
+	}
+	return full, nil
+}
+
+func hidden(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") && segment != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows
+// encoding, ignoring codings listed with q=0.
+func acceptsEncoding(accept, encoding string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", fiber.MIMEApplicationJSON)
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `{"error":%q}`, message)
+}
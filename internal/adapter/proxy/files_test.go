@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestSite lays out a site with precompressed assets, a hidden file and
+// a symlink leading out of it, and returns its root.
+func writeTestSite(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":          "<html>app</html>",
+		"assets/app.js":       "console.log('app')",
+		"assets/app.js.br":    "brotli",
+		"assets/app.js.gz":    "gzip",
+		"assets/style.css":    "body{}",
+		"docs/index.html":     "<html>docs</html>",
+		".env":                "SECRET=1",
+		"../outside/leak.txt": "leak",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, "site", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	require.NoError(t, os.Symlink(filepath.Join(dir, "outside", "leak.txt"), filepath.Join(dir, "site", "leak.txt")))
+
+	return filepath.Join(dir, "site")
+}
+
+func TestFileServer(t *testing.T) {
+	server, err := NewFileServer(FileServerOptions{Root: writeTestSite(t), StripPrefix: "/app", SPA: true, Precompressed: true, MaxAge: time.Hour})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Add([]string{fiber.MethodGet, fiber.MethodHead}, "/app/*", server.Handler())
+
+	tests := []struct {
+		name         string
+		path         string
+		header       map[string]string
+		wantStatus   int
+		wantBody     string
+		wantType     string
+		wantEncoding string
+		wantCache    string
+	}{
+		{"javascript", "/app/assets/app.js", nil, 200, "console.log('app')", "text/javascript; charset=utf-8", "", "public, max-age=3600"},
+		{"css", "/app/assets/style.css", nil, 200, "body{}", "text/css; charset=utf-8", "", "public, max-age=3600"},
+		{"brotli preferred", "/app/assets/app.js", map[string]string{"Accept-Encoding": "gzip, br"}, 200, "brotli", "text/javascript; charset=utf-8", "br", "public, max-age=3600"},
+		{"gzip", "/app/assets/app.js", map[string]string{"Accept-Encoding": "gzip, br;q=0"}, 200, "gzip", "text/javascript; charset=utf-8", "gzip", "public, max-age=3600"},
+		{"range", "/app/assets/app.js", map[string]string{"Range": "bytes=0-6", "Accept-Encoding": "br"}, 206, "console", "text/javascript; charset=utf-8", "", "public, max-age=3600"},
+		{"root index", "/app/", nil, 200, "<html>app</html>", "text/html; charset=utf-8", "", "no-cache"},
+		{"directory index", "/app/docs", nil, 200, "<html>docs</html>", "text/html; charset=utf-8", "", "no-cache"},
+		{"SPA fallback", "/app/settings/profile", nil, 200, "<html>app</html>", "text/html; charset=utf-8", "", "no-cache"},
+		{"missing asset", "/app/assets/missing.js", nil, 404, `{"error":"not found"}`, "application/json", "", ""},
+		{"hidden file", "/app/.env", nil, 404, `{"error":"not found"}`, "application/json", "", ""},
+		{"traversal", "/app/../outside/leak.txt", nil, 404, `{"error":"not found"}`, "application/json", "", ""},
+		{"symlink out of root", "/app/leak.txt", nil, 404, `{"error":"not found"}`, "application/json", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(body))
+			assert.Equal(t, tt.wantType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tt.wantEncoding, resp.Header.Get("Content-Encoding"))
+			assert.Equal(t, tt.wantCache, resp.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+func TestFileServer_Conditional(t *testing.T) {
+	server, err := NewFileServer(FileServerOptions{Root: writeTestSite(t), StripPrefix: "/app", Precompressed: true})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Add([]string{fiber.MethodGet, fiber.MethodHead}, "/app/*", server.Handler())
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/app/assets/style.css", nil))
+	require.NoError(t, err)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+
+	req := httptest.NewRequest(http.MethodGet, "/app/assets/style.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/app/assets/app.js", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	assert.Contains(t, resp.Header.Get("ETag"), "-br")
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/app/settings", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "no SPA fallback unless enabled")
+}
+
+func TestFileServer_Head(t *testing.T) {
+	server, err := NewFileServer(FileServerOptions{Root: writeTestSite(t), StripPrefix: "/app"})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Add([]string{fiber.MethodGet, fiber.MethodHead}, "/app/*", server.Handler())
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodHead, "/app/assets/style.css", nil))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "6", resp.Header.Get("Content-Length"))
+	assert.Empty(t, body)
+}
+
+func TestNewFileServer_MissingRoot(t *testing.T) {
+	_, err := NewFileServer(FileServerOptions{Root: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	assert.True(t, acceptsEncoding("gzip, deflate, br", "br"))
+	assert.True(t, acceptsEncoding("GZIP;q=0.5", "gzip"))
+	assert.False(t, acceptsEncoding("gzip;q=0", "gzip"))
+	assert.False(t, acceptsEncoding("", "br"))
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Hop-by-hop headers apply to a single connection and must not be forwarded
+// in either direction (RFC 9110 section 7.6.1).
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopByHop(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// TrustedProxies lists the peers whose X-Forwarded-* and Forwarded headers are
+// kept and extended rather than replaced.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// ParseTrustedProxies accepts CIDRs and bare IPs. Invalid entries are skipped
+// and reported in the returned error.
+func ParseTrustedProxies(entries []string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	var invalid []string
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 128
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				t.nets = append(t.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+			invalid = append(invalid, entry)
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			invalid = append(invalid, entry)
+			continue
+		}
+		t.nets = append(t.nets, ipNet)
+	}
+
+	if len(invalid) > 0 {
+		return t, fmt.Errorf("invalid trusted proxies: %s", strings.Join(invalid, ", "))
+	}
+	return t, nil
+}
+
+func (t *TrustedProxies) Contains(ip net.IP) bool {
+	if t == nil || ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// setForwardedHeaders records the client hop in X-Forwarded-* and Forwarded.
+// Values from a trusted peer are extended; anything else is replaced so
+// clients cannot spoof their origin.
+func setForwardedHeaders(header http.Header, remote net.IP, proto, host string, trusted bool) {
+	if !trusted {
+		header.Del("X-Forwarded-For")
+		header.Del("X-Forwarded-Proto")
+		header.Del("X-Forwarded-Host")
+		header.Del("Forwarded")
+	}
+
+	client := remote.String()
+	if prior := strings.Join(header.Values("X-Forwarded-For"), ", "); prior != "" {
+		header.Set("X-Forwarded-For", prior+", "+client)
+	} else {
+		header.Set("X-Forwarded-For", client)
+	}
+
+	if header.Get("X-Forwarded-Proto") == "" {
+		header.Set("X-Forwarded-Proto", proto)
+	}
+	if header.Get("X-Forwarded-Host") == "" && host != "" {
+		header.Set("X-Forwarded-Host", host)
+	}
+
+	element := "for=" + forwardedNode(remote) + ";proto=" + proto
+	if host != "" {
+		element += ";host=" + quoteForwarded(host)
+	}
+	if prior := strings.Join(header.Values("Forwarded"), ", "); prior != "" {
+		element = prior + ", " + element
+	}
+	header.Set("Forwarded", element)
+}
+
+func forwardedNode(ip net.IP) string {
+	if ip.To4() == nil {
+		return `"[` + ip.String() + `]"`
+	}
+	return ip.String()
+}
+
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, `:;,"[] `) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
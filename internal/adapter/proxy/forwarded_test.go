@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveHopByHop(t *testing.T) {
+	header := http.Header{}
+	header.Set("Connection", "keep-alive, X-Session-Hint")
+	header.Set("X-Session-Hint", "abc")
+	header.Set("Keep-Alive", "timeout=5")
+	header.Set("Transfer-Encoding", "chunked")
+	header.Set("Upgrade", "websocket")
+	header.Set("X-Keep", "yes")
+
+	removeHopByHop(header)
+
+	assert.Equal(t, http.Header{"X-Keep": {"yes"}}, header)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5", "::1", "bogus"})
+	assert.Error(t, err)
+
+	assert.True(t, trusted.Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, trusted.Contains(net.ParseIP("192.168.1.5")))
+	assert.True(t, trusted.Contains(net.ParseIP("::1")))
+	assert.False(t, trusted.Contains(net.ParseIP("192.168.1.6")))
+
+	var none *TrustedProxies
+	assert.False(t, none.Contains(net.ParseIP("10.1.2.3")))
+}
+
+func TestSetForwardedHeaders_Untrusted(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Forwarded-For", "6.6.6.6")
+	header.Set("X-Forwarded-Host", "evil.example")
+	header.Set("Forwarded", "for=6.6.6.6")
+
+	setForwardedHeaders(header, net.ParseIP("203.0.113.9"), "https", "api.example.com", false)
+
+	assert.Equal(t, "203.0.113.9", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "api.example.com", header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "for=203.0.113.9;proto=https;host=api.example.com", header.Get("Forwarded"))
+}
+
+func TestSetForwardedHeaders_TrustedChain(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Forwarded-For", "198.51.100.1")
+	header.Set("X-Forwarded-Proto", "https")
+	header.Set("Forwarded", "for=198.51.100.1;proto=https")
+
+	setForwardedHeaders(header, net.ParseIP("2001:db8::1"), "http", "gw:8080", true)
+
+	assert.Equal(t, "198.51.100.1, 2001:db8::1", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, `for=198.51.100.1;proto=https, for="[2001:db8::1]";proto=http;host="gw:8080"`, header.Get("Forwarded"))
+}
+
+func TestForward_ForwardingHeaders(t *testing.T) {
+	var received http.Header
+	var receivedHost string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		receivedHost = r.Host
+		w.Header().Set("Connection", "X-Upstream-Hint")
+		w.Header().Set("X-Upstream-Hint", "internal")
+		w.Header().Set("X-Visible", "yes")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app := fiber.New()
+	app.Get("/default", client.Forward(RouteConfig{Upstream: upstream.URL}))
+	app.Get("/preserve", client.Forward(RouteConfig{
+		Upstream:         upstream.URL,
+		PreserveHost:     true,
+		StripCredentials: true,
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "http://public.example/default", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Connection", "X-Client-Hint")
+	req.Header.Set("X-Client-Hint", "drop-me")
+	req.Header.Set("X-Forwarded-For", "6.6.6.6")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+
+	assert.Equal(t, "Bearer token", received.Get("Authorization"))
+	assert.Empty(t, received.Get("X-Client-Hint"))
+	assert.NotContains(t, received.Get("X-Forwarded-For"), "6.6.6.6")
+	assert.Equal(t, "public.example", received.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", received.Get("X-Forwarded-Proto"))
+	assert.Contains(t, received.Get("Forwarded"), "host=public.example")
+	assert.NotEqual(t, "public.example", receivedHost)
+	assert.Empty(t, resp.Header.Get("X-Upstream-Hint"))
+	assert.Equal(t, "yes", resp.Header.Get("X-Visible"))
+
+	req = httptest.NewRequest(http.MethodGet, "http://public.example/preserve", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+
+	assert.Empty(t, received.Get("Authorization"))
+	assert.Equal(t, "public.example", receivedHost)
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// HeaderRules are applied in the order remove, rename, set, add. Values of set
+// and add are text/template strings rendered against TemplateData.
+type HeaderRules struct {
+	Add    map[string]string
+	Set    map[string]string
+	Remove []string
+	Rename map[string]string
+}
+
+// TemplateData is what header templates can refer to, e.g.
+// {{.RequestID}}, {{.Params.id}} or {{.Claims.sub}}.
+type TemplateData struct {
+	RequestID string
+	ClientIP  string
+	UserID    string
+	Method    string
+	Path      string
+	Params    map[string]string
+	Claims    map[string]string
+}
+
+type HeaderTransform struct {
+	remove []string
+	rename [][2]string
+	set    []headerValue
+	add    []headerValue
+}
+
+type headerValue struct {
+	name    string
+	literal string
+	tmpl    *template.Template
+}
+
+// legacyPlaceholder matches the {{.claim}} form accepted by Route.Headers
+// before templates were introduced.
+var legacyPlaceholder = regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`)
+
+func NewHeaderTransform(rules HeaderRules) (*HeaderTransform, error) {
+	t := &HeaderTransform{}
+
+	for _, name := range rules.Remove {
+		t.remove = append(t.remove, http.CanonicalHeaderKey(name))
+	}
+
+	for _, from := range sortedKeys(rules.Rename) {
+		t.rename = append(t.rename, [2]string{http.CanonicalHeaderKey(from), http.CanonicalHeaderKey(rules.Rename[from])})
+	}
+
+	var err error
+	if t.set, err = compileHeaderValues(rules.Set); err != nil {
+		return nil, err
+	}
+	if t.add, err = compileHeaderValues(rules.Add); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// NewLegacyHeaderTransform turns Route.Headers into set rules, mapping
+// {{.UserID}} and {{.<claim>}} placeholders onto the template data.
+func NewLegacyHeaderTransform(headers map[string]string) (*HeaderTransform, error) {
+	set := make(map[string]string, len(headers))
+	for name, value := range headers {
+		set[name] = legacyPlaceholder.ReplaceAllStringFunc(value, func(m string) string {
+			field := legacyPlaceholder.FindStringSubmatch(m)[1]
+			if field == "UserID" {
+				return "{{.UserID}}"
+			}
+			return fmt.Sprintf("{{index .Claims %q}}", field)
+		})
+	}
+
+	return NewHeaderTransform(HeaderRules{Set: set})
+}
+
+func (t *HeaderTransform) Apply(header http.Header, data *TemplateData) {
+	if t == nil {
+		return
+	}
+
+	for _, name := range t.remove {
+		header.Del(name)
+	}
+
+	for _, rename := range t.rename {
+		if values, ok := header[rename[0]]; ok {
+			header.Del(rename[0])
+			header[rename[1]] = append(header[rename[1]], values...)
+		}
+	}
+
+	for _, value := range t.set {
+		if rendered, ok := value.render(data); ok {
+			header.Set(value.name, rendered)
+		}
+	}
+
+	for _, value := range t.add {
+		if rendered, ok := value.render(data); ok {
+			header.Add(value.name, rendered)
+		}
+	}
+}
+
+func (v headerValue) render(data *TemplateData) (string, bool) {
+	if v.tmpl == nil {
+		return v.literal, true
+	}
+
+	var buf bytes.Buffer
+	if err := v.tmpl.Execute(&buf, data); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+func compileHeaderValues(values map[string]string) ([]headerValue, error) {
+	var compiled []headerValue
+	for _, name := range sortedKeys(values) {
+		value := headerValue{name: http.CanonicalHeaderKey(name), literal: values[name]}
+
+		if strings.Contains(value.literal, "{{") {
+			tmpl, err := compileTemplate(value.name, value.literal)
+			if err != nil {
+				return nil, fmt.Errorf("header %s: %w", name, err)
+			}
+			value.tmpl = tmpl
+		}
+
+		compiled = append(compiled, value)
+	}
+	return compiled, nil
+}
+
+func compileTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Render once against empty data so references to unknown fields fail
+	// at load time rather than per request.
+	if err := tmpl.Execute(&bytes.Buffer{}, &TemplateData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func templateData(ctx fiber.Ctx) *TemplateData {
+	data := &TemplateData{
+		ClientIP: ctx.IP(),
+		UserID:   getUserID(ctx),
+		Method:   ctx.Method(),
+		Path:     ctx.Path(),
+		Params:   make(map[string]string),
+		Claims:   make(map[string]string),
+	}
+
+	if id, ok := ctx.Locals("request_id").(string); ok {
+		data.RequestID = id
+	}
+
+	for _, name := range ctx.Route().Params {
+		data.Params[name] = ctx.Params(name)
+	}
+
+	for key, value := range getUserClaims(ctx) {
+		data.Claims[key] = toString(value)
+	}
+
+	return data
+}
+
+// clone copies data for use after the request it was taken from is done.
+func (d *TemplateData) clone() *TemplateData {
+	out := &TemplateData{
+		RequestID: strings.Clone(d.RequestID),
+		ClientIP:  strings.Clone(d.ClientIP),
+		UserID:    strings.Clone(d.UserID),
+		Method:    strings.Clone(d.Method),
+		Path:      strings.Clone(d.Path),
+		Params:    make(map[string]string, len(d.Params)),
+		Claims:    make(map[string]string, len(d.Claims)),
+	}
+	for key, value := range d.Params {
+		out.Params[strings.Clone(key)] = strings.Clone(value)
+	}
+	for key, value := range d.Claims {
+		out.Claims[key] = value
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderTransform_Apply(t *testing.T) {
+	transform, err := NewHeaderTransform(HeaderRules{
+		Remove: []string{"x-debug"},
+		Rename: map[string]string{"X-Old": "X-New"},
+		Set:    map[string]string{"X-User": "{{.UserID}}", "X-Static": "fixed"},
+		Add:    map[string]string{"X-Trace": "{{.RequestID}}-{{.Params.id}}-{{.Claims.tier}}"},
+	})
+	assert.NoError(t, err)
+
+	header := http.Header{}
+	header.Set("X-Debug", "1")
+	header.Set("X-Old", "value")
+	header.Set("X-Trace", "upstream")
+
+	transform.Apply(header, &TemplateData{
+		RequestID: "req-1",
+		UserID:    "u-7",
+		Params:    map[string]string{"id": "42"},
+		Claims:    map[string]string{"tier": "gold"},
+	})
+
+	assert.Empty(t, header.Get("X-Debug"))
+	assert.Empty(t, header.Get("X-Old"))
+	assert.Equal(t, "value", header.Get("X-New"))
+	assert.Equal(t, "u-7", header.Get("X-User"))
+	assert.Equal(t, "fixed", header.Get("X-Static"))
+	assert.Equal(t, []string{"upstream", "req-1-42-gold"}, header.Values("X-Trace"))
+}
+
+func TestHeaderTransform_MissingValuesRenderEmpty(t *testing.T) {
+	transform, err := NewHeaderTransform(HeaderRules{
+		Set: map[string]string{"X-Tenant": "{{.Claims.tenant}}"},
+	})
+	assert.NoError(t, err)
+
+	header := http.Header{}
+	transform.Apply(header, &TemplateData{})
+	assert.Equal(t, []string{""}, header.Values("X-Tenant"))
+}
+
+func TestHeaderTransform_RejectsBadTemplates(t *testing.T) {
+	_, err := NewHeaderTransform(HeaderRules{Set: map[string]string{"X-A": "{{.Unknown}}"}})
+	assert.Error(t, err)
+
+	_, err = NewHeaderTransform(HeaderRules{Add: map[string]string{"X-A": "{{.UserID"}})
+	assert.Error(t, err)
+}
+
+func TestLegacyHeaderTransform(t *testing.T) {
+	transform, err := NewLegacyHeaderTransform(map[string]string{
+		"X-User-ID": "{{.UserID}}",
+		"X-Role":    "role={{.role}}",
+	})
+	assert.NoError(t, err)
+
+	header := http.Header{}
+	transform.Apply(header, &TemplateData{UserID: "u-1", Claims: map[string]string{"role": "admin"}})
+	assert.Equal(t, "u-1", header.Get("X-User-ID"))
+	assert.Equal(t, "role=admin", header.Get("X-Role"))
+}
+
+func TestForward_HeaderRules(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "internal/1.0")
+		w.Header().Set("X-Powered-By", "legacy")
+		w.Header().Set("X-Echo-Account", r.Header.Get("X-Account"))
+		w.Header().Set("X-Echo-Internal", r.Header.Get("X-Internal"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	requestRules, err := NewHeaderTransform(HeaderRules{
+		Remove: []string{"X-Internal"},
+		Set:    map[string]string{"X-Account": "acct-{{.Params.id}}"},
+	})
+	assert.NoError(t, err)
+	responseRules, err := NewHeaderTransform(HeaderRules{
+		Remove: []string{"Server", "X-Powered-By"},
+		Add:    map[string]string{"X-Gateway-Method": "{{.Method}}"},
+	})
+	assert.NoError(t, err)
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app := fiber.New()
+	app.Get("/users/:id", client.Forward(RouteConfig{
+		Upstream:        upstream.URL,
+		RequestHeaders:  requestRules,
+		ResponseHeaders: responseRules,
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("X-Internal", "secret")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+
+	assert.Equal(t, "acct-42", resp.Header.Get("X-Echo-Account"))
+	assert.Empty(t, resp.Header.Get("X-Echo-Internal"))
+	assert.Empty(t, resp.Header.Get("X-Powered-By"))
+	assert.NotEqual(t, "internal/1.0", resp.Header.Get("Server"))
+	assert.Equal(t, "GET", resp.Header.Get("X-Gateway-Method"))
+}
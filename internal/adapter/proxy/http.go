@@ -11,13 +11,15 @@ import (
 	"strings"
 	"time"
 
+	"api-gateway/internal/adapter/resilience"
 	"api-gateway/internal/domain/proxy"
 
 	"github.com/gofiber/fiber/v3"
 )
 
 type HTTPClient struct {
-	client *http.Client
+	client  *http.Client
+	trusted *TrustedProxies
 }
 
 type Options struct {
@@ -27,6 +29,7 @@ type Options struct {
 	IdleConnTimeout     time.Duration
 	MaxIdleConns        int
 	MaxIdleConnsPerHost int
+	TrustedProxies      *TrustedProxies
 }
 
 func NewHTTPClient(opts Options) *HTTPClient {
@@ -42,7 +45,8 @@ func NewHTTPClient(opts Options) *HTTPClient {
 	}
 
 	return &HTTPClient{
-		client: client,
+		client:  client,
+		trusted: opts.TrustedProxies,
 	}
 }
 
@@ -97,105 +101,108 @@ func NewRequest(method, url string, body []byte) *proxy.Request {
 	}
 }
 
-func (c *HTTPClient) Forward(route struct {
+// RouteConfig describes how a route reaches its upstream.
+type RouteConfig struct {
 	Upstream    string
 	StripPrefix string
-	Headers     map[string]string
-}) fiber.Handler {
-	return func(ctx fiber.Ctx) error {
-		upstream := route.Upstream
-		path := ctx.Path()
+	// Headers is the legacy form of RequestHeaders.Set.
+	Headers         map[string]string
+	RequestHeaders  *HeaderTransform
+	ResponseHeaders *HeaderTransform
+	RequestBody     *BodyTransform
+	ResponseBody    *BodyTransform
+	// PreserveHost sends the client's Host upstream instead of the
+	// upstream's own host.
+	PreserveHost bool
+	// StripCredentials drops the inbound Authorization header.
+	StripCredentials bool
+	Cookies          *CookieRewrite
+	Rewrite          *PathRewrite
+	Mirror           *Mirror
+}
 
-		if route.StripPrefix != "" {
-			path = strings.TrimPrefix(path, route.StripPrefix)
-		}
+func (c *HTTPClient) Forward(route RouteConfig) fiber.Handler {
+	// Invalid templates are reported when the router builds the route; here
+	// they just disable the legacy headers.
+	legacyHeaders, _ := NewLegacyHeaderTransform(route.Headers)
 
-		target, err := parseURL(upstream, path, string(ctx.Request().URI().QueryString()))
+	return func(ctx fiber.Ctx) error {
+		out := c.prepare(ctx, route, legacyHeaders)
+		upstream, path, query, baseHeaders, body, data := out.upstream, out.path, out.query, out.header, out.body, out.data
+		target, err := parseURL(upstream, path, query)
 		if err != nil {
 			return ctx.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 				"error": "invalid upstream URL",
 			})
 		}
 
-		body := append([]byte(nil), ctx.Body()...)
-		baseHeaders := make(http.Header)
-		ctx.Request().Header.VisitAll(func(key, value []byte) {
-			baseHeaders.Add(string(key), string(value))
-		})
+		mirrored := route.Mirror.start(c, ctx.Method(), path, query, baseHeaders, body)
 
-		if route.Headers != nil {
-			userID := getUserID(ctx)
-			userClaims := getUserClaims(ctx)
-			for k, v := range route.Headers {
-				v = strings.ReplaceAll(v, "{{.UserID}}", userID)
-				for claimKey, claimValue := range userClaims {
-					v = strings.ReplaceAll(v, "{{."+claimKey+"}}", toString(claimValue))
-				}
-				baseHeaders.Set(k, v)
+		policy, _ := ctx.Locals("retry_policy").(*resilience.RetryPolicy)
+		attempts := 1
+		if policy != nil {
+			if policy.Budget != nil {
+				policy.Budget.Deposit()
+			}
+			if policy.AllowsMethod(ctx.Method(), baseHeaders) {
+				attempts = policy.Attempts + 1
 			}
 		}
 
-		attempts := 1
-		if v, ok := ctx.Locals("retry_attempts").(int); ok && v > 0 {
-			attempts = v + 1
+		hedge, _ := ctx.Locals("hedge_policy").(*resilience.HedgePolicy)
+		if hedge != nil && !hedge.AllowsMethod(ctx.Method()) {
+			hedge = nil
 		}
 
-		backoff, _ := ctx.Locals("retry_backoff").(time.Duration)
-		maxBackoff, ok := ctx.Locals("retry_max_backoff").(time.Duration)
-		if !ok || maxBackoff <= 0 {
-			maxBackoff = 5 * time.Second
+		reqCtx := context.Context(ctx.Context())
+		if timeout, _ := ctx.Locals("request_timeout").(time.Duration); timeout > 0 {
+			var cancel context.CancelFunc
+			reqCtx, cancel = context.WithTimeout(reqCtx, timeout)
+			defer cancel()
 		}
 
-		timeout, _ := ctx.Locals("request_timeout").(time.Duration)
-
 		var lastErr error
+		var lastResp *proxy.Response
 		for attempt := 0; attempt < attempts; attempt++ {
-			if attempt > 0 && backoff > 0 {
-				time.Sleep(backoff)
-				backoff *= 2
-				if backoff > maxBackoff {
-					backoff = maxBackoff
+			if attempt > 0 {
+				if policy.Budget != nil && !policy.Budget.Withdraw() {
+					break
+				}
+				if err := sleepContext(reqCtx, policy.Delay(attempt)); err != nil {
+					lastErr = err
+					break
 				}
 			}
 
-			reqCtx := ctx.Context()
-			cancel := func() {}
-			if timeout > 0 {
-				reqCtxWithTimeout, cancelFunc := context.WithTimeout(reqCtx, timeout)
-				reqCtx = reqCtxWithTimeout
-				cancel = cancelFunc
+			var resp *proxy.Response
+			if hedge != nil {
+				resp, err = c.hedged(reqCtx, policy, hedge, ctx.Method(), upstream, path, query, baseHeaders, body)
+			} else {
+				resp, err = c.attempt(reqCtx, policy, ctx.Method(), target.String(), baseHeaders, body)
 			}
-
-			req, err := http.NewRequestWithContext(reqCtx, ctx.Method(), target.String(), bytes.NewReader(body))
-			if err != nil {
-				cancel()
-				return ctx.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-					"error": "failed to create request",
-				})
-			}
-			req.Header = cloneHeaders(baseHeaders)
-
-			resp, err := c.client.Do(req)
-			cancel()
 			if err != nil {
 				lastErr = err
+				lastResp = nil
+				if policy == nil || !policy.RetryableError(err) || reqCtx.Err() != nil {
+					break
+				}
 				continue
 			}
 
-			bodyBytes, readErr := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			if readErr != nil {
-				lastErr = readErr
-				continue
+			lastResp = resp
+			if policy == nil || !policy.RetryableStatus(resp.StatusCode) {
+				break
 			}
+		}
 
-			if resp.StatusCode >= fiber.StatusInternalServerError && attempt < attempts-1 {
-				continue
-			}
+		mirrored(lastResp)
 
-			return writeResponse(ctx, resp.StatusCode, resp.Header, bodyBytes)
+		if lastResp != nil {
+			header, respBody := route.respond(lastResp, data)
+			return writeResponse(ctx, lastResp.StatusCode, header, respBody)
 		}
 
+		ctx.Locals("upstream_error", lastErr)
 		return ctx.Status(fiber.StatusBadGateway).JSON(fiber.Map{
 			"error":   "failed to forward request",
 			"details": errorMessage(lastErr),
@@ -203,16 +210,275 @@ func (c *HTTPClient) Forward(route struct {
 	}
 }
 
+// outbound is a client request prepared for the upstream.
+type outbound struct {
+	upstream string
+	path     string
+	query    string
+	header   http.Header
+	body     []byte
+	data     *TemplateData
+}
+
+// prepare applies the route's upstream selection, path rewriting and
+// request header and body rules to a client request.
+func (c *HTTPClient) prepare(ctx fiber.Ctx, route RouteConfig, legacyHeaders *HeaderTransform) *outbound {
+	upstream := route.Upstream
+	// A traffic split picks the upstream per request.
+	if picked, ok := ctx.Locals("upstream").(string); ok && picked != "" {
+		upstream = picked
+	}
+	path := ctx.Path()
+
+	if route.StripPrefix != "" {
+		path = strings.TrimPrefix(path, route.StripPrefix)
+	}
+
+	data := templateData(ctx)
+	path = route.Rewrite.Path(path, data.Params)
+	query := route.Rewrite.Query(string(ctx.Request().URI().QueryString()))
+
+	body := append([]byte(nil), ctx.Body()...)
+	header := make(http.Header)
+	ctx.Request().Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+
+	removeHopByHop(header)
+	header.Del("Content-Length")
+	header.Del("Host")
+	if route.PreserveHost {
+		header.Set("Host", string(ctx.Request().Host()))
+	}
+	if route.StripCredentials {
+		header.Del("Authorization")
+	}
+
+	remote := ctx.RequestCtx().RemoteIP()
+	proto := "http"
+	if ctx.RequestCtx().IsTLS() {
+		proto = "https"
+	}
+	setForwardedHeaders(header, remote, proto, string(ctx.Request().Host()), c.trusted.Contains(remote))
+
+	legacyHeaders.Apply(header, data)
+	route.RequestHeaders.Apply(header, data)
+	body = transformBody(route.RequestBody, header, body, data)
+
+	return &outbound{upstream: upstream, path: path, query: query, header: header, body: body, data: data}
+}
+
+// respond applies the route's response header, cookie and body rules to an
+// upstream response.
+func (route RouteConfig) respond(resp *proxy.Response, data *TemplateData) (http.Header, []byte) {
+	header := cloneHeaders(resp.Header)
+	removeHopByHop(header)
+	route.Cookies.Apply(header)
+	body := transformBody(route.ResponseBody, header, resp.Body, data)
+	route.ResponseHeaders.Apply(header, data)
+	return header, body
+}
+
+// Fetch prepares, while a client GET is served, a repeat of it that can run
+// after the request is done, as used for background cache refreshes. The
+// request and response go through the same rules as in Forward; the header
+// passed to the returned function, e.g. validators, is set on top.
+func (c *HTTPClient) Fetch(route RouteConfig) func(fiber.Ctx) func(context.Context, http.Header) (*proxy.Response, error) {
+	legacyHeaders, _ := NewLegacyHeaderTransform(route.Headers)
+
+	return func(ctx fiber.Ctx) func(context.Context, http.Header) (*proxy.Response, error) {
+		// Strings from the request context are only valid during the request.
+		out := c.prepare(ctx, route, legacyHeaders)
+		out.path = strings.Clone(out.path)
+		out.data = out.data.clone()
+
+		return func(reqCtx context.Context, extra http.Header) (*proxy.Response, error) {
+			target, err := parseURL(out.upstream, out.path, out.query)
+			if err != nil {
+				return nil, err
+			}
+
+			header := cloneHeaders(out.header)
+			for name, values := range extra {
+				header[http.CanonicalHeaderKey(name)] = values
+			}
+
+			resp, err := c.attempt(reqCtx, nil, http.MethodGet, target.String(), header, out.body)
+			if err != nil {
+				return nil, err
+			}
+			resp.Header, resp.Body = route.respond(resp, out.data)
+			return resp, nil
+		}
+	}
+}
+
+// attempt performs a single upstream call, bounded by the policy's per-try
+// timeout when one is set.
+func (c *HTTPClient) attempt(ctx context.Context, policy *resilience.RetryPolicy, method, target string, header http.Header, body []byte) (*proxy.Response, error) {
+	if policy != nil && policy.PerTryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.PerTryTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = cloneHeaders(header)
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxy.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       bodyBytes,
+	}, nil
+}
+
+type hedgeResult struct {
+	index int
+	resp  *proxy.Response
+	err   error
+}
+
+// hedged races up to MaxHedges extra attempts against a slow primary and
+// returns the first acceptable response, cancelling the others.
+func (c *HTTPClient) hedged(ctx context.Context, retry *resilience.RetryPolicy, hedge *resilience.HedgePolicy, method, primary, path, query string, header http.Header, body []byte) (*proxy.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Losing attempts may still be starting after the request is done.
+	method, path = strings.Clone(method), strings.Clone(path)
+
+	total := hedge.MaxHedges + 1
+	results := make(chan hedgeResult, total)
+	launched := 0
+	launch := func() {
+		index := launched
+		launched++
+		if index > 0 && hedge.Observer != nil {
+			hedge.Observer.Hedged()
+		}
+
+		go func() {
+			target, err := parseURL(hedge.Target(primary, index), path, query)
+			if err != nil {
+				results <- hedgeResult{index: index, err: err}
+				return
+			}
+
+			start := time.Now()
+			resp, err := c.attempt(ctx, retry, method, target.String(), header, body)
+			// The delay follows the primary's latency. A primary cancelled
+			// because a hedge won took at least this long, and leaving it out
+			// would shrink the delay to that of the fastest responses.
+			if index == 0 && (err == nil || ctx.Err() != nil) {
+				hedge.Observe(time.Since(start))
+			}
+			results <- hedgeResult{index: index, resp: resp, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(hedge.HedgeDelay())
+	defer timer.Stop()
+
+	var last hedgeResult
+	for done := 0; done < total; {
+		select {
+		case <-timer.C:
+			if launched < total {
+				launch()
+				timer.Reset(hedge.HedgeDelay())
+			}
+		case result := <-results:
+			done++
+			last = result
+			if result.err == nil && !failedStatus(retry, result.resp.StatusCode) {
+				if hedge.Observer != nil && launched > 1 {
+					hedge.Observer.Won(result.index > 0)
+				}
+				return result.resp, nil
+			}
+			if launched < total {
+				launch()
+				timer.Reset(hedge.HedgeDelay())
+			} else if done == launched {
+				return last.resp, last.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return last.resp, last.err
+}
+
+func failedStatus(policy *resilience.RetryPolicy, status int) bool {
+	if policy != nil {
+		return policy.RetryableStatus(status)
+	}
+	return status >= http.StatusInternalServerError
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func parseURL(upstream, path, query string) (*url.URL, error) {
 	u, err := url.Parse(upstream)
 	if err != nil {
 		return nil, err
 	}
-	u.Path = path
-	u.RawQuery = query
+	u.Path = joinPath(u.Path, path)
+	u.RawPath = ""
+	if u.RawQuery != "" && query != "" {
+		u.RawQuery += "&" + query
+	} else if query != "" {
+		u.RawQuery = query
+	}
 	return u, nil
 }
 
+// joinPath appends the request path to the upstream's base path so an
+// upstream like http://svc/v2 keeps its /v2 prefix.
+func joinPath(base, path string) string {
+	if path == "" {
+		return base
+	}
+	base = strings.TrimSuffix(base, "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return base + path
+}
+
 func getUserID(ctx fiber.Ctx) string {
 	if id, ok := ctx.Locals("user_id").(string); ok {
 		return id
@@ -261,8 +527,8 @@ func writeResponse(ctx fiber.Ctx, status int, headers http.Header, body []byte)
 	ctx.Response().Reset()
 	ctx.Response().SetStatusCode(status)
 	for key, values := range headers {
-		if len(values) > 0 {
-			ctx.Response().Header.Set(key, values[0])
+		for _, value := range values {
+			ctx.Response().Header.Add(key, value)
 		}
 	}
 
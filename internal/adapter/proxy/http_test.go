@@ -1,13 +1,17 @@
 package proxy
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"api-gateway/internal/adapter/resilience"
+	"api-gateway/internal/domain/proxy"
 	"api-gateway/internal/middleware"
 
 	"github.com/gofiber/fiber/v3"
@@ -69,6 +73,24 @@ func TestParseURL(t *testing.T) {
 			wantQuery: "page=1",
 			wantErr:   false,
 		},
+		{
+			name:      "upstream base path preserved",
+			upstream:  "http://example.com/v2",
+			path:      "/users",
+			query:     "",
+			wantPath:  "/v2/users",
+			wantQuery: "",
+			wantErr:   false,
+		},
+		{
+			name:      "upstream query merged",
+			upstream:  "http://example.com/v2/?api_key=k",
+			path:      "/users",
+			query:     "page=1",
+			wantPath:  "/v2/users",
+			wantQuery: "api_key=k&page=1",
+			wantErr:   false,
+		},
 		{
 			name:     "invalid upstream",
 			upstream: "://invalid",
@@ -128,7 +150,7 @@ func TestForward_RetryThenSuccess(t *testing.T) {
 	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		current := calls.Add(1)
 		if current == 1 {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusServiceUnavailable)
 			_, _ = w.Write([]byte("temporary"))
 			return
 		}
@@ -153,11 +175,7 @@ func TestForward_RetryThenSuccess(t *testing.T) {
 		Backoff:    1 * time.Millisecond,
 		MaxBackoff: 10 * time.Millisecond,
 	}))
-	app.Get("/proxy", client.Forward(struct {
-		Upstream    string
-		StripPrefix string
-		Headers     map[string]string
-	}{
+	app.Get("/proxy", client.Forward(RouteConfig{
 		Upstream:    upstream.URL,
 		StripPrefix: "",
 	}))
@@ -188,11 +206,7 @@ func TestForward_Timeout(t *testing.T) {
 	})
 
 	app.Use(middleware.Timeout(10 * time.Millisecond))
-	app.Get("/proxy", client.Forward(struct {
-		Upstream    string
-		StripPrefix string
-		Headers     map[string]string
-	}{
+	app.Get("/proxy", client.Forward(RouteConfig{
 		Upstream:    upstream.URL,
 		StripPrefix: "",
 	}))
@@ -204,3 +218,354 @@ func TestForward_Timeout(t *testing.T) {
 }
 
 var _ = io.Discard
+
+func TestForward_RetrySkipsNonIdempotentMethods(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Use(middleware.Retry(middleware.RetryConfig{
+		Attempts: 2,
+		Backoff:  time.Millisecond,
+	}))
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: upstream.URL,
+	}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/proxy", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestForward_RetryWithIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Use(middleware.Retry(middleware.RetryConfig{
+		Attempts:            2,
+		Backoff:             time.Millisecond,
+		AllowIdempotencyKey: true,
+	}))
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: upstream.URL,
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/proxy", nil)
+	req.Header.Set("Idempotency-Key", "abc")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestForward_RetryOnlyListedStatuses(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Use(middleware.Retry(middleware.RetryConfig{
+		Attempts: 3,
+		Backoff:  time.Millisecond,
+		RetryOn:  []string{"503"},
+	}))
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: upstream.URL,
+	}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestForward_RetryPerTryTimeout(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Use(middleware.Retry(middleware.RetryConfig{
+		Attempts:      1,
+		Backoff:       time.Millisecond,
+		PerTryTimeout: 20 * time.Millisecond,
+	}))
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: upstream.URL,
+	}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestForward_HedgeWinsOverSlowPrimary(t *testing.T) {
+	primaryDone := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(primaryDone)
+		select {
+		case <-time.After(2 * time.Second):
+			_, _ = w.Write([]byte("primary"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hedge"))
+	}))
+	defer secondary.Close()
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.Use(middleware.Hedge(middleware.HedgeConfig{
+		Route:   "/proxy",
+		Delay:   20 * time.Millisecond,
+		Targets: []string{secondary.URL},
+	}))
+	app.Get("/proxy", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+	}))
+
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "hedge", string(body))
+	assert.Less(t, time.Since(start), time.Second)
+
+	select {
+	case <-primaryDone:
+	case <-time.After(time.Second):
+		t.Fatal("primary attempt was not cancelled")
+	}
+}
+
+func TestForward_HedgeDelayCountsCancelledPrimaries(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+			_, _ = w.Write([]byte("primary"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hedge"))
+	}))
+	defer secondary.Close()
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	policy := resilience.NewHedgePolicy(resilience.HedgePolicyOptions{
+		Delay:      20 * time.Millisecond,
+		Percentile: 50,
+		Targets:    []string{secondary.URL},
+	})
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("hedge_policy", policy)
+		return c.Next()
+	})
+	app.Get("/proxy", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+	}))
+
+	for i := 0; i < 10; i++ {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "hedge", string(body))
+	}
+
+	// Only the fast hedges completed; the delay must still reflect how long
+	// the primaries were waited for.
+	assert.Eventually(t, func() bool {
+		return policy.HedgeDelay() >= 20*time.Millisecond
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestForward_HedgeSkipsPost(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(30 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app.Use(middleware.Hedge(middleware.HedgeConfig{Delay: time.Millisecond}))
+	app.Post("/proxy", client.Forward(RouteConfig{
+		Upstream: upstream.URL,
+	}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/proxy", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestFetch_PreparesRequestLikeForward(t *testing.T) {
+	var seen *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+		w.Header().Set("Server", "internal/1.0")
+		w.Header().Set("X-Seen-Path", r.URL.Path+"?"+r.URL.RawQuery)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	requestHeaders, err := NewHeaderTransform(HeaderRules{Set: map[string]string{"X-Path": "{{.Path}}"}})
+	assert.NoError(t, err)
+	responseHeaders, err := NewHeaderTransform(HeaderRules{Remove: []string{"Server"}})
+	assert.NoError(t, err)
+	prepare := client.Fetch(RouteConfig{
+		Upstream:         upstream.URL,
+		StripPrefix:      "/api",
+		Headers:          map[string]string{"X-Static": "yes"},
+		RequestHeaders:   requestHeaders,
+		ResponseHeaders:  responseHeaders,
+		StripCredentials: true,
+	})
+
+	// The repeat is prepared during the request and runs after it.
+	var fetch func(context.Context, http.Header) (*proxy.Response, error)
+	app := fiber.New()
+	app.Get("/*", func(c fiber.Ctx) error {
+		fetch = prepare(c)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://gateway.example/api/items?page=2", nil)
+	req.Header.Set("Authorization", "Bearer client")
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("If-None-Match", `"client"`)
+	_, err = app.Test(req)
+	assert.NoError(t, err)
+
+	resp, err := fetch(context.Background(), http.Header{"If-None-Match": {`"stored"`}})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/items?page=2", resp.Header.Get("X-Seen-Path"))
+	assert.Empty(t, resp.Header.Get("Server"))
+
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), seen.Host)
+	assert.Empty(t, seen.Header.Get("Authorization"))
+	assert.Empty(t, seen.Header.Get("X-Hop"))
+	assert.Equal(t, "gateway.example", seen.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "yes", seen.Header.Get("X-Static"))
+	assert.Equal(t, "/api/items", seen.Header.Get("X-Path"))
+	assert.Equal(t, `"stored"`, seen.Header.Get("If-None-Match"))
+}
+
+func TestForward_PrefersPickedUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("picked"))
+	}))
+	defer upstream.Close()
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("upstream", upstream.URL)
+		return c.Next()
+	})
+	app.Get("/", client.Forward(RouteConfig{Upstream: "http://127.0.0.1:1"}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "picked", string(body))
+}
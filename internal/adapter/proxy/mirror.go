@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/domain/proxy"
+)
+
+const (
+	DefaultMirrorTimeout     = 5 * time.Second
+	DefaultMirrorMaxInFlight = 100
+
+	// ShadowHeader marks requests sent to a mirror so the shadow service can
+	// tell them apart, e.g. to skip side effects.
+	ShadowHeader = "X-Shadow-Request"
+)
+
+type MirrorOptions struct {
+	Route    string
+	Upstream string
+	// Percent of requests to mirror, 0-100.
+	Percent     float64
+	Timeout     time.Duration
+	MaxInFlight int
+	// Diffs, when set, receives a record of every shadow response that
+	// differs from the primary one according to Comparison.
+	Diffs      *DiffLog
+	Comparison *Comparison
+	Observer   MirrorObserver
+}
+
+// MirrorObserver is told the outcome of each sampled request: "ok",
+// "error" or "dropped" (too many shadow requests in flight), and, when
+// diffs are recorded, how the shadow response differed from the primary
+// one; no differences means they matched.
+type MirrorObserver interface {
+	Mirrored(outcome string)
+	Compared(method, path string, differences []string)
+}
+
+// Mirror sends copies of sampled requests to a shadow upstream in the
+// background and discards the responses. Shadow calls never delay or fail
+// the client request.
+type Mirror struct {
+	opts  MirrorOptions
+	slots chan struct{}
+}
+
+func NewMirror(opts MirrorOptions) (*Mirror, error) {
+	if _, err := url.Parse(opts.Upstream); err != nil || opts.Upstream == "" {
+		return nil, fmt.Errorf("mirror upstream %q is not a valid URL", opts.Upstream)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultMirrorTimeout
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = DefaultMirrorMaxInFlight
+	}
+
+	return &Mirror{opts: opts, slots: make(chan struct{}, opts.MaxInFlight)}, nil
+}
+
+// start mirrors a request if it is sampled. The returned function takes the
+// primary response once it is known and must always be called.
+func (m *Mirror) start(c *HTTPClient, method, path, query string, header http.Header, body []byte) func(*proxy.Response) {
+	if m == nil || !m.sampled() {
+		return func(*proxy.Response) {}
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		m.observe("dropped")
+		return func(*proxy.Response) {}
+	}
+
+	// The shadow outlives the request, whose strings are reused after it.
+	method, path = strings.Clone(method), strings.Clone(path)
+	header = cloneHeaders(header)
+	header.Set(ShadowHeader, "true")
+	primary := make(chan *proxy.Response, 1)
+
+	go func() {
+		defer func() { <-m.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.opts.Timeout)
+		defer cancel()
+
+		target, err := parseURL(m.opts.Upstream, path, query)
+		if err != nil {
+			m.observe("error")
+			return
+		}
+
+		shadow, err := c.attempt(ctx, nil, method, target.String(), header, body)
+		if err != nil {
+			m.observe("error")
+			return
+		}
+		m.observe("ok")
+
+		if m.opts.Diffs == nil {
+			return
+		}
+
+		select {
+		case resp := <-primary:
+			if resp == nil {
+				return
+			}
+			differences := m.opts.Comparison.Compare(resp, shadow)
+			if m.opts.Observer != nil {
+				m.opts.Observer.Compared(method, path, differences)
+			}
+			if len(differences) > 0 {
+				m.opts.Diffs.Add(ResponseDiff{
+					Time:          time.Now(),
+					Route:         m.opts.Route,
+					Method:        method,
+					Path:          path,
+					PrimaryStatus: resp.StatusCode,
+					ShadowStatus:  shadow.StatusCode,
+					Differences:   differences,
+				})
+			}
+		case <-ctx.Done():
+		}
+	}()
+
+	return func(resp *proxy.Response) {
+		primary <- resp
+	}
+}
+
+func (m *Mirror) sampled() bool {
+	return m.opts.Percent >= 100 || rand.Float64()*100 < m.opts.Percent
+}
+
+func (m *Mirror) observe(outcome string) {
+	if m.opts.Observer != nil {
+		m.opts.Observer.Mirrored(outcome)
+	}
+}
+
+type ResponseDiff struct {
+	Time          time.Time `json:"time"`
+	Route         string    `json:"route"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	PrimaryStatus int       `json:"primary_status"`
+	ShadowStatus  int       `json:"shadow_status"`
+	Differences   []string  `json:"differences"`
+}
+
+// DiffLog keeps the most recent response diffs for review.
+type DiffLog struct {
+	mu      sync.Mutex
+	entries []ResponseDiff
+	next    int
+	full    bool
+}
+
+func NewDiffLog(size int) *DiffLog {
+	if size <= 0 {
+		size = 100
+	}
+	return &DiffLog{entries: make([]ResponseDiff, size)}
+}
+
+func (l *DiffLog) Add(diff ResponseDiff) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = diff
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Entries returns the recorded diffs, newest first.
+func (l *DiffLog) Entries() []ResponseDiff {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+
+	out := make([]ResponseDiff, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return out
+}
@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mirrorRecorder struct {
+	mu       sync.Mutex
+	outcomes []string
+	compared [][]string
+}
+
+func (r *mirrorRecorder) Mirrored(outcome string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outcomes = append(r.outcomes, outcome)
+}
+
+func (r *mirrorRecorder) Compared(method, path string, differences []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compared = append(r.compared, differences)
+}
+
+func (r *mirrorRecorder) snapshot() ([]string, [][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.outcomes...), append([][]string(nil), r.compared...)
+}
+
+func TestMirror_SendsShadowCopy(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	type shadowRequest struct {
+		method, path, query, marker string
+	}
+	received := make(chan shadowRequest, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- shadowRequest{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get(ShadowHeader)}
+		_, _ = w.Write([]byte("shadow"))
+	}))
+	defer shadow.Close()
+
+	recorder := &mirrorRecorder{}
+	mirror, err := NewMirror(MirrorOptions{Route: "/proxy", Upstream: shadow.URL, Percent: 100, Observer: recorder})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+		Mirror:   mirror,
+	}))
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/proxy?a=1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	select {
+	case got := <-received:
+		assert.Equal(t, shadowRequest{http.MethodPost, "/proxy", "a=1", "true"}, got)
+	case <-time.After(time.Second):
+		t.Fatal("shadow request not received")
+	}
+
+	assert.Eventually(t, func() bool {
+		outcomes, _ := recorder.snapshot()
+		return len(outcomes) == 1 && outcomes[0] == "ok"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestMirror_SlowShadowDoesNotDelayClient(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	mirror, err := NewMirror(MirrorOptions{Upstream: shadow.URL, Percent: 100})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+		Mirror:   mirror,
+	}))
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestMirror_ZeroPercentSendsNothing(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer primary.Close()
+
+	recorder := &mirrorRecorder{}
+	mirror, err := NewMirror(MirrorOptions{Upstream: "http://127.0.0.1:1", Percent: 0, Observer: recorder})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+		Mirror:   mirror,
+	}))
+	for range 10 {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+		require.NoError(t, err)
+	}
+
+	outcomes, _ := recorder.snapshot()
+	assert.Empty(t, outcomes)
+}
+
+func TestMirror_DropsWhenFull(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer primary.Close()
+
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	recorder := &mirrorRecorder{}
+	mirror, err := NewMirror(MirrorOptions{Upstream: shadow.URL, Percent: 100, MaxInFlight: 1, Observer: recorder})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+		Mirror:   mirror,
+	}))
+	for range 2 {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+		require.NoError(t, err)
+	}
+
+	outcomes, _ := recorder.snapshot()
+	assert.Equal(t, []string{"dropped"}, outcomes)
+}
+
+func TestMirror_RecordsDiffs(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"v":1}`))
+	}))
+	defer primary.Close()
+
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"v":2}`))
+	}))
+	defer shadow.Close()
+
+	recorder := &mirrorRecorder{}
+	diffs := NewDiffLog(10)
+	mirror, err := NewMirror(MirrorOptions{Route: "/proxy", Upstream: shadow.URL, Percent: 100, Diffs: diffs, Observer: recorder})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.All("/proxy", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+		Mirror:   mirror,
+	}))
+	_, err = app.Test(httptest.NewRequest(http.MethodGet, "/proxy", nil))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(diffs.Entries()) == 1 }, time.Second, 5*time.Millisecond)
+
+	diff := diffs.Entries()[0]
+	assert.Equal(t, "/proxy", diff.Route)
+	assert.Equal(t, http.MethodGet, diff.Method)
+	assert.Equal(t, http.StatusOK, diff.PrimaryStatus)
+	assert.Equal(t, http.StatusCreated, diff.ShadowStatus)
+	assert.Equal(t, []string{"status 200 != 201", "body $.v 1 != 2"}, diff.Differences)
+
+	_, compared := recorder.snapshot()
+	assert.Equal(t, [][]string{diff.Differences}, compared)
+}
+
+func TestMirror_RecordedPathOutlivesRequest(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("shadow"))
+	}))
+	defer shadow.Close()
+
+	diffs := NewDiffLog(10)
+	mirror, err := NewMirror(MirrorOptions{Route: "/*", Upstream: shadow.URL, Percent: 100, Diffs: diffs})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	client := NewHTTPClient(Options{
+		DialTimeout:         1 * time.Second,
+		ReadTimeout:         1 * time.Second,
+		WriteTimeout:        1 * time.Second,
+		IdleConnTimeout:     10 * time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+	})
+	defer client.Close()
+
+	app.All("/*", client.Forward(RouteConfig{
+		Upstream: primary.URL,
+		Mirror:   mirror,
+	}))
+
+	// Later requests reuse the buffers the first one's path pointed into.
+	for i, path := range []string{"/aaaa", "/bbbb"} {
+		_, err = app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return len(diffs.Entries()) == i+1 }, time.Second, 5*time.Millisecond)
+	}
+
+	entries := diffs.Entries()
+	assert.Equal(t, "/bbbb", entries[0].Path)
+	assert.Equal(t, "/aaaa", entries[1].Path)
+}
+
+func TestNewMirror_RequiresUpstream(t *testing.T) {
+	_, err := NewMirror(MirrorOptions{Percent: 100})
+	assert.Error(t, err)
+}
+
+func TestDiffLog_NewestFirst(t *testing.T) {
+	log := NewDiffLog(2)
+	assert.Empty(t, log.Entries())
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		log.Add(ResponseDiff{Path: path})
+	}
+
+	entries := log.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "/c", entries[0].Path)
+	assert.Equal(t, "/b", entries[1].Path)
+}
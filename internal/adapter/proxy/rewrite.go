@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type PathRewriteOptions struct {
+	// PrefixFrom is replaced by PrefixTo when the path starts with it.
+	PrefixFrom string
+	PrefixTo   string
+	// Regex rewrites the path with Replacement, which may use $1 or ${name}.
+	Regex       string
+	Replacement string
+	// Target replaces the whole path; {name} is filled from route params.
+	Target string
+
+	QueryAdd    map[string]string
+	QueryRemove []string
+	QueryRename map[string]string
+}
+
+// PathRewrite maps the client path and query onto the upstream ones. It runs
+// after strip_prefix: Target wins over the prefix and regex rules, which
+// apply in that order.
+type PathRewrite struct {
+	prefixFrom  string
+	prefixTo    string
+	regex       *regexp.Regexp
+	replacement string
+	target      string
+	queryAdd    map[string]string
+	queryRemove []string
+	queryRename [][2]string
+}
+
+var targetParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func NewPathRewrite(opts PathRewriteOptions) (*PathRewrite, error) {
+	r := &PathRewrite{
+		prefixFrom:  opts.PrefixFrom,
+		prefixTo:    opts.PrefixTo,
+		replacement: opts.Replacement,
+		target:      opts.Target,
+		queryAdd:    opts.QueryAdd,
+		queryRemove: opts.QueryRemove,
+	}
+
+	if opts.Regex != "" {
+		re, err := regexp.Compile(opts.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite regex: %w", err)
+		}
+		r.regex = re
+	}
+
+	for _, from := range sortedKeys(opts.QueryRename) {
+		r.queryRename = append(r.queryRename, [2]string{from, opts.QueryRename[from]})
+	}
+
+	return r, nil
+}
+
+func (r *PathRewrite) Path(path string, params map[string]string) string {
+	if r == nil {
+		return path
+	}
+
+	if r.target != "" {
+		return targetParam.ReplaceAllStringFunc(r.target, func(m string) string {
+			return params[m[1:len(m)-1]]
+		})
+	}
+
+	if r.prefixFrom != "" && strings.HasPrefix(path, r.prefixFrom) {
+		path = r.prefixTo + strings.TrimPrefix(path, r.prefixFrom)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	if r.regex != nil {
+		path = r.regex.ReplaceAllString(path, r.replacement)
+	}
+
+	return path
+}
+
+func (r *PathRewrite) Query(raw string) string {
+	if r == nil || (len(r.queryAdd) == 0 && len(r.queryRemove) == 0 && len(r.queryRename) == 0) {
+		return raw
+	}
+
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+
+	for _, name := range r.queryRemove {
+		values.Del(name)
+	}
+	for _, rename := range r.queryRename {
+		if v, ok := values[rename[0]]; ok {
+			values.Del(rename[0])
+			values[rename[1]] = append(values[rename[1]], v...)
+		}
+	}
+	for _, name := range sortedKeys(r.queryAdd) {
+		values.Set(name, r.queryAdd[name])
+	}
+
+	return values.Encode()
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathRewrite_Path(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   PathRewriteOptions
+		path   string
+		params map[string]string
+		want   string
+	}{
+		{
+			name: "prefix replacement",
+			opts: PathRewriteOptions{PrefixFrom: "/api/v1", PrefixTo: "/v2"},
+			path: "/api/v1/orders/9",
+			want: "/v2/orders/9",
+		},
+		{
+			name: "prefix to root",
+			opts: PathRewriteOptions{PrefixFrom: "/legacy", PrefixTo: ""},
+			path: "/legacy/items",
+			want: "/items",
+		},
+		{
+			name: "prefix not matching",
+			opts: PathRewriteOptions{PrefixFrom: "/api/v1", PrefixTo: "/v2"},
+			path: "/other",
+			want: "/other",
+		},
+		{
+			name: "regex captures",
+			opts: PathRewriteOptions{Regex: `^/users/(\d+)/(?P<rest>.*)$`, Replacement: "/accounts/$1/${rest}"},
+			path: "/users/42/profile",
+			want: "/accounts/42/profile",
+		},
+		{
+			name:   "templated target",
+			opts:   PathRewriteOptions{Target: "/v1/accounts/{id}/orders/{order}"},
+			path:   "/users/42/orders/7",
+			params: map[string]string{"id": "42", "order": "7"},
+			want:   "/v1/accounts/42/orders/7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrite, err := NewPathRewrite(tt.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, rewrite.Path(tt.path, tt.params))
+		})
+	}
+
+	var none *PathRewrite
+	assert.Equal(t, "/same", none.Path("/same", nil))
+}
+
+func TestPathRewrite_Query(t *testing.T) {
+	rewrite, err := NewPathRewrite(PathRewriteOptions{
+		QueryAdd:    map[string]string{"source": "gateway"},
+		QueryRemove: []string{"debug"},
+		QueryRename: map[string]string{"q": "search"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "page=2&search=shoes&source=gateway", rewrite.Query("q=shoes&debug=1&page=2"))
+	assert.Equal(t, "source=gateway", rewrite.Query(""))
+}
+
+func TestNewPathRewrite_InvalidRegex(t *testing.T) {
+	_, err := NewPathRewrite(PathRewriteOptions{Regex: "("})
+	assert.Error(t, err)
+}
+
+func TestForward_Rewrite(t *testing.T) {
+	var gotPath, gotQuery string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	rewrite, err := NewPathRewrite(PathRewriteOptions{
+		Target:      "/accounts/{id}",
+		QueryRename: map[string]string{"fields": "select"},
+	})
+	assert.NoError(t, err)
+
+	client := NewHTTPClient(Options{DialTimeout: time.Second, ReadTimeout: time.Second})
+	defer client.Close()
+
+	app := fiber.New()
+	app.Get("/users/:id", client.Forward(RouteConfig{
+		Upstream: upstream.URL + "/v1",
+		Rewrite:  rewrite,
+	}))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/users/42?fields=name", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/v1/accounts/42", gotPath)
+	assert.Equal(t, "select=name", gotQuery)
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type StaticResponseOptions struct {
+	// Status defaults to 200.
+	Status  int
+	Headers map[string]string
+	Body    string
+	// File, when set, is read once and served as the body; its extension
+	// sets the default Content-Type.
+	File string
+}
+
+// StaticResponse answers every request with the same response, without an
+// upstream.
+func StaticResponse(opts StaticResponseOptions) (fiber.Handler, error) {
+	status := opts.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	body := []byte(opts.Body)
+	contentType := fiber.MIMETextPlainCharsetUTF8
+	if opts.File != "" {
+		data, err := os.ReadFile(opts.File)
+		if err != nil {
+			return nil, fmt.Errorf("response file: %w", err)
+		}
+		body = data
+		if byExt := mime.TypeByExtension(filepath.Ext(opts.File)); byExt != "" {
+			contentType = byExt
+		}
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+	for _, name := range sortedKeys(opts.Headers) {
+		header.Set(name, opts.Headers[name])
+	}
+
+	return func(c fiber.Ctx) error {
+		return writeResponse(c, status, header, body)
+	}, nil
+}
+
+type RedirectOptions struct {
+	// To is a text/template rendered against TemplateData.
+	To string
+	// Status is 301, 302, 307 or 308; it defaults to 302.
+	Status int
+	// PreserveQuery appends the request's query string to the target.
+	PreserveQuery bool
+}
+
+func Redirect(opts RedirectOptions) (fiber.Handler, error) {
+	status := opts.Status
+	if status == 0 {
+		status = http.StatusFound
+	}
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("redirect status %d is not one of 301, 302, 307, 308", status)
+	}
+
+	tmpl, err := compileTemplate("redirect", opts.To)
+	if err != nil {
+		return nil, fmt.Errorf("redirect target: %w", err)
+	}
+
+	return func(c fiber.Ctx) error {
+		var target bytes.Buffer
+		if err := tmpl.Execute(&target, templateData(c)); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to render redirect target",
+			})
+		}
+
+		location := target.String()
+		if query := string(c.Request().URI().QueryString()); opts.PreserveQuery && query != "" {
+			sep := "?"
+			if strings.Contains(location, "?") {
+				sep = "&"
+			}
+			location += sep + query
+		}
+
+		c.Set(fiber.HeaderLocation, location)
+		return c.SendStatus(status)
+	}, nil
+}
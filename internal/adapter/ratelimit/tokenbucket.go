@@ -1,6 +1,7 @@
 package ratelimit
 
 import (
+	"container/list"
 	"context"
 	"sync"
 	"time"
@@ -9,28 +10,65 @@ import (
 )
 
 type TokenBucket struct {
-	tokens          map[string]*tokenBucket
+	tokens          map[string]*list.Element
+	lru             *list.List
 	mu              sync.RWMutex
 	rps             int
 	burst           int
 	refillMs        int
 	cleanupInterval time.Duration
 	maxAge          time.Duration
+	maxKeys         int
+	observer        Observer
+	stop            chan struct{}
+	stopOnce        sync.Once
 }
 
 type tokenBucket struct {
+	key        string
 	tokens     float64
 	lastRefill time.Time
 }
 
+// Observer is notified when the number of tracked keys changes. It is called
+// with the bucket lock held and must not call back into the bucket.
+type Observer interface {
+	KeysChanged(n int)
+	KeyEvicted()
+}
+
+type Options struct {
+	RPS             int
+	Burst           int
+	MaxKeys         int
+	CleanupInterval time.Duration
+	MaxAge          time.Duration
+	Observer        Observer
+}
+
 func NewTokenBucket(rps, burst int) *TokenBucket {
+	return NewTokenBucketWithOptions(Options{RPS: rps, Burst: burst})
+}
+
+func NewTokenBucketWithOptions(opts Options) *TokenBucket {
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = 5 * time.Minute
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 10 * time.Minute
+	}
+
 	tb := &TokenBucket{
-		tokens:          make(map[string]*tokenBucket),
-		rps:             rps,
-		burst:           burst,
+		tokens:          make(map[string]*list.Element),
+		lru:             list.New(),
+		rps:             opts.RPS,
+		burst:           opts.Burst,
 		refillMs:        1000,
-		cleanupInterval: 5 * time.Minute,
-		maxAge:          10 * time.Minute,
+		cleanupInterval: opts.CleanupInterval,
+		maxAge:          opts.MaxAge,
+		maxKeys:         opts.MaxKeys,
+		observer:        opts.Observer,
+		stop:            make(chan struct{}),
 	}
 
 	go tb.cleanup()
@@ -39,14 +77,28 @@ func NewTokenBucket(rps, burst int) *TokenBucket {
 
 func (tb *TokenBucket) cleanup() {
 	ticker := time.NewTicker(tb.cleanupInterval)
-	for range ticker.C {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tb.stop:
+			return
+		case <-ticker.C:
+		}
+
 		tb.mu.Lock()
 		now := time.Now()
-		for key, bucket := range tb.tokens {
-			if now.Sub(bucket.lastRefill) > tb.maxAge {
-				delete(tb.tokens, key)
+		for elem := tb.lru.Back(); elem != nil; {
+			bucket := elem.Value.(*tokenBucket)
+			if now.Sub(bucket.lastRefill) <= tb.maxAge {
+				break
 			}
+			prev := elem.Prev()
+			tb.lru.Remove(elem)
+			delete(tb.tokens, bucket.key)
+			elem = prev
 		}
+		tb.notifyKeys()
 		tb.mu.Unlock()
 	}
 }
@@ -56,19 +108,26 @@ func (tb *TokenBucket) Allow(ctx context.Context, key string) (bool, error) {
 	defer tb.mu.Unlock()
 
 	now := time.Now()
-	bucket, exists := tb.tokens[key]
+	elem, exists := tb.tokens[key]
 
 	if !exists {
-		tb.tokens[key] = &tokenBucket{
+		if tb.maxKeys > 0 && tb.lru.Len() >= tb.maxKeys {
+			tb.evictOldest()
+		}
+		tb.tokens[key] = tb.lru.PushFront(&tokenBucket{
+			key:        key,
 			tokens:     float64(tb.burst - 1),
 			lastRefill: now,
-		}
+		})
+		tb.notifyKeys()
 		return true, nil
 	}
 
-	elapsed := now.Sub(bucket.lastRefill).Milliseconds()
-	refill := int64(elapsed) * int64(tb.rps) / 1000
-	bucket.tokens += float64(refill)
+	tb.lru.MoveToFront(elem)
+	bucket := elem.Value.(*tokenBucket)
+
+	elapsed := now.Sub(bucket.lastRefill)
+	bucket.tokens += elapsed.Seconds() * float64(tb.rps) * 1000 / float64(tb.refillMs)
 	if bucket.tokens > float64(tb.burst) {
 		bucket.tokens = float64(tb.burst)
 	}
@@ -82,6 +141,75 @@ func (tb *TokenBucket) Allow(ctx context.Context, key string) (bool, error) {
 	return false, nil
 }
 
+func (tb *TokenBucket) evictOldest() {
+	oldest := tb.lru.Back()
+	if oldest == nil {
+		return
+	}
+	tb.lru.Remove(oldest)
+	delete(tb.tokens, oldest.Value.(*tokenBucket).key)
+	if tb.observer != nil {
+		tb.observer.KeyEvicted()
+	}
+}
+
+func (tb *TokenBucket) notifyKeys() {
+	if tb.observer != nil {
+		tb.observer.KeysChanged(tb.lru.Len())
+	}
+}
+
+// SetLimits changes the rate and burst in place. Existing keys keep their
+// remaining tokens, capped at the new burst.
+func (tb *TokenBucket) SetLimits(rps, burst int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.rps = rps
+	tb.burst = burst
+	for _, elem := range tb.tokens {
+		bucket := elem.Value.(*tokenBucket)
+		if bucket.tokens > float64(burst) {
+			bucket.tokens = float64(burst)
+		}
+	}
+}
+
+func (tb *TokenBucket) SetMaxKeys(maxKeys int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.maxKeys = maxKeys
+	for maxKeys > 0 && tb.lru.Len() > maxKeys {
+		tb.evictOldest()
+	}
+	tb.notifyKeys()
+}
+
+func (tb *TokenBucket) Limits() (rps, burst int) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.rps, tb.burst
+}
+
+func (tb *TokenBucket) MaxKeys() int {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.maxKeys
+}
+
+func (tb *TokenBucket) Len() int {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return tb.lru.Len()
+}
+
+func (tb *TokenBucket) Close() {
+	tb.stopOnce.Do(func() {
+		close(tb.stop)
+	})
+}
+
 func NewRateLimiter(rps, burst int) ratelimit.RateLimiter {
 	return NewTokenBucket(rps, burst)
 }
@@ -72,3 +72,43 @@ func TestTokenBucket_Refill(t *testing.T) {
 		t.Error("expected request to be allowed after refill")
 	}
 }
+
+func TestTokenBucket_MaxKeysEvictsLeastRecentlyUsed(t *testing.T) {
+	limiter := NewTokenBucketWithOptions(Options{RPS: 1, Burst: 1, MaxKeys: 2})
+	defer limiter.Close()
+
+	ctx := context.Background()
+	limiter.Allow(ctx, "a")
+	limiter.Allow(ctx, "b")
+	limiter.Allow(ctx, "a")
+	limiter.Allow(ctx, "c")
+
+	if n := limiter.Len(); n != 2 {
+		t.Fatalf("expected 2 tracked keys, got %d", n)
+	}
+
+	if allowed, _ := limiter.Allow(ctx, "a"); allowed {
+		t.Error("expected recently used key to keep its exhausted bucket")
+	}
+	if allowed, _ := limiter.Allow(ctx, "b"); !allowed {
+		t.Error("expected evicted key to start with a fresh bucket")
+	}
+}
+
+func TestTokenBucket_SetLimitsPreservesCounters(t *testing.T) {
+	limiter := NewTokenBucket(1, 2)
+	defer limiter.Close()
+
+	ctx := context.Background()
+	limiter.Allow(ctx, "test-key")
+	limiter.Allow(ctx, "test-key")
+
+	limiter.SetLimits(1, 10)
+
+	if allowed, _ := limiter.Allow(ctx, "test-key"); allowed {
+		t.Error("expected exhausted key to stay limited after reconfiguration")
+	}
+	if rps, burst := limiter.Limits(); rps != 1 || burst != 10 {
+		t.Errorf("unexpected limits %d/%d", rps, burst)
+	}
+}
@@ -0,0 +1,112 @@
+package resilience
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/domain"
+)
+
+var ErrAdmissionRejected = domain.ErrServiceUnavailable.With(errors.New("gateway overloaded"))
+
+type AdmissionOptions struct {
+	MaxInFlight    int
+	CPUThreshold   float64
+	SampleInterval time.Duration
+}
+
+// AdmissionController tracks gateway-wide load as the higher of in-flight
+// saturation and process CPU saturation, both expressed as a 0..1+ ratio.
+type AdmissionController struct {
+	inFlight     atomic.Int64
+	maxInFlight  int64
+	cpuThreshold float64
+	cpuLoad      atomic.Uint64
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+func NewAdmissionController(opts AdmissionOptions) *AdmissionController {
+	if opts.SampleInterval <= 0 {
+		opts.SampleInterval = time.Second
+	}
+
+	ac := &AdmissionController{
+		maxInFlight:  int64(opts.MaxInFlight),
+		cpuThreshold: opts.CPUThreshold,
+		stop:         make(chan struct{}),
+	}
+
+	if ac.cpuThreshold > 0 {
+		go ac.sampleCPU(opts.SampleInterval)
+	}
+
+	return ac
+}
+
+// Acquire admits a request when the current load is below shedAt. A shedAt of
+// zero or less marks traffic that is never shed.
+func (ac *AdmissionController) Acquire(shedAt float64) (func(), error) {
+	if shedAt > 0 && ac.Load() >= shedAt {
+		return nil, ErrAdmissionRejected
+	}
+
+	ac.inFlight.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ac.inFlight.Add(-1)
+		})
+	}, nil
+}
+
+func (ac *AdmissionController) Load() float64 {
+	var load float64
+	if ac.maxInFlight > 0 {
+		load = float64(ac.inFlight.Load()) / float64(ac.maxInFlight)
+	}
+
+	if ac.cpuThreshold > 0 {
+		cpu := math.Float64frombits(ac.cpuLoad.Load()) / ac.cpuThreshold
+		load = math.Max(load, cpu)
+	}
+
+	return load
+}
+
+func (ac *AdmissionController) InFlight() int64 {
+	return ac.inFlight.Load()
+}
+
+func (ac *AdmissionController) Close() {
+	ac.stopOnce.Do(func() {
+		close(ac.stop)
+	})
+}
+
+func (ac *AdmissionController) sampleCPU(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastCPU := processCPUTime()
+	lastWall := time.Now()
+
+	for {
+		select {
+		case <-ac.stop:
+			return
+		case now := <-ticker.C:
+			cpu := processCPUTime()
+			wall := now.Sub(lastWall) * time.Duration(runtime.GOMAXPROCS(0))
+			if wall > 0 && cpu > 0 {
+				ac.cpuLoad.Store(math.Float64bits(float64(cpu-lastCPU) / float64(wall)))
+			}
+			lastCPU = cpu
+			lastWall = now
+		}
+	}
+}
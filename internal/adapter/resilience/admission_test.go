@@ -0,0 +1,52 @@
+package resilience
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/domain"
+)
+
+func TestAdmissionController_ShedsLowPriorityFirst(t *testing.T) {
+	ac := NewAdmissionController(AdmissionOptions{MaxInFlight: 2})
+	defer ac.Close()
+
+	release, err := ac.Acquire(0.5)
+	assert.NoError(t, err)
+	defer release()
+
+	_, err = ac.Acquire(0.5)
+	assert.ErrorIs(t, err, domain.ErrServiceUnavailable)
+
+	critical, err := ac.Acquire(1)
+	assert.NoError(t, err)
+	defer critical()
+
+	_, err = ac.Acquire(1)
+	assert.ErrorIs(t, err, domain.ErrServiceUnavailable)
+}
+
+func TestAdmissionController_NeverShedClass(t *testing.T) {
+	ac := NewAdmissionController(AdmissionOptions{MaxInFlight: 1})
+	defer ac.Close()
+
+	for i := 0; i < 3; i++ {
+		release, err := ac.Acquire(0)
+		assert.NoError(t, err)
+		defer release()
+	}
+	assert.Equal(t, int64(3), ac.InFlight())
+}
+
+func TestAdmissionController_ReleaseIsIdempotent(t *testing.T) {
+	ac := NewAdmissionController(AdmissionOptions{MaxInFlight: 10})
+	defer ac.Close()
+
+	release, err := ac.Acquire(1)
+	assert.NoError(t, err)
+	release()
+	release()
+
+	assert.Equal(t, int64(0), ac.InFlight())
+}
@@ -0,0 +1,107 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"api-gateway/internal/domain/proxy"
+)
+
+const (
+	DefaultCoalesceMaxWaiters = 1000
+	DefaultCoalesceTimeout    = 5 * time.Second
+)
+
+var (
+	ErrTooManyWaiters = errors.New("too many requests waiting on the same upstream call")
+	ErrFlightFailed   = errors.New("coalesced upstream call produced no response")
+)
+
+// Coalescer collapses identical concurrent requests into one upstream call.
+// The first caller for a key leads the flight; later callers wait for its
+// response.
+type Coalescer struct {
+	mu         sync.Mutex
+	flights    map[string]*Flight
+	maxWaiters int
+	timeout    time.Duration
+}
+
+type Flight struct {
+	done    chan struct{}
+	resp    *proxy.Response
+	waiters int
+}
+
+// NewCoalescer bounds waiters per flight and how long they wait; zero values
+// take the defaults.
+func NewCoalescer(maxWaiters int, timeout time.Duration) *Coalescer {
+	if maxWaiters <= 0 {
+		maxWaiters = DefaultCoalesceMaxWaiters
+	}
+	if timeout <= 0 {
+		timeout = DefaultCoalesceTimeout
+	}
+	return &Coalescer{
+		flights:    make(map[string]*Flight),
+		maxWaiters: maxWaiters,
+		timeout:    timeout,
+	}
+}
+
+// Join returns the flight for key and whether the caller leads it. A leader
+// must call Complete exactly once.
+func (c *Coalescer) Join(key string) (*Flight, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.flights[key]; ok {
+		if f.waiters >= c.maxWaiters {
+			return nil, false, ErrTooManyWaiters
+		}
+		f.waiters++
+		return f, false, nil
+	}
+
+	f := &Flight{done: make(chan struct{})}
+	c.flights[key] = f
+	return f, true, nil
+}
+
+// Complete publishes the leader's response to the waiters. A nil response
+// tells them to fall back to their own upstream call.
+func (c *Coalescer) Complete(key string, f *Flight, resp *proxy.Response) {
+	c.mu.Lock()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	c.mu.Unlock()
+
+	f.resp = resp
+	close(f.done)
+}
+
+// Wait blocks until the flight completes, the coalescer timeout passes or ctx
+// is done.
+func (c *Coalescer) Wait(ctx context.Context, f *Flight) (*proxy.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	select {
+	case <-f.done:
+		if f.resp == nil {
+			return nil, ErrFlightFailed
+		}
+		return f.resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Coalescer) InFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.flights)
+}
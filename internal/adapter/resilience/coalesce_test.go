@@ -0,0 +1,64 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/domain/proxy"
+)
+
+func TestCoalescer_SharesLeaderResponse(t *testing.T) {
+	c := NewCoalescer(0, time.Second)
+
+	leaderFlight, leader, err := c.Join("GET /a")
+	assert.NoError(t, err)
+	assert.True(t, leader)
+
+	waiterFlight, leader, err := c.Join("GET /a")
+	assert.NoError(t, err)
+	assert.False(t, leader)
+	assert.Same(t, leaderFlight, waiterFlight)
+
+	go c.Complete("GET /a", leaderFlight, &proxy.Response{StatusCode: 200, Body: []byte("ok")})
+
+	resp, err := c.Wait(context.Background(), waiterFlight)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(resp.Body))
+	assert.Equal(t, 0, c.InFlight())
+
+	_, leader, _ = c.Join("GET /a")
+	assert.True(t, leader)
+}
+
+func TestCoalescer_MaxWaiters(t *testing.T) {
+	c := NewCoalescer(1, time.Second)
+
+	_, _, _ = c.Join("k")
+	_, _, err := c.Join("k")
+	assert.NoError(t, err)
+	_, _, err = c.Join("k")
+	assert.ErrorIs(t, err, ErrTooManyWaiters)
+}
+
+func TestCoalescer_WaitTimeoutAndFailure(t *testing.T) {
+	c := NewCoalescer(0, 10*time.Millisecond)
+
+	f, _, _ := c.Join("k")
+	waiter, _, _ := c.Join("k")
+
+	_, err := c.Wait(context.Background(), waiter)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	c.Complete("k", f, nil)
+	_, err = c.Wait(context.Background(), waiter)
+	assert.ErrorIs(t, err, ErrFlightFailed)
+}
+
+func TestCoalescer_Defaults(t *testing.T) {
+	c := NewCoalescer(0, 0)
+	assert.Equal(t, DefaultCoalesceMaxWaiters, c.maxWaiters)
+	assert.Equal(t, DefaultCoalesceTimeout, c.timeout)
+}
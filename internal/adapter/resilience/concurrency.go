@@ -0,0 +1,236 @@
+package resilience
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/domain/resilience"
+)
+
+const (
+	LimitAlgorithmFixed    = "fixed"
+	LimitAlgorithmAIMD     = "aimd"
+	LimitAlgorithmGradient = "gradient"
+)
+
+// DefaultQueueTimeout bounds the wait of a queued request when the options
+// do not, so a queue never holds requests indefinitely.
+const DefaultQueueTimeout = time.Second
+
+var (
+	ErrConcurrencyLimited = domain.ErrServiceUnavailable.With(errors.New("concurrency limit reached"))
+	ErrQueueTimeout       = domain.ErrServiceUnavailable.With(errors.New("timed out waiting for concurrency slot"))
+)
+
+type ConcurrencyOptions struct {
+	Limit            int
+	MinLimit         int
+	MaxLimit         int
+	MaxQueue         int
+	QueueTimeout     time.Duration
+	Algorithm        string
+	LatencyThreshold time.Duration
+	BackoffRatio     float64
+	Smoothing        float64
+}
+
+type ConcurrencyStats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+}
+
+type ConcurrencyLimiter struct {
+	mu               sync.Mutex
+	limit            float64
+	minLimit         float64
+	maxLimit         float64
+	inFlight         int
+	waiters          *list.List
+	maxQueue         int
+	queueTimeout     time.Duration
+	algorithm        string
+	latencyThreshold time.Duration
+	backoffRatio     float64
+	smoothing        float64
+	longRTT          float64
+}
+
+func NewConcurrencyLimiter(opts ConcurrencyOptions) *ConcurrencyLimiter {
+	if opts.Limit <= 0 {
+		opts.Limit = 100
+	}
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = opts.Limit * 10
+	}
+	if opts.MaxLimit < opts.Limit {
+		opts.MaxLimit = opts.Limit
+	}
+	if opts.BackoffRatio <= 0 || opts.BackoffRatio >= 1 {
+		opts.BackoffRatio = 0.9
+	}
+	if opts.Smoothing <= 0 || opts.Smoothing > 1 {
+		opts.Smoothing = 0.2
+	}
+	if opts.Algorithm == "" {
+		opts.Algorithm = LimitAlgorithmFixed
+	}
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = DefaultQueueTimeout
+	}
+
+	return &ConcurrencyLimiter{
+		limit:            float64(opts.Limit),
+		minLimit:         float64(opts.MinLimit),
+		maxLimit:         float64(opts.MaxLimit),
+		waiters:          list.New(),
+		maxQueue:         opts.MaxQueue,
+		queueTimeout:     opts.QueueTimeout,
+		algorithm:        opts.Algorithm,
+		latencyThreshold: opts.LatencyThreshold,
+		backoffRatio:     opts.BackoffRatio,
+		smoothing:        opts.Smoothing,
+	}
+}
+
+// Acquire reserves an in-flight slot, waiting in the bounded queue when the
+// limit is reached. The returned release func must be called exactly once;
+// dropped reports that the upstream showed signs of overload.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) (func(dropped bool), error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && l.waiters.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.releaser(time.Now()), nil
+	}
+
+	if l.waiters.Len() >= l.maxQueue {
+		l.mu.Unlock()
+		return nil, ErrConcurrencyLimited
+	}
+
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		return l.releaser(time.Now()), nil
+	case <-timeout:
+		if l.abandon(elem, ready) {
+			return l.releaser(time.Now()), nil
+		}
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		if l.abandon(elem, ready) {
+			return l.releaser(time.Now()), nil
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// abandon removes a waiter from the queue. It reports true when the slot was
+// handed over concurrently, in which case the caller owns it.
+func (l *ConcurrencyLimiter) abandon(elem *list.Element, ready chan struct{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return true
+	default:
+	}
+
+	l.waiters.Remove(elem)
+	return false
+}
+
+func (l *ConcurrencyLimiter) releaser(start time.Time) func(dropped bool) {
+	var once sync.Once
+	return func(dropped bool) {
+		once.Do(func() {
+			l.release(time.Since(start), dropped)
+		})
+	}
+}
+
+func (l *ConcurrencyLimiter) release(rtt time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.adjust(rtt, dropped)
+	l.inFlight--
+
+	for l.waiters.Len() > 0 && l.inFlight < int(l.limit) {
+		front := l.waiters.Front()
+		l.waiters.Remove(front)
+		l.inFlight++
+		close(front.Value.(chan struct{}))
+	}
+}
+
+func (l *ConcurrencyLimiter) adjust(rtt time.Duration, dropped bool) {
+	switch l.algorithm {
+	case LimitAlgorithmAIMD:
+		if dropped || (l.latencyThreshold > 0 && rtt > l.latencyThreshold) {
+			l.limit = l.limit * l.backoffRatio
+		} else if float64(l.inFlight)*2 >= l.limit {
+			l.limit++
+		}
+	case LimitAlgorithmGradient:
+		sample := float64(rtt)
+		if sample <= 0 {
+			return
+		}
+		if l.longRTT == 0 {
+			l.longRTT = sample
+		}
+		l.longRTT = l.longRTT*0.95 + sample*0.05
+
+		if dropped {
+			l.limit = l.limit * l.backoffRatio
+			break
+		}
+
+		gradient := math.Max(0.5, math.Min(1.0, l.longRTT/sample))
+		queueSize := math.Sqrt(l.limit)
+		newLimit := l.limit*gradient + queueSize
+		l.limit = l.limit*(1-l.smoothing) + newLimit*l.smoothing
+	default:
+		return
+	}
+
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.limit))
+}
+
+func (l *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return ConcurrencyStats{
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		Queued:   l.waiters.Len(),
+	}
+}
+
+var _ resilience.ConcurrencyLimiter = (*ConcurrencyLimiter)(nil)
@@ -0,0 +1,95 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/domain"
+)
+
+func TestConcurrencyLimiter_RejectsWhenFull(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{Limit: 1})
+
+	release, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	_, err = l.Acquire(context.Background())
+	assert.ErrorIs(t, err, domain.ErrServiceUnavailable)
+
+	release(false)
+
+	release, err = l.Acquire(context.Background())
+	assert.NoError(t, err)
+	release(false)
+}
+
+func TestConcurrencyLimiter_QueueHandsOverSlot(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{Limit: 1, MaxQueue: 1, QueueTimeout: time.Second})
+
+	release, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		r, err := l.Acquire(context.Background())
+		if r != nil {
+			r(false)
+		}
+		done <- err
+	}()
+
+	assert.Eventually(t, func() bool { return l.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	release(false)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 0, l.Stats().InFlight)
+}
+
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{Limit: 1, MaxQueue: 1, QueueTimeout: 5 * time.Millisecond})
+
+	release, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer release(false)
+
+	_, err = l.Acquire(context.Background())
+	assert.Equal(t, ErrQueueTimeout, err)
+	assert.Equal(t, 0, l.Stats().Queued)
+}
+
+func TestConcurrencyLimiter_DefaultQueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{Limit: 1, MaxQueue: 1})
+
+	release, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer release(false)
+
+	start := time.Now()
+	_, err = l.Acquire(context.Background())
+	assert.Equal(t, ErrQueueTimeout, err)
+	assert.GreaterOrEqual(t, time.Since(start), DefaultQueueTimeout)
+}
+
+func TestConcurrencyLimiter_AIMDBacksOffOnDrop(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{Limit: 10, Algorithm: LimitAlgorithmAIMD})
+
+	release, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+	release(true)
+
+	assert.Equal(t, 9, l.Stats().Limit)
+}
+
+func TestConcurrencyLimiter_GradientShrinksOnLatency(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{Limit: 50, Algorithm: LimitAlgorithmGradient})
+	l.longRTT = float64(time.Millisecond)
+
+	l.mu.Lock()
+	l.inFlight++
+	l.mu.Unlock()
+	l.release(100*time.Millisecond, false)
+
+	assert.Less(t, l.Stats().Limit, 50)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package resilience
+
+import "time"
+
+// processCPUTime is not implemented on this platform, which disables the CPU
+// overload signal.
+func processCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,55 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+const (
+	ErrorKindTimeout = "timeout"
+	ErrorKindConnect = "connect-failure"
+	ErrorKindReset   = "reset"
+	ErrorKindOther   = "other"
+)
+
+// ClassifyError maps an upstream transport error onto the kinds policies can
+// refer to. It returns an empty string for a nil error.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorKindTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return ErrorKindReset
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorKindConnect
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		if opErr.Timeout() {
+			return ErrorKindTimeout
+		}
+		return ErrorKindConnect
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorKindConnect
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorKindTimeout
+	}
+
+	return ErrorKindOther
+}
@@ -0,0 +1,149 @@
+package resilience
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultLatencySamples = 512
+
+// HedgeObserver is notified when a hedge is sent and when an attempt wins.
+type HedgeObserver interface {
+	Hedged()
+	Won(hedge bool)
+}
+
+type HedgePolicyOptions struct {
+	Delay      time.Duration
+	Percentile float64
+	MinDelay   time.Duration
+	MaxHedges  int
+	Targets    []string
+	Methods    []string
+	Observer   HedgeObserver
+}
+
+// HedgePolicy decides when a slow attempt is raced by another one. With a
+// percentile set the delay follows observed latency, falling back to Delay
+// until enough samples exist.
+type HedgePolicy struct {
+	Delay      time.Duration
+	Percentile float64
+	MinDelay   time.Duration
+	MaxHedges  int
+	Targets    []string
+	Observer   HedgeObserver
+	latency    *LatencyTracker
+	methods    map[string]struct{}
+}
+
+func NewHedgePolicy(opts HedgePolicyOptions) *HedgePolicy {
+	if opts.MaxHedges <= 0 {
+		opts.MaxHedges = 1
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodGet, http.MethodHead}
+	}
+
+	p := &HedgePolicy{
+		Delay:      opts.Delay,
+		Percentile: opts.Percentile,
+		MinDelay:   opts.MinDelay,
+		MaxHedges:  opts.MaxHedges,
+		Targets:    opts.Targets,
+		Observer:   opts.Observer,
+		latency:    NewLatencyTracker(defaultLatencySamples),
+		methods:    make(map[string]struct{}, len(opts.Methods)),
+	}
+
+	for _, method := range opts.Methods {
+		p.methods[strings.ToUpper(method)] = struct{}{}
+	}
+
+	return p
+}
+
+func (p *HedgePolicy) AllowsMethod(method string) bool {
+	_, ok := p.methods[strings.ToUpper(method)]
+	return ok
+}
+
+// HedgeDelay returns how long to wait for an outstanding attempt before
+// sending the next hedge.
+func (p *HedgePolicy) HedgeDelay() time.Duration {
+	delay := p.Delay
+	if p.Percentile > 0 {
+		if observed, ok := p.latency.Percentile(p.Percentile); ok {
+			delay = observed
+		}
+	}
+	if delay < p.MinDelay {
+		delay = p.MinDelay
+	}
+	return delay
+}
+
+// Target picks the upstream for the given attempt (0 is the primary),
+// rotating through the hedge targets and falling back to the primary.
+func (p *HedgePolicy) Target(primary string, attempt int) string {
+	if attempt == 0 || len(p.Targets) == 0 {
+		return primary
+	}
+	return p.Targets[(attempt-1)%len(p.Targets)]
+}
+
+func (p *HedgePolicy) Observe(d time.Duration) {
+	p.latency.Observe(d)
+}
+
+// LatencyTracker keeps a fixed-size window of recent latencies.
+type LatencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func NewLatencyTracker(size int) *LatencyTracker {
+	if size <= 0 {
+		size = defaultLatencySamples
+	}
+	return &LatencyTracker{samples: make([]time.Duration, size)}
+}
+
+func (t *LatencyTracker) Observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % len(t.samples)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// Percentile returns the p-th percentile (0-100) of the recorded samples. It
+// reports false until a minimum number of samples has been seen.
+func (t *LatencyTracker) Percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	n := t.next
+	if t.full {
+		n = len(t.samples)
+	}
+	if n < 10 {
+		t.mu.Unlock()
+		return 0, false
+	}
+	sorted := slices.Clone(t.samples[:n])
+	t.mu.Unlock()
+
+	slices.Sort(sorted)
+	idx := int(float64(n-1) * p / 100)
+	if idx >= n {
+		idx = n - 1
+	}
+	return sorted[idx], true
+}
@@ -0,0 +1,60 @@
+package resilience
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgePolicy_Defaults(t *testing.T) {
+	p := NewHedgePolicy(HedgePolicyOptions{Delay: 50 * time.Millisecond})
+
+	assert.Equal(t, 1, p.MaxHedges)
+	assert.True(t, p.AllowsMethod(http.MethodGet))
+	assert.False(t, p.AllowsMethod(http.MethodPost))
+	assert.Equal(t, 50*time.Millisecond, p.HedgeDelay())
+}
+
+func TestHedgePolicy_Target(t *testing.T) {
+	p := NewHedgePolicy(HedgePolicyOptions{Targets: []string{"http://b", "http://c"}})
+
+	assert.Equal(t, "http://a", p.Target("http://a", 0))
+	assert.Equal(t, "http://b", p.Target("http://a", 1))
+	assert.Equal(t, "http://c", p.Target("http://a", 2))
+	assert.Equal(t, "http://b", p.Target("http://a", 3))
+
+	p = NewHedgePolicy(HedgePolicyOptions{})
+	assert.Equal(t, "http://a", p.Target("http://a", 1))
+}
+
+func TestHedgePolicy_PercentileDelay(t *testing.T) {
+	p := NewHedgePolicy(HedgePolicyOptions{
+		Delay:      time.Second,
+		Percentile: 95,
+		MinDelay:   5 * time.Millisecond,
+	})
+
+	// Not enough samples yet: fixed delay applies.
+	assert.Equal(t, time.Second, p.HedgeDelay())
+
+	for i := 1; i <= 100; i++ {
+		p.Observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 95*time.Millisecond, p.HedgeDelay())
+}
+
+func TestLatencyTracker_Window(t *testing.T) {
+	tracker := NewLatencyTracker(10)
+	for i := 0; i < 10; i++ {
+		tracker.Observe(time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		tracker.Observe(time.Millisecond)
+	}
+
+	p50, ok := tracker.Percentile(50)
+	assert.True(t, ok)
+	assert.Equal(t, time.Millisecond, p50)
+}
@@ -0,0 +1,215 @@
+package resilience
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	// DefaultRetryOn leaves out 500: it usually means the request itself
+	// failed, and retrying it repeats side effects.
+	DefaultRetryOn = []string{ErrorKindConnect, ErrorKindReset, ErrorKindTimeout, "502", "503", "504"}
+
+	idempotentMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete,
+	}
+)
+
+type RetryPolicyOptions struct {
+	Attempts            int
+	Backoff             time.Duration
+	MaxBackoff          time.Duration
+	Jitter              bool
+	PerTryTimeout       time.Duration
+	RetryOn             []string
+	Methods             []string
+	AllowIdempotencyKey bool
+	Budget              *RetryBudget
+}
+
+type RetryPolicy struct {
+	Attempts            int
+	Backoff             time.Duration
+	MaxBackoff          time.Duration
+	Jitter              bool
+	PerTryTimeout       time.Duration
+	AllowIdempotencyKey bool
+	Budget              *RetryBudget
+	methods             map[string]struct{}
+	statuses            map[int]struct{}
+	errorKinds          map[string]struct{}
+	any5xx              bool
+}
+
+func NewRetryPolicy(opts RetryPolicyOptions) *RetryPolicy {
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	if len(opts.RetryOn) == 0 {
+		opts.RetryOn = DefaultRetryOn
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = idempotentMethods
+	}
+
+	p := &RetryPolicy{
+		Attempts:            opts.Attempts,
+		Backoff:             opts.Backoff,
+		MaxBackoff:          opts.MaxBackoff,
+		Jitter:              opts.Jitter,
+		PerTryTimeout:       opts.PerTryTimeout,
+		AllowIdempotencyKey: opts.AllowIdempotencyKey,
+		Budget:              opts.Budget,
+		methods:             make(map[string]struct{}, len(opts.Methods)),
+		statuses:            make(map[int]struct{}),
+		errorKinds:          make(map[string]struct{}),
+	}
+
+	for _, method := range opts.Methods {
+		p.methods[strings.ToUpper(method)] = struct{}{}
+	}
+
+	for _, cond := range opts.RetryOn {
+		cond = strings.ToLower(strings.TrimSpace(cond))
+		if cond == "5xx" {
+			p.any5xx = true
+			continue
+		}
+		if code, err := strconv.Atoi(cond); err == nil {
+			p.statuses[code] = struct{}{}
+			continue
+		}
+		p.errorKinds[cond] = struct{}{}
+	}
+
+	return p
+}
+
+// AllowsMethod reports whether a request may be retried at all. Methods
+// outside the configured set qualify only when they carry an Idempotency-Key
+// and the policy opts in.
+func (p *RetryPolicy) AllowsMethod(method string, header http.Header) bool {
+	if _, ok := p.methods[strings.ToUpper(method)]; ok {
+		return true
+	}
+	return p.AllowIdempotencyKey && header.Get(IdempotencyKeyHeader) != ""
+}
+
+func (p *RetryPolicy) RetryableStatus(status int) bool {
+	if p.any5xx && status >= http.StatusInternalServerError {
+		return true
+	}
+	_, ok := p.statuses[status]
+	return ok
+}
+
+func (p *RetryPolicy) RetryableError(err error) bool {
+	if _, ok := p.errorKinds["any"]; ok {
+		return true
+	}
+	_, ok := p.errorKinds[ClassifyError(err)]
+	return ok
+}
+
+// Delay returns the wait before the given retry (1-based). With jitter the
+// delay is drawn uniformly from [0, cap) ("full jitter").
+func (p *RetryPolicy) Delay(retry int) time.Duration {
+	if p.Backoff <= 0 || retry <= 0 {
+		return 0
+	}
+
+	delay := p.Backoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if p.Jitter {
+		delay = time.Duration(rand.Int64N(int64(delay) + 1))
+	}
+	return delay
+}
+
+// RetryBudget caps retries to a ratio of requests seen over a sliding window,
+// with a floor so low-traffic routes can still retry.
+type RetryBudget struct {
+	mu          sync.Mutex
+	ratio       float64
+	minRetries  int
+	window      time.Duration
+	buckets     []budgetBucket
+	bucketWidth time.Duration
+}
+
+type budgetBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+func NewRetryBudget(ratio float64, minRetriesPerSecond int, window time.Duration) *RetryBudget {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	const buckets = 10
+
+	return &RetryBudget{
+		ratio:       ratio,
+		minRetries:  int(float64(minRetriesPerSecond) * window.Seconds()),
+		window:      window,
+		buckets:     make([]budgetBucket, buckets),
+		bucketWidth: window / buckets,
+	}
+}
+
+func (b *RetryBudget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(time.Now()).requests++
+}
+
+func (b *RetryBudget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var requests, retries int
+	cutoff := now.Add(-b.window)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(cutoff) {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	allowed := int(float64(requests) * b.ratio)
+	if allowed < b.minRetries {
+		allowed = b.minRetries
+	}
+	if retries >= allowed {
+		return false
+	}
+
+	b.bucket(now).retries++
+	return true
+}
+
+func (b *RetryBudget) bucket(now time.Time) *budgetBucket {
+	start := now.Truncate(b.bucketWidth)
+	idx := int(start.UnixNano()/int64(b.bucketWidth)) % len(b.buckets)
+
+	bucket := &b.buckets[idx]
+	if !bucket.start.Equal(start) {
+		*bucket = budgetBucket{start: start}
+	}
+	return bucket
+}
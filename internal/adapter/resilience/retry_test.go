@@ -0,0 +1,82 @@
+package resilience
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_AllowsMethod(t *testing.T) {
+	p := NewRetryPolicy(RetryPolicyOptions{Attempts: 1})
+
+	assert.True(t, p.AllowsMethod(http.MethodGet, http.Header{}))
+	assert.True(t, p.AllowsMethod(http.MethodPut, http.Header{}))
+	assert.False(t, p.AllowsMethod(http.MethodPost, http.Header{}))
+
+	keyed := http.Header{}
+	keyed.Set(IdempotencyKeyHeader, "k1")
+	assert.False(t, p.AllowsMethod(http.MethodPost, keyed))
+
+	p = NewRetryPolicy(RetryPolicyOptions{Attempts: 1, AllowIdempotencyKey: true})
+	assert.True(t, p.AllowsMethod(http.MethodPost, keyed))
+}
+
+func TestRetryPolicy_RetryOn(t *testing.T) {
+	p := NewRetryPolicy(RetryPolicyOptions{Attempts: 1})
+	assert.True(t, p.RetryableStatus(http.StatusBadGateway))
+	assert.True(t, p.RetryableStatus(http.StatusGatewayTimeout))
+	assert.False(t, p.RetryableStatus(http.StatusInternalServerError))
+	assert.False(t, p.RetryableStatus(http.StatusNotFound))
+	assert.True(t, p.RetryableError(context.DeadlineExceeded))
+
+	p = NewRetryPolicy(RetryPolicyOptions{Attempts: 1, RetryOn: []string{"503", "429", ErrorKindConnect}})
+	assert.True(t, p.RetryableStatus(http.StatusServiceUnavailable))
+	assert.True(t, p.RetryableStatus(http.StatusTooManyRequests))
+	assert.False(t, p.RetryableStatus(http.StatusBadGateway))
+	assert.False(t, p.RetryableError(context.DeadlineExceeded))
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := NewRetryPolicy(RetryPolicyOptions{
+		Attempts:   5,
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 30 * time.Millisecond,
+	})
+	assert.Equal(t, 10*time.Millisecond, p.Delay(1))
+	assert.Equal(t, 20*time.Millisecond, p.Delay(2))
+	assert.Equal(t, 30*time.Millisecond, p.Delay(3))
+
+	p.Jitter = true
+	for i := 0; i < 100; i++ {
+		d := p.Delay(3)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, 30*time.Millisecond)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(0.2, 0, time.Second)
+	for i := 0; i < 10; i++ {
+		b.Deposit()
+	}
+
+	assert.True(t, b.Withdraw())
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+}
+
+func TestRetryBudget_MinRetries(t *testing.T) {
+	b := NewRetryBudget(0, 1, time.Second)
+
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	b = NewRetryBudget(0, 10, 500*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.True(t, b.Withdraw())
+	}
+	assert.False(t, b.Withdraw())
+}
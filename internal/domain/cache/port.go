@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type Entry struct {
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	StoredAt     time.Time
+	Expires      time.Time
+	ETag         string
+	LastModified string
+	// How long past Expires the entry may still be served while it is
+	// refreshed in the background, or when the upstream fails.
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	// Vary lists the request headers the stored variants depend on. An entry
+	// with Vary set and no body is an index pointing at per-variant entries.
+	Vary []string
+}
+
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+func (e *Entry) StaleWhileRevalidating(now time.Time) bool {
+	return e.StaleWhileRevalidate > 0 && now.Before(e.Expires.Add(e.StaleWhileRevalidate))
+}
+
+func (e *Entry) StaleOnError(now time.Time) bool {
+	return e.StaleIfError > 0 && now.Before(e.Expires.Add(e.StaleIfError))
+}
+
+func (e *Entry) Size() int64 {
+	size := int64(len(e.Body)) + int64(len(e.ETag)+len(e.LastModified))
+	for key, values := range e.Header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	for _, name := range e.Vary {
+		size += int64(len(name))
+	}
+	return size
+}
+
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, bool)
+	Set(ctx context.Context, key string, entry *Entry)
+	Delete(ctx context.Context, key string)
+	// Purge removes every entry whose key starts with prefix and returns how
+	// many were removed. An empty prefix clears the store.
+	Purge(ctx context.Context, prefix string) int
+}
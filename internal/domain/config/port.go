@@ -2,6 +2,8 @@ package config
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -11,13 +13,87 @@ type Config struct {
 	OTel            OTelConfig             `mapstructure:"otel"`
 	CORS            CORSConfig             `mapstructure:"cors"`
 	GlobalRateLimit *GlobalRateLimitConfig `mapstructure:"global_rate_limit"`
+	Admission       *AdmissionConfig       `mapstructure:"admission"`
+	Cache           *CacheStoreConfig      `mapstructure:"cache"`
+	Maintenance     *MaintenanceConfig     `mapstructure:"maintenance"`
+	RouteStore      *RouteStoreConfig      `mapstructure:"route_store"`
 	Routes          []Route                `mapstructure:"routes"`
 }
 
+// RouteStoreConfig enables route changes through the admin API, persisted
+// to Path. Once the store holds routes they replace the routes of the
+// config file. Changes are appended to AuditLog, by default Path plus
+// ".audit.jsonl".
+type RouteStoreConfig struct {
+	Path     string `mapstructure:"path"`
+	AuditLog string `mapstructure:"audit_log"`
+}
+
+func (s *RouteStoreConfig) AuditPath() string {
+	if s.AuditLog != "" {
+		return s.AuditLog
+	}
+	return s.Path + ".audit.jsonl"
+}
+
+// StoredRoutes is the content of a route store. Version counts the changes
+// made through the admin API.
+type StoredRoutes struct {
+	Version int64   `mapstructure:"version"`
+	Routes  []Route `mapstructure:"routes"`
+}
+
+// Route change actions recorded in the audit log.
+const (
+	RouteCreated = "create"
+	RouteUpdated = "update"
+	RouteDeleted = "delete"
+)
+
+// RouteChange is an audit log entry. Before and After are the route in
+// config file form with secrets redacted.
+type RouteChange struct {
+	Time    time.Time              `json:"time"`
+	Actor   string                 `json:"actor"`
+	Action  string                 `json:"action"`
+	Route   string                 `json:"route"`
+	Version int64                  `json:"version"`
+	Before  map[string]interface{} `json:"before,omitempty"`
+	After   map[string]interface{} `json:"after,omitempty"`
+}
+
 type GlobalRateLimitConfig struct {
-	RPS   int    `mapstructure:"rps"`
-	Burst int    `mapstructure:"burst"`
-	KeyBy string `mapstructure:"key_by"`
+	RPS     int    `mapstructure:"rps"`
+	Burst   int    `mapstructure:"burst"`
+	KeyBy   string `mapstructure:"key_by"`
+	MaxKeys int    `mapstructure:"max_keys"`
+}
+
+type AdmissionConfig struct {
+	MaxInFlight      int             `mapstructure:"max_in_flight"`
+	CPUThreshold     float64         `mapstructure:"cpu_threshold"`
+	SampleIntervalMs int             `mapstructure:"sample_interval_ms"`
+	DefaultClass     string          `mapstructure:"default_class"`
+	Classes          []PriorityClass `mapstructure:"classes"`
+	Rules            []PriorityRule  `mapstructure:"rules"`
+}
+
+func (a AdmissionConfig) SampleInterval() time.Duration {
+	return time.Duration(a.SampleIntervalMs) * time.Millisecond
+}
+
+type PriorityClass struct {
+	Name   string  `mapstructure:"name"`
+	ShedAt float64 `mapstructure:"shed_at"`
+}
+
+type PriorityRule struct {
+	Class       string   `mapstructure:"class"`
+	Routes      []string `mapstructure:"routes"`
+	Header      string   `mapstructure:"header"`
+	HeaderValue string   `mapstructure:"header_value"`
+	Claim       string   `mapstructure:"claim"`
+	ClaimValue  string   `mapstructure:"claim_value"`
 }
 
 type CORSConfig struct {
@@ -35,6 +111,18 @@ type ServerConfig struct {
 	ReadTimeoutMs  int    `mapstructure:"read_timeout_ms"`
 	WriteTimeoutMs int    `mapstructure:"write_timeout_ms"`
 	IdleTimeoutMs  int    `mapstructure:"idle_timeout_ms"`
+	// TrustedProxies are CIDRs or IPs whose X-Forwarded-* headers are kept.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// Admin moves the admin API to its own listener. Without it the API is
+	// served under /admin on the main port to admin JWTs.
+	Admin *AdminConfig `mapstructure:"admin"`
+}
+
+// AdminConfig is the admin API listener, e.g. "127.0.0.1:9090", and the
+// bearer token it requires.
+type AdminConfig struct {
+	Address string `mapstructure:"address"`
+	Token   string `mapstructure:"token"`
 }
 
 func (s ServerConfig) ReadTimeout() time.Duration {
@@ -60,39 +148,466 @@ type OTelConfig struct {
 }
 
 type Route struct {
-	Path         string            `mapstructure:"path"`
-	Upstream     string            `mapstructure:"upstream"`
-	Methods      []string          `mapstructure:"methods"`
-	StripPrefix  string            `mapstructure:"strip_prefix"`
-	AuthRequired bool              `mapstructure:"auth_required"`
-	RateLimit    *RateLimitConfig  `mapstructure:"rate_limit"`
-	TimeoutMs    int               `mapstructure:"timeout_ms"`
-	Retry        *RetryConfig      `mapstructure:"retry"`
-	Headers      map[string]string `mapstructure:"headers"`
+	Path             string                `mapstructure:"path"`
+	Upstream         string                `mapstructure:"upstream"`
+	Methods          []string              `mapstructure:"methods"`
+	StripPrefix      string                `mapstructure:"strip_prefix"`
+	AuthRequired     bool                  `mapstructure:"auth_required"`
+	RateLimit        *RateLimitConfig      `mapstructure:"rate_limit"`
+	TimeoutMs        int                   `mapstructure:"timeout_ms"`
+	Retry            *RetryConfig          `mapstructure:"retry"`
+	Headers          map[string]string     `mapstructure:"headers"`
+	Concurrency      *ConcurrencyConfig    `mapstructure:"concurrency"`
+	CircuitBreaker   *CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	Hedge            *HedgeConfig          `mapstructure:"hedge"`
+	Cache            *CacheConfig          `mapstructure:"cache"`
+	Coalesce         *CoalesceConfig       `mapstructure:"coalesce"`
+	RequestHeaders   *HeaderRules          `mapstructure:"request_headers"`
+	ResponseHeaders  *HeaderRules          `mapstructure:"response_headers"`
+	RequestBody      *BodyRules            `mapstructure:"request_body"`
+	ResponseBody     *BodyRules            `mapstructure:"response_body"`
+	PreserveHost     bool                  `mapstructure:"preserve_host"`
+	StripCredentials bool                  `mapstructure:"strip_credentials"`
+	Cookies          *CookieConfig         `mapstructure:"cookies"`
+	Rewrite          *RewriteConfig        `mapstructure:"rewrite"`
+	Match            *MatchConfig          `mapstructure:"match"`
+	Split            *SplitConfig          `mapstructure:"split"`
+	Mirror           *MirrorConfig         `mapstructure:"mirror"`
+	Compare          *CompareConfig        `mapstructure:"compare"`
+	Composite        *CompositeConfig      `mapstructure:"composite"`
+	Response         *ResponseConfig       `mapstructure:"response"`
+	Redirect         *RedirectConfig       `mapstructure:"redirect"`
+	Maintenance      *MaintenanceConfig    `mapstructure:"maintenance"`
+	Files            *FilesConfig          `mapstructure:"files"`
 }
 
 func (r Route) Timeout() time.Duration {
 	return time.Duration(r.TimeoutMs) * time.Millisecond
 }
 
+// ID identifies the route's limiter, breaker, cache and metric state, e.g.
+// "GET,POST /users". Routes sharing a path are told apart by their methods
+// and match conditions.
+func (r Route) ID() string {
+	methods := r.MethodList()
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ",") + " " + r.MatchID()
+}
+
+// MatchID is the ID without methods: the path and match conditions.
+func (r Route) MatchID() string {
+	if key := r.Match.key(); key != "" {
+		return r.Path + " [" + key + "]"
+	}
+	return r.Path
+}
+
+// Route kinds, by what answers the request.
+const (
+	KindProxy     = "proxy"
+	KindSplit     = "split"
+	KindComposite = "composite"
+	KindResponse  = "response"
+	KindRedirect  = "redirect"
+	KindFiles     = "files"
+)
+
+// Kind is KindProxy unless the route answers itself or splits traffic.
+func (r Route) Kind() string {
+	switch {
+	case r.Composite != nil:
+		return KindComposite
+	case r.Response != nil:
+		return KindResponse
+	case r.Redirect != nil:
+		return KindRedirect
+	case r.Files != nil:
+		return KindFiles
+	case r.Split != nil:
+		return KindSplit
+	}
+	return KindProxy
+}
+
+// Upstreams lists the upstreams the route forwards to, split backends
+// included.
+func (r Route) Upstreams() []string {
+	var upstreams []string
+	switch r.Kind() {
+	case KindProxy:
+		if r.Upstream != "" {
+			upstreams = append(upstreams, r.Upstream)
+		}
+	case KindSplit:
+		for _, backend := range r.Split.Backends {
+			upstreams = append(upstreams, backend.Upstream)
+		}
+	}
+	return upstreams
+}
+
+// MethodAny in a route's methods matches every request method.
+const MethodAny = "ANY"
+
+// MethodList returns the route's methods upper-cased, defaulting to GET.
+func (r Route) MethodList() []string {
+	if len(r.Methods) == 0 {
+		return []string{"GET"}
+	}
+
+	methods := make([]string, len(r.Methods))
+	for i, method := range r.Methods {
+		methods[i] = strings.ToUpper(method)
+	}
+	return methods
+}
+
+// SplitConfig spreads a route's traffic over several upstream versions by
+// weight. Sticky is "user", "cookie" or empty; OverrideHeader (default
+// X-Canary) forces a backend per request.
+type SplitConfig struct {
+	Backends       []BackendConfig `mapstructure:"backends"`
+	Sticky         string          `mapstructure:"sticky"`
+	Cookie         string          `mapstructure:"cookie"`
+	OverrideHeader string          `mapstructure:"override_header"`
+}
+
+type BackendConfig struct {
+	Name     string `mapstructure:"name"`
+	Upstream string `mapstructure:"upstream"`
+	Weight   int    `mapstructure:"weight"`
+	Canary   bool   `mapstructure:"canary"`
+}
+
+// MirrorConfig shadows a sampled share of a route's requests to a second
+// upstream; its responses are discarded.
+type MirrorConfig struct {
+	Upstream    string  `mapstructure:"upstream"`
+	Percent     float64 `mapstructure:"percent"`
+	TimeoutMs   int     `mapstructure:"timeout_ms"`
+	MaxInFlight int     `mapstructure:"max_in_flight"`
+	RecordDiffs bool    `mapstructure:"record_diffs"`
+}
+
+func (m MirrorConfig) Timeout() time.Duration {
+	return time.Duration(m.TimeoutMs) * time.Millisecond
+}
+
+// CompareConfig sends a read-only route's requests to a new backend as
+// well, keeps serving the route's upstream and reports how the responses
+// differ. Percent defaults to 100.
+type CompareConfig struct {
+	Upstream      string   `mapstructure:"upstream"`
+	Percent       float64  `mapstructure:"percent"`
+	TimeoutMs     int      `mapstructure:"timeout_ms"`
+	MaxInFlight   int      `mapstructure:"max_in_flight"`
+	IgnoreHeaders []string `mapstructure:"ignore_headers"`
+	IgnoreFields  []string `mapstructure:"ignore_fields"`
+}
+
+func (c CompareConfig) Timeout() time.Duration {
+	return time.Duration(c.TimeoutMs) * time.Millisecond
+}
+
+// CompositeConfig turns a route into an aggregation of several upstream
+// calls; the route's upstream is not used. Merge maps a source ("<call>" or
+// "<call>.<field>") to a field of the merged document.
+type CompositeConfig struct {
+	Calls          []CompositeCallConfig `mapstructure:"calls"`
+	Merge          []FieldRename         `mapstructure:"merge"`
+	ForwardHeaders []string              `mapstructure:"forward_headers"`
+}
+
+type CompositeCallConfig struct {
+	Name      string   `mapstructure:"name"`
+	Method    string   `mapstructure:"method"`
+	URL       string   `mapstructure:"url"`
+	TimeoutMs int      `mapstructure:"timeout_ms"`
+	DependsOn []string `mapstructure:"depends_on"`
+	Required  bool     `mapstructure:"required"`
+	Fallback  string   `mapstructure:"fallback"`
+}
+
+func (c CompositeCallConfig) Timeout() time.Duration {
+	return time.Duration(c.TimeoutMs) * time.Millisecond
+}
+
+// ResponseConfig makes a route answer with a fixed response instead of
+// proxying. The body comes from Body or, when set, the contents of File.
+type ResponseConfig struct {
+	Status  int               `mapstructure:"status"`
+	Headers map[string]string `mapstructure:"headers"`
+	Body    string            `mapstructure:"body"`
+	File    string            `mapstructure:"file"`
+}
+
+// RedirectConfig makes a route redirect. To is a text/template over the
+// request, e.g. "https://new.example.com/users/{{.Params.id}}".
+type RedirectConfig struct {
+	To            string `mapstructure:"to"`
+	Status        int    `mapstructure:"status"`
+	PreserveQuery bool   `mapstructure:"preserve_query"`
+}
+
+// FilesConfig serves a route from a local directory, after strip_prefix.
+// With SPA, unknown paths without a file extension get the root index.
+type FilesConfig struct {
+	Root          string `mapstructure:"root"`
+	Index         string `mapstructure:"index"`
+	SPA           bool   `mapstructure:"spa"`
+	Precompressed bool   `mapstructure:"precompressed"`
+	MaxAgeMs      int    `mapstructure:"max_age_ms"`
+}
+
+func (f FilesConfig) MaxAge() time.Duration {
+	return time.Duration(f.MaxAgeMs) * time.Millisecond
+}
+
+// MaintenanceConfig answers 503 while enabled, except to AllowIPs (IPs or
+// CIDRs). A route without its own block inherits the global settings.
+type MaintenanceConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	RetryAfterMs int      `mapstructure:"retry_after_ms"`
+	Body         string   `mapstructure:"body"`
+	ContentType  string   `mapstructure:"content_type"`
+	AllowIPs     []string `mapstructure:"allow_ips"`
+}
+
+func (m MaintenanceConfig) RetryAfter() time.Duration {
+	return time.Duration(m.RetryAfterMs) * time.Millisecond
+}
+
+// MatchConfig narrows a route beyond path and method; every condition must
+// hold. Hosts may start with "*." to match any subdomain.
+type MatchConfig struct {
+	Hosts   []string    `mapstructure:"hosts"`
+	Headers []MatchRule `mapstructure:"headers"`
+	Query   []MatchRule `mapstructure:"query"`
+	Cookies []MatchRule `mapstructure:"cookies"`
+}
+
+// MatchRule requires Name to be present and, when given, equal to Value or
+// match Regex.
+type MatchRule struct {
+	Name  string `mapstructure:"name"`
+	Value string `mapstructure:"value"`
+	Regex string `mapstructure:"regex"`
+}
+
 type RateLimitConfig struct {
-	RPS   int    `mapstructure:"rps"`
-	Burst int    `mapstructure:"burst"`
-	KeyBy string `mapstructure:"key_by"`
+	RPS     int    `mapstructure:"rps"`
+	Burst   int    `mapstructure:"burst"`
+	KeyBy   string `mapstructure:"key_by"`
+	MaxKeys int    `mapstructure:"max_keys"`
+}
+
+type ConcurrencyConfig struct {
+	MaxConcurrent      int    `mapstructure:"max_concurrent"`
+	MaxQueue           int    `mapstructure:"max_queue"`
+	QueueTimeoutMs     int    `mapstructure:"queue_timeout_ms"`
+	Scope              string `mapstructure:"scope"`
+	Adaptive           string `mapstructure:"adaptive"`
+	MinLimit           int    `mapstructure:"min_limit"`
+	MaxLimit           int    `mapstructure:"max_limit"`
+	LatencyThresholdMs int    `mapstructure:"latency_threshold_ms"`
+}
+
+func (c ConcurrencyConfig) QueueTimeout() time.Duration {
+	return time.Duration(c.QueueTimeoutMs) * time.Millisecond
+}
+
+func (c ConcurrencyConfig) LatencyThreshold() time.Duration {
+	return time.Duration(c.LatencyThresholdMs) * time.Millisecond
+}
+
+type CircuitBreakerConfig struct {
+	FailureRateThreshold float64  `mapstructure:"failure_rate_threshold"`
+	ConsecutiveFailures  int      `mapstructure:"consecutive_failures"`
+	WindowMs             int      `mapstructure:"window_ms"`
+	MinRequests          int      `mapstructure:"min_requests"`
+	OpenDurationMs       int      `mapstructure:"open_duration_ms"`
+	HalfOpenRequests     int      `mapstructure:"half_open_requests"`
+	FailureStatusCodes   []int    `mapstructure:"failure_status_codes"`
+	FailureErrors        []string `mapstructure:"failure_errors"`
+}
+
+func (c CircuitBreakerConfig) Window() time.Duration {
+	return time.Duration(c.WindowMs) * time.Millisecond
+}
+
+func (c CircuitBreakerConfig) OpenDuration() time.Duration {
+	return time.Duration(c.OpenDurationMs) * time.Millisecond
 }
 
 type RetryConfig struct {
-	Attempts  int `mapstructure:"attempts"`
-	BackoffMs int `mapstructure:"backoff_ms"`
+	Attempts            int                `mapstructure:"attempts"`
+	BackoffMs           int                `mapstructure:"backoff_ms"`
+	MaxBackoffMs        int                `mapstructure:"max_backoff_ms"`
+	Jitter              *bool              `mapstructure:"jitter"`
+	PerTryTimeoutMs     int                `mapstructure:"per_try_timeout_ms"`
+	RetryOn             []string           `mapstructure:"retry_on"`
+	Methods             []string           `mapstructure:"methods"`
+	AllowIdempotencyKey bool               `mapstructure:"allow_idempotency_key"`
+	Budget              *RetryBudgetConfig `mapstructure:"budget"`
+}
+
+// RetryBudgetConfig caps retries to a percentage of the route's traffic.
+type RetryBudgetConfig struct {
+	RatioPercent        float64 `mapstructure:"ratio_percent"`
+	MinRetriesPerSecond int     `mapstructure:"min_retries_per_second"`
+	WindowMs            int     `mapstructure:"window_ms"`
 }
 
 func (r RetryConfig) Backoff() time.Duration {
 	return time.Duration(r.BackoffMs) * time.Millisecond
 }
 
+func (r RetryConfig) MaxBackoff() time.Duration {
+	return time.Duration(r.MaxBackoffMs) * time.Millisecond
+}
+
+func (r RetryConfig) PerTryTimeout() time.Duration {
+	return time.Duration(r.PerTryTimeoutMs) * time.Millisecond
+}
+
+// JitterEnabled defaults to true when jitter is not configured.
+func (r RetryConfig) JitterEnabled() bool {
+	return r.Jitter == nil || *r.Jitter
+}
+
+func (b RetryBudgetConfig) Window() time.Duration {
+	return time.Duration(b.WindowMs) * time.Millisecond
+}
+
+// HedgeConfig races slow upstream attempts. Delay is fixed unless Percentile
+// is set, in which case DelayMs is only used until enough latency samples exist.
+type HedgeConfig struct {
+	DelayMs    int      `mapstructure:"delay_ms"`
+	Percentile float64  `mapstructure:"percentile"`
+	MinDelayMs int      `mapstructure:"min_delay_ms"`
+	MaxHedges  int      `mapstructure:"max_hedges"`
+	Targets    []string `mapstructure:"targets"`
+	Methods    []string `mapstructure:"methods"`
+}
+
+func (h HedgeConfig) Delay() time.Duration {
+	return time.Duration(h.DelayMs) * time.Millisecond
+}
+
+func (h HedgeConfig) MinDelay() time.Duration {
+	return time.Duration(h.MinDelayMs) * time.Millisecond
+}
+
+// CacheStoreConfig sizes the response cache shared by all routes.
+type CacheStoreConfig struct {
+	MaxBytes int64 `mapstructure:"max_bytes"`
+}
+
+type CacheConfig struct {
+	TTLMs                  int      `mapstructure:"ttl_ms"`
+	StaleWhileRevalidateMs int      `mapstructure:"stale_while_revalidate_ms"`
+	StaleIfErrorMs         int      `mapstructure:"stale_if_error_ms"`
+	KeyClaims              []string `mapstructure:"key_claims"`
+	KeyHeaders             []string `mapstructure:"key_headers"`
+}
+
+func (c CacheConfig) TTL() time.Duration {
+	return time.Duration(c.TTLMs) * time.Millisecond
+}
+
+func (c CacheConfig) StaleWhileRevalidate() time.Duration {
+	return time.Duration(c.StaleWhileRevalidateMs) * time.Millisecond
+}
+
+func (c CacheConfig) StaleIfError() time.Duration {
+	return time.Duration(c.StaleIfErrorMs) * time.Millisecond
+}
+
+// CoalesceConfig collapses identical concurrent GET/HEAD requests into one
+// upstream call.
+type CoalesceConfig struct {
+	MaxWaiters int      `mapstructure:"max_waiters"`
+	TimeoutMs  int      `mapstructure:"timeout_ms"`
+	KeyHeaders []string `mapstructure:"key_headers"`
+}
+
+func (c CoalesceConfig) Timeout() time.Duration {
+	return time.Duration(c.TimeoutMs) * time.Millisecond
+}
+
+// HeaderRules are applied in the order remove, rename, set, add. Set and add
+// values are Go templates over .RequestID, .ClientIP, .UserID, .Method, .Path,
+// .Params and .Claims.
+type HeaderRules struct {
+	Add    map[string]string `mapstructure:"add"`
+	Set    map[string]string `mapstructure:"set"`
+	Remove []string          `mapstructure:"remove"`
+	Rename map[string]string `mapstructure:"rename"`
+}
+
+// CookieConfig rewrites upstream Set-Cookie attributes. Domains maps upstream
+// to public domains ("*" for any, "" to drop the attribute); Paths maps
+// upstream path prefixes to public ones and, as paths are case sensitive, is
+// a list rather than a map.
+type CookieConfig struct {
+	Domains  map[string]string `mapstructure:"domains"`
+	Paths    []FieldRename     `mapstructure:"paths"`
+	Secure   bool              `mapstructure:"secure"`
+	HTTPOnly bool              `mapstructure:"http_only"`
+	SameSite string            `mapstructure:"same_site"`
+}
+
+// BodyRules transform JSON bodies. Field names are case sensitive, so renames
+// and additions are lists rather than maps, whose keys are lowercased when the
+// config is loaded.
+type BodyRules struct {
+	Unwrap string        `mapstructure:"unwrap"`
+	Remove []string      `mapstructure:"remove"`
+	Rename []FieldRename `mapstructure:"rename"`
+	Add    []FieldValue  `mapstructure:"add"`
+	Wrap   string        `mapstructure:"wrap"`
+}
+
+type FieldRename struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
+type FieldValue struct {
+	Field string      `mapstructure:"field"`
+	Value interface{} `mapstructure:"value"`
+}
+
+// RewriteConfig maps the client path onto the upstream path after
+// strip_prefix. Target (with {param} placeholders) replaces the path outright;
+// otherwise the prefix replacement and then the regex apply.
+type RewriteConfig struct {
+	PrefixFrom  string              `mapstructure:"prefix_from"`
+	PrefixTo    string              `mapstructure:"prefix_to"`
+	Regex       string              `mapstructure:"regex"`
+	Replacement string              `mapstructure:"replacement"`
+	Target      string              `mapstructure:"target"`
+	Query       *QueryRewriteConfig `mapstructure:"query"`
+}
+
+// QueryRewriteConfig edits the upstream query. Parameter names are case
+// sensitive, so renames and additions are lists, as in BodyRules.
+type QueryRewriteConfig struct {
+	Add    []QueryParam  `mapstructure:"add"`
+	Remove []string      `mapstructure:"remove"`
+	Rename []FieldRename `mapstructure:"rename"`
+}
+
+type QueryParam struct {
+	Name  string `mapstructure:"name"`
+	Value string `mapstructure:"value"`
+}
+
 type ConfigLoader interface {
 	Load(ctx context.Context, path string) (*Config, error)
 	Watch(callback func(*Config))
 	Get() *Config
 	Reload() *Config
+	// ReloadConfig is Reload reporting why the config was rejected.
+	ReloadConfig() (*Config, error)
 }
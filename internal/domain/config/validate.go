@@ -0,0 +1,569 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Validate reports configuration the router cannot serve unambiguously:
+// malformed match rules, templates, patterns and files the router would fail
+// to build, and routes that share a path, a method and the same match
+// conditions.
+func (c *Config) Validate() error {
+	var errs []error
+	if admin := c.Server.Admin; admin != nil && (admin.Address == "" || admin.Token == "") {
+		errs = append(errs, errors.New("server admin needs an address and a token"))
+	}
+	if c.RouteStore != nil && c.RouteStore.Path == "" {
+		errs = append(errs, errors.New("route_store needs a path"))
+	}
+	if err := c.Maintenance.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTrustedProxies(c.Server.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+
+	for i, route := range c.Routes {
+		for _, method := range route.MethodList() {
+			if !validMethod(method) {
+				errs = append(errs, fmt.Errorf("route %d (%s): invalid method %q", i, route.Path, method))
+			}
+		}
+		if err := route.Match.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+		if err := route.Split.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+		if m := route.Mirror; m != nil && (m.Upstream == "" || m.Percent < 0 || m.Percent > 100) {
+			errs = append(errs, fmt.Errorf("route %d (%s): mirror needs an upstream and a percent between 0 and 100", i, route.Path))
+		}
+		if h := route.Hedge; h != nil && h.DelayMs <= 0 && h.MinDelayMs <= 0 {
+			// Without a delay every request would be sent twice at once.
+			errs = append(errs, fmt.Errorf("route %d (%s): hedge needs delay_ms or min_delay_ms", i, route.Path))
+		}
+		if err := route.CircuitBreaker.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+		if err := route.validateCompare(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+		if err := route.validateComposite(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+		if err := route.validateResponder(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+		if err := route.validateTransforms(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+		if err := route.Maintenance.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, route.Path, err))
+		}
+
+		for j := 0; j < i; j++ {
+			if conflicts(c.Routes[j], route) {
+				errs = append(errs, fmt.Errorf("route %d (%s) conflicts with route %d: same path, method and match conditions", i, route.Path, j))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SameExceptWeights reports whether two configs differ at most in their
+// traffic split weights, which can be applied without rebuilding routes.
+func SameExceptWeights(a, b *Config) bool {
+	return reflect.DeepEqual(withoutWeights(a), withoutWeights(b))
+}
+
+func withoutWeights(cfg *Config) Config {
+	out := *cfg
+	out.Routes = make([]Route, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		if route.Split != nil {
+			split := *route.Split
+			split.Backends = append([]BackendConfig(nil), split.Backends...)
+			for j := range split.Backends {
+				split.Backends[j].Weight = 0
+			}
+			route.Split = &split
+		}
+		out.Routes[i] = route
+	}
+	return out
+}
+
+// Specificity ranks routes that share a path; higher ranks are tried first.
+// Exact hosts beat wildcard hosts, which beat no host, and then routes with
+// more header, query and cookie conditions win.
+func (m *MatchConfig) Specificity() (host, conditions int) {
+	if m == nil {
+		return 0, 0
+	}
+
+	if len(m.Hosts) > 0 {
+		host = 2
+		for _, h := range m.Hosts {
+			if strings.HasPrefix(h, "*.") {
+				host = 1
+			}
+		}
+	}
+	return host, len(m.Headers) + len(m.Query) + len(m.Cookies)
+}
+
+func (m *MatchConfig) validate() error {
+	if m == nil {
+		return nil
+	}
+
+	for _, host := range m.Hosts {
+		if host == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf(`match host %q: only a leading "*." wildcard is supported`, host)
+		}
+	}
+
+	kinds := []struct {
+		name  string
+		rules []MatchRule
+	}{{"header", m.Headers}, {"query", m.Query}, {"cookie", m.Cookies}}
+
+	for _, kind := range kinds {
+		for _, rule := range kind.rules {
+			if rule.Name == "" {
+				return fmt.Errorf("match %s: name is required", kind.name)
+			}
+			if rule.Value != "" && rule.Regex != "" {
+				return fmt.Errorf("match %s %s: value and regex are exclusive", kind.name, rule.Name)
+			}
+			if rule.Regex != "" {
+				if _, err := regexp.Compile(rule.Regex); err != nil {
+					return fmt.Errorf("match %s %s: %w", kind.name, rule.Name, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *SplitConfig) validate() error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Backends) == 0 {
+		return errors.New("split: at least one backend is required")
+	}
+	if s.Sticky != "" && s.Sticky != "user" && s.Sticky != "cookie" {
+		return fmt.Errorf("split: sticky must be user or cookie, got %q", s.Sticky)
+	}
+
+	names := make(map[string]bool, len(s.Backends))
+	total := 0
+	for _, backend := range s.Backends {
+		switch {
+		case backend.Name == "":
+			return errors.New("split: backend name is required")
+		case names[backend.Name]:
+			return fmt.Errorf("split: duplicate backend %q", backend.Name)
+		case backend.Upstream == "":
+			return fmt.Errorf("split: backend %q has no upstream", backend.Name)
+		case backend.Weight < 0:
+			return fmt.Errorf("split: backend %q has a negative weight", backend.Name)
+		}
+		names[backend.Name] = true
+		total += backend.Weight
+	}
+	if total == 0 {
+		return errors.New("split: weights must not all be zero")
+	}
+	return nil
+}
+
+func (c *CircuitBreakerConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.FailureRateThreshold < 0 || c.FailureRateThreshold > 100 {
+		return fmt.Errorf("circuit_breaker failure_rate_threshold must be between 0 and 100, got %g", c.FailureRateThreshold)
+	}
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"consecutive_failures", c.ConsecutiveFailures},
+		{"window_ms", c.WindowMs},
+		{"min_requests", c.MinRequests},
+		{"open_duration_ms", c.OpenDurationMs},
+		{"half_open_requests", c.HalfOpenRequests},
+	} {
+		if field.value < 0 {
+			return fmt.Errorf("circuit_breaker %s must not be negative", field.name)
+		}
+	}
+	return nil
+}
+
+func conflicts(a, b Route) bool {
+	if a.Path != b.Path || a.Match.key() != b.Match.key() {
+		return false
+	}
+
+	for _, ma := range a.MethodList() {
+		for _, mb := range b.MethodList() {
+			if ma == mb || ma == MethodAny || mb == MethodAny {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validMethod reports whether method is an RFC 9110 token, which custom
+// verbs such as PROPFIND or PURGE are.
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, r := range method {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// key is a canonical, readable form of the match conditions, so equivalent
+// configurations written in a different order compare equal.
+func (m *MatchConfig) key() string {
+	if m == nil {
+		return ""
+	}
+
+	var parts []string
+	if len(m.Hosts) > 0 {
+		hosts := make([]string, len(m.Hosts))
+		for i, host := range m.Hosts {
+			hosts[i] = strings.ToLower(host)
+		}
+		sort.Strings(hosts)
+		parts = append(parts, "host="+strings.Join(hosts, ","))
+	}
+
+	parts = append(parts, ruleKeys("header", m.Headers, http.CanonicalHeaderKey)...)
+	parts = append(parts, ruleKeys("query", m.Query, nil)...)
+	parts = append(parts, ruleKeys("cookie", m.Cookies, nil)...)
+	return strings.Join(parts, " ")
+}
+
+func ruleKeys(kind string, rules []MatchRule, canonical func(string) string) []string {
+	keys := make([]string, len(rules))
+	for i, rule := range rules {
+		name := rule.Name
+		if canonical != nil {
+			name = canonical(name)
+		}
+		keys[i] = kind + "." + name
+		if rule.Value != "" {
+			keys[i] += "=" + rule.Value
+		}
+		if rule.Regex != "" {
+			keys[i] += "~" + rule.Regex
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateCompare only allows compare mode on read-only routes, since every
+// request reaches both backends.
+func (r Route) validateCompare() error {
+	c := r.Compare
+	if c == nil {
+		return nil
+	}
+	if c.Upstream == "" || c.Percent < 0 || c.Percent > 100 {
+		return errors.New("compare needs an upstream and a percent between 0 and 100")
+	}
+	if r.Mirror != nil {
+		return errors.New("compare and mirror cannot be combined")
+	}
+	for _, method := range r.MethodList() {
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			return fmt.Errorf("compare requires read-only methods, got %s", method)
+		}
+	}
+	return nil
+}
+
+// validateComposite requires calls to depend only on earlier calls, which
+// rules out cycles.
+func (r Route) validateComposite() error {
+	c := r.Composite
+	if c == nil {
+		return nil
+	}
+	if r.Split != nil || r.Mirror != nil || r.Compare != nil {
+		return errors.New("composite cannot be combined with split, mirror or compare")
+	}
+	if len(c.Calls) == 0 {
+		return errors.New("composite needs at least one call")
+	}
+
+	seen := make(map[string]bool, len(c.Calls))
+	for i, call := range c.Calls {
+		switch {
+		case call.Name == "":
+			return fmt.Errorf("composite call %d: missing name", i)
+		case seen[call.Name]:
+			return fmt.Errorf("composite call %q: duplicate name", call.Name)
+		case call.URL == "":
+			return fmt.Errorf("composite call %q: missing url", call.Name)
+		case call.Fallback != "" && !json.Valid([]byte(call.Fallback)):
+			return fmt.Errorf("composite call %q: fallback is not valid JSON", call.Name)
+		}
+		if _, err := template.New(call.Name).Funcs(compositeURLFuncs).Parse(call.URL); err != nil {
+			return fmt.Errorf("composite call %q: url: %w", call.Name, err)
+		}
+		for _, dep := range call.DependsOn {
+			if !seen[dep] {
+				return fmt.Errorf("composite call %q: depends on %q, which is not an earlier call", call.Name, dep)
+			}
+		}
+		seen[call.Name] = true
+	}
+
+	for _, field := range c.Merge {
+		call, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(field.From, "$"), "."), ".")
+		call, _, _ = strings.Cut(call, "[")
+		if !seen[call] {
+			return fmt.Errorf("composite merge %q: unknown call %q", field.From, call)
+		}
+	}
+	return nil
+}
+
+// validateResponder checks routes that answer without an upstream; a route
+// has at most one of composite, response, redirect and files.
+func (r Route) validateResponder() error {
+	kinds := 0
+	for _, set := range []bool{r.Composite != nil, r.Response != nil, r.Redirect != nil, r.Files != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return errors.New("composite, response, redirect and files are mutually exclusive")
+	}
+	if r.Files != nil {
+		if r.Files.Root == "" {
+			return errors.New("files needs a root directory")
+		}
+		if info, err := os.Stat(r.Files.Root); err != nil || !info.IsDir() {
+			return fmt.Errorf("files root %q is not a directory", r.Files.Root)
+		}
+	}
+
+	if resp := r.Response; resp != nil {
+		if resp.Status != 0 && (resp.Status < 100 || resp.Status > 599) {
+			return fmt.Errorf("response status %d is not a valid HTTP status", resp.Status)
+		}
+		if resp.Body != "" && resp.File != "" {
+			return errors.New("response takes a body or a file, not both")
+		}
+		if resp.File != "" {
+			file, err := os.Open(resp.File)
+			if err != nil {
+				return fmt.Errorf("response file: %w", err)
+			}
+			file.Close()
+		}
+	}
+
+	if redirect := r.Redirect; redirect != nil {
+		if redirect.To == "" {
+			return errors.New("redirect needs a target")
+		}
+		switch redirect.Status {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("redirect status %d is not one of 301, 302, 307, 308", redirect.Status)
+		}
+		if err := validateTemplate("redirect", redirect.To); err != nil {
+			return fmt.Errorf("redirect target: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateTransforms checks the header, body, rewrite and cookie rules the
+// router compiles for proxied requests.
+func (r Route) validateTransforms() error {
+	// Legacy {{.claim}} placeholders always compile; anything else in
+	// headers is a template of its own.
+	for name, value := range r.Headers {
+		if err := validateTemplate(name, legacyPlaceholder.ReplaceAllString(value, "")); err != nil {
+			return fmt.Errorf("headers %s: %w", name, err)
+		}
+	}
+	if err := r.RequestHeaders.validate("request_headers"); err != nil {
+		return err
+	}
+	if err := r.ResponseHeaders.validate("response_headers"); err != nil {
+		return err
+	}
+	if err := r.RequestBody.validate("request_body"); err != nil {
+		return err
+	}
+	if err := r.ResponseBody.validate("response_body"); err != nil {
+		return err
+	}
+
+	if rw := r.Rewrite; rw != nil && rw.Regex != "" {
+		if _, err := regexp.Compile(rw.Regex); err != nil {
+			return fmt.Errorf("rewrite regex: %w", err)
+		}
+	}
+	if c := r.Cookies; c != nil {
+		switch strings.ToLower(c.SameSite) {
+		case "", "lax", "strict", "none":
+		default:
+			return fmt.Errorf("cookies same_site must be lax, strict or none, got %q", c.SameSite)
+		}
+	}
+	return nil
+}
+
+func (h *HeaderRules) validate(block string) error {
+	if h == nil {
+		return nil
+	}
+	for _, values := range []map[string]string{h.Set, h.Add} {
+		for name, value := range values {
+			if !strings.Contains(value, "{{") {
+				continue
+			}
+			if err := validateTemplate(name, value); err != nil {
+				return fmt.Errorf("%s %s: %w", block, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *BodyRules) validate(block string) error {
+	if b == nil {
+		return nil
+	}
+	for _, field := range b.Remove {
+		if emptyField(field) {
+			return fmt.Errorf("%s remove: empty field", block)
+		}
+	}
+	for _, rename := range b.Rename {
+		if emptyField(rename.From) || emptyField(rename.To) {
+			return fmt.Errorf("%s rename %q: empty field", block, rename.From)
+		}
+	}
+	for _, add := range b.Add {
+		if emptyField(add.Field) {
+			return fmt.Errorf("%s add: empty field", block)
+		}
+		if text, ok := add.Value.(string); ok && strings.Contains(text, "{{") {
+			if err := validateTemplate(add.Field, text); err != nil {
+				return fmt.Errorf("%s add %s: %w", block, add.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// emptyField reports body field paths such as "" or "$." that name no field.
+func emptyField(field string) bool {
+	field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+	return strings.NewReplacer("[", ".", "]", "").Replace(field) == ""
+}
+
+// templateFields mirrors the data the proxy renders header, body and
+// redirect templates against, so references to unknown fields fail here.
+type templateFields struct {
+	RequestID string
+	ClientIP  string
+	UserID    string
+	Method    string
+	Path      string
+	Params    map[string]string
+	Claims    map[string]string
+}
+
+// legacyPlaceholder matches the {{.claim}} form of Route.Headers.
+var legacyPlaceholder = regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`)
+
+// compositeURLFuncs are the escaping functions composite call URLs may use;
+// only their names matter for parsing.
+var compositeURLFuncs = template.FuncMap{
+	"pathescape":  fmt.Sprint,
+	"queryescape": fmt.Sprint,
+	"raw":         fmt.Sprint,
+}
+
+func validateTemplate(name, text string) error {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(io.Discard, &templateFields{})
+}
+
+// validateTrustedProxies accepts what the proxy does: CIDRs and bare IPs.
+func validateTrustedProxies(entries []string) error {
+	var invalid []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err == nil {
+				continue
+			}
+		} else if net.ParseIP(entry) != nil {
+			continue
+		}
+		invalid = append(invalid, entry)
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("server trusted_proxies: invalid entries %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+func (m *MaintenanceConfig) validate() error {
+	if m == nil {
+		return nil
+	}
+	if m.RetryAfterMs < 0 {
+		return errors.New("maintenance retry_after_ms must not be negative")
+	}
+	for _, entry := range m.AllowIPs {
+		if _, err := netip.ParsePrefix(entry); err != nil {
+			if _, err := netip.ParseAddr(entry); err != nil {
+				return fmt.Errorf("maintenance allow_ips: %q is not an IP or CIDR", entry)
+			}
+		}
+	}
+	return nil
+}
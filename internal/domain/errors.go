@@ -9,6 +9,8 @@ type ErrorCode string
 
 const (
 	ErrCodeNotFound            ErrorCode = "ERR_NOT_FOUND"
+	ErrCodeConflict            ErrorCode = "ERR_CONFLICT"
+	ErrCodeVersionMismatch     ErrorCode = "ERR_VERSION_MISMATCH"
 	ErrCodeUnauthorized        ErrorCode = "ERR_UNAUTHORIZED"
 	ErrCodeForbidden           ErrorCode = "ERR_FORBIDDEN"
 	ErrCodeUpstreamUnavailable ErrorCode = "ERR_UPSTREAM_UNAVAILABLE"
@@ -57,6 +59,8 @@ func (e *GatewayError) With(err error) *GatewayError {
 
 var (
 	ErrNotFound            = &GatewayError{Code: ErrCodeNotFound, Message: "resource not found"}
+	ErrConflict            = &GatewayError{Code: ErrCodeConflict, Message: "resource already exists"}
+	ErrVersionMismatch     = &GatewayError{Code: ErrCodeVersionMismatch, Message: "resource was modified"}
 	ErrUnauthorized        = &GatewayError{Code: ErrCodeUnauthorized, Message: "unauthorized"}
 	ErrForbidden           = &GatewayError{Code: ErrCodeForbidden, Message: "forbidden"}
 	ErrUpstreamUnavailable = &GatewayError{Code: ErrCodeUpstreamUnavailable, Message: "upstream service unavailable"}
@@ -7,3 +7,7 @@ import (
 type CircuitBreaker interface {
 	Execute(ctx context.Context, op string, fn func() error) error
 }
+
+type ConcurrencyLimiter interface {
+	Acquire(ctx context.Context) (func(dropped bool), error)
+}
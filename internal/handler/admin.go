@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v3"
+
+	"api-gateway/internal/middleware"
+)
+
+// RouteInfo describes a configured route in the admin route table.
+type RouteInfo struct {
+	ID           string   `json:"id"`
+	Path         string   `json:"path"`
+	Methods      []string `json:"methods"`
+	Kind         string   `json:"kind"`
+	Upstreams    []string `json:"upstreams,omitempty"`
+	AuthRequired bool     `json:"auth_required"`
+}
+
+// UpstreamHealth is what the gateway knows about an upstream: the routes
+// using it and its circuit breakers. Reachable is only set by a probe.
+type UpstreamHealth struct {
+	Upstream  string                     `json:"upstream"`
+	Routes    []string                   `json:"routes"`
+	Circuits  []middleware.CircuitStatus `json:"circuits"`
+	Healthy   bool                       `json:"healthy"`
+	Reachable *bool                      `json:"reachable,omitempty"`
+	Status    int                        `json:"status,omitempty"`
+	LatencyMs int64                      `json:"latency_ms,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+type InspectionAdmin interface {
+	EffectiveConfig() map[string]interface{}
+	RouteTable() []RouteInfo
+	UpstreamHealth(probe bool) []UpstreamHealth
+	LimiterStats() []middleware.LimiterStats
+}
+
+// EffectiveConfig returns the running config with secrets redacted.
+func EffectiveConfig(admin InspectionAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"config": admin.EffectiveConfig(),
+		})
+	}
+}
+
+func Routes(admin InspectionAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"routes": admin.RouteTable(),
+		})
+	}
+}
+
+// Upstreams reports upstream health from circuit breaker state; with
+// ?probe=true every upstream is also requested once.
+func Upstreams(admin InspectionAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"upstreams": admin.UpstreamHealth(c.Query("probe") == "true"),
+		})
+	}
+}
+
+func Limiters(admin InspectionAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"limiters": admin.LimiterStats(),
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v3"
+)
+
+type CachePurger interface {
+	PurgeCache(prefix string) int
+}
+
+type purgeCacheRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+// PurgeCache drops cached responses whose path starts with the given prefix,
+// or everything when no prefix is sent.
+func PurgeCache(purger CachePurger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var req purgeCacheRequest
+		if len(c.Body()) > 0 {
+			if err := c.Bind().JSON(&req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "invalid purge request",
+				})
+			}
+		}
+
+		return c.JSON(fiber.Map{
+			"purged": purger.PurgeCache(req.Prefix),
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/middleware"
+)
+
+type CircuitAdmin interface {
+	Circuits() []middleware.CircuitStatus
+	ForceCircuit(breaker, upstream, state string) error
+}
+
+type forceCircuitRequest struct {
+	Breaker  string `json:"breaker"`
+	Upstream string `json:"upstream"`
+	State    string `json:"state"`
+}
+
+func Circuits(admin CircuitAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"circuits": admin.Circuits(),
+		})
+	}
+}
+
+func ForceCircuit(admin CircuitAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var req forceCircuitRequest
+		if err := c.Bind().JSON(&req); err != nil || req.Breaker == "" || req.Upstream == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "breaker, upstream and state are required",
+			})
+		}
+
+		err := admin.ForceCircuit(req.Breaker, req.Upstream, req.State)
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "circuit breaker not found",
+			})
+		case errors.Is(err, middleware.ErrUnknownUpstream):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "upstream not used by this route",
+			})
+		case errors.Is(err, middleware.ErrUnknownCircuitState):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "state must be one of open, closed or auto",
+			})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "circuit " + req.State,
+		})
+	}
+}
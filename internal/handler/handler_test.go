@@ -1,11 +1,20 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/adapter/proxy"
+	"api-gateway/internal/domain"
+	"api-gateway/internal/domain/config"
+	"api-gateway/internal/middleware"
 )
 
 func TestHealth(t *testing.T) {
@@ -53,3 +62,367 @@ func TestSwaggerUI(t *testing.T) {
 	assert.Equal(t, 200, resp.StatusCode)
 	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
 }
+
+type fakeCircuitAdmin struct {
+	forced []string
+}
+
+func (f *fakeCircuitAdmin) Circuits() []middleware.CircuitStatus {
+	return []middleware.CircuitStatus{{Breaker: "/api/*", Upstream: "http://svc", State: "open"}}
+}
+
+func (f *fakeCircuitAdmin) ForceCircuit(breaker, upstream, state string) error {
+	if breaker != "/api/*" {
+		return domain.ErrNotFound
+	}
+	if upstream != "http://svc" {
+		return middleware.ErrUnknownUpstream
+	}
+	f.forced = append(f.forced, upstream+"="+state)
+	return nil
+}
+
+func TestCircuits(t *testing.T) {
+	app := fiber.New()
+	app.Get("/admin/circuits", Circuits(&fakeCircuitAdmin{}))
+
+	req := httptest.NewRequest("GET", "/admin/circuits", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestForceCircuit(t *testing.T) {
+	admin := &fakeCircuitAdmin{}
+	app := fiber.New()
+	app.Post("/admin/circuits/force", ForceCircuit(admin))
+
+	req := httptest.NewRequest("POST", "/admin/circuits/force", strings.NewReader(`{"breaker":"/api/*","upstream":"http://svc","state":"open"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []string{"http://svc=open"}, admin.forced)
+
+	req = httptest.NewRequest("POST", "/admin/circuits/force", strings.NewReader(`{"breaker":"/missing","upstream":"http://svc","state":"open"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	req = httptest.NewRequest("POST", "/admin/circuits/force", strings.NewReader(`{"breaker":"/api/*","upstream":"http://other","state":"open"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Len(t, admin.forced, 1)
+}
+
+type fakeCachePurger struct {
+	prefixes []string
+}
+
+func (f *fakeCachePurger) PurgeCache(prefix string) int {
+	f.prefixes = append(f.prefixes, prefix)
+	return 3
+}
+
+func TestPurgeCache(t *testing.T) {
+	purger := &fakeCachePurger{}
+	app := fiber.New()
+	app.Post("/admin/cache/purge", PurgeCache(purger))
+
+	req := httptest.NewRequest("POST", "/admin/cache/purge", strings.NewReader(`{"prefix":"/api/users"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/admin/cache/purge", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []string{"/api/users", ""}, purger.prefixes)
+}
+
+type fakeSplitAdmin struct {
+	weights map[string]int
+}
+
+func (f *fakeSplitAdmin) Splits() []middleware.SplitStatus {
+	return []middleware.SplitStatus{{Route: "/api/users/*"}}
+}
+
+func (f *fakeSplitAdmin) SetSplitWeights(route string, weights map[string]int) error {
+	if route != "/api/users/*" {
+		return domain.ErrNotFound
+	}
+	if weights["canary"] < 0 {
+		return middleware.ErrInvalidWeights
+	}
+	f.weights = weights
+	return nil
+}
+
+func TestSetSplitWeights(t *testing.T) {
+	admin := &fakeSplitAdmin{}
+	app := fiber.New()
+	app.Get("/admin/splits", Splits(admin))
+	app.Put("/admin/splits/weights", SetSplitWeights(admin))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"ramp", `{"route":"/api/users/*","weights":{"stable":75,"canary":25}}`, 200},
+		{"unknown route", `{"route":"/nope","weights":{"canary":1}}`, 404},
+		{"invalid weights", `{"route":"/api/users/*","weights":{"canary":-1}}`, 400},
+		{"missing weights", `{"route":"/api/users/*"}`, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/admin/splits/weights", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+	assert.Equal(t, map[string]int{"stable": 75, "canary": 25}, admin.weights)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/splits", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+type fakeMirrorDiffs []proxy.ResponseDiff
+
+func (f fakeMirrorDiffs) MirrorDiffs() []proxy.ResponseDiff {
+	return f
+}
+
+func TestMirrorDiffs(t *testing.T) {
+	app := fiber.New()
+	app.Get("/admin/mirror/diffs", MirrorDiffs(fakeMirrorDiffs{{Route: "/api/users/*", PrimaryStatus: 200, ShadowStatus: 500}}))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/mirror/diffs", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"shadow_status":500`)
+}
+
+type fakeMaintenanceAdmin map[string]bool
+
+func (f fakeMaintenanceAdmin) Maintenance() []middleware.MaintenanceStatus {
+	return []middleware.MaintenanceStatus{{Route: middleware.GlobalMaintenance, Enabled: f[middleware.GlobalMaintenance]}}
+}
+
+func (f fakeMaintenanceAdmin) SetMaintenance(route string, enabled bool) error {
+	if _, ok := f[route]; !ok {
+		return domain.ErrNotFound
+	}
+	f[route] = enabled
+	return nil
+}
+
+func TestSetMaintenance(t *testing.T) {
+	admin := fakeMaintenanceAdmin{middleware.GlobalMaintenance: false, "/api/users/*": false}
+	app := fiber.New()
+	app.Get("/admin/maintenance", Maintenance(admin))
+	app.Put("/admin/maintenance", SetMaintenance(admin))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"global", `{"enabled":true}`, 200},
+		{"route", `{"route":"/api/users/*","enabled":true}`, 200},
+		{"unknown route", `{"route":"/nope","enabled":true}`, 404},
+		{"missing enabled", `{"route":"/api/users/*"}`, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+	assert.Equal(t, fakeMaintenanceAdmin{middleware.GlobalMaintenance: true, "/api/users/*": true}, admin)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/maintenance", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestReload(t *testing.T) {
+	var reloadErr error
+	app := fiber.New()
+	app.Post("/admin/reload", Reload(func() error { return reloadErr }))
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/admin/reload", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	reloadErr = fmt.Errorf("invalid config: %w", errors.Join(errors.New("route 0 (/a): invalid method \"G T\""), errors.New("route 1 (/b): redirect needs a target")))
+	resp, err = app.Test(httptest.NewRequest("POST", "/admin/reload", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 422, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"error":"config not reloaded","details":["route 0 (/a): invalid method \"G T\"","route 1 (/b): redirect needs a target"]}`, string(body))
+}
+
+type fakeInspectionAdmin struct{}
+
+func (fakeInspectionAdmin) EffectiveConfig() map[string]interface{} {
+	return map[string]interface{}{"jwt": map[string]interface{}{"secret": "[REDACTED]"}}
+}
+
+func (fakeInspectionAdmin) RouteTable() []RouteInfo {
+	return []RouteInfo{{ID: "/a", Path: "/a", Methods: []string{"GET"}, Kind: "proxy", Upstreams: []string{"http://a"}}}
+}
+
+func (fakeInspectionAdmin) UpstreamHealth(probe bool) []UpstreamHealth {
+	health := UpstreamHealth{Upstream: "http://a", Routes: []string{"/a"}, Healthy: true}
+	if probe {
+		reachable := true
+		health.Reachable = &reachable
+	}
+	return []UpstreamHealth{health}
+}
+
+func (fakeInspectionAdmin) LimiterStats() []middleware.LimiterStats {
+	return []middleware.LimiterStats{{ID: "/a", RPS: 10, Burst: 20}}
+}
+
+func TestInspection(t *testing.T) {
+	admin := fakeInspectionAdmin{}
+	app := fiber.New()
+	app.Get("/admin/config", EffectiveConfig(admin))
+	app.Get("/admin/routes", Routes(admin))
+	app.Get("/admin/upstreams", Upstreams(admin))
+	app.Get("/admin/limiters", Limiters(admin))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/admin/config", `"secret":"[REDACTED]"`},
+		{"/admin/routes", `"kind":"proxy"`},
+		{"/admin/upstreams", `"healthy":true}`},
+		{"/admin/upstreams?probe=true", `"reachable":true`},
+		{"/admin/limiters", `"rps":10`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(body), tt.want)
+		})
+	}
+}
+
+type fakeRouteEditor struct {
+	route   config.Route
+	actor   string
+	changes []config.RouteChange
+}
+
+func (f *fakeRouteEditor) Route(id string) (config.Route, error) {
+	if id != f.route.ID() {
+		return config.Route{}, domain.ErrNotFound
+	}
+	return f.route, nil
+}
+
+func (f *fakeRouteEditor) CreateRoute(body []byte, actor string) (config.Route, error) {
+	if string(body) == "{}" {
+		return config.Route{}, domain.ErrConfigInvalid.With(errors.Join(errors.New("route 1 (): missing path")))
+	}
+	return config.Route{}, domain.ErrConflict
+}
+
+func (f *fakeRouteEditor) UpdateRoute(id, etag string, body []byte, actor string) (config.Route, error) {
+	if etag != f.route.ETag() {
+		return config.Route{}, domain.ErrVersionMismatch
+	}
+	f.actor = actor
+	f.route.Upstream = "http://v2"
+	return f.route, nil
+}
+
+func (f *fakeRouteEditor) DeleteRoute(id, etag, actor string) error {
+	return domain.ErrNotFound
+}
+
+func (f *fakeRouteEditor) RouteChanges(limit int) ([]config.RouteChange, error) {
+	return f.changes[:limit], nil
+}
+
+func TestRouteEditing(t *testing.T) {
+	editor := &fakeRouteEditor{
+		route:   config.Route{Path: "/a", Upstream: "http://v1", RequestHeaders: &config.HeaderRules{Set: map[string]string{"Authorization": "Bearer s3cret"}}},
+		changes: []config.RouteChange{{Action: config.RouteUpdated}, {Action: config.RouteCreated}},
+	}
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals(middleware.UserIDCtxKey, "ann")
+		return c.Next()
+	})
+	app.Get("/admin/route", GetRoute(editor))
+	app.Post("/admin/route", CreateRoute(editor))
+	app.Put("/admin/route", UpdateRoute(editor))
+	app.Delete("/admin/route", DeleteRoute(editor))
+	app.Get("/admin/audit", RouteChanges(editor))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/route?id=GET%20/a", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, `"`+editor.route.ETag()+`"`, etag)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"Authorization":"[REDACTED]"`)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		ifMatch    string
+		wantStatus int
+	}{
+		{"unknown route", "GET", "/admin/route?id=GET%20/b", "", "", 404},
+		{"invalid route", "POST", "/admin/route", "{}", "", 422},
+		{"existing route", "POST", "/admin/route", `{"path":"/a"}`, "", 409},
+		{"update without If-Match", "PUT", "/admin/route?id=GET%20/a", `{"path":"/a"}`, "", 428},
+		{"update with stale ETag", "PUT", "/admin/route?id=GET%20/a", `{"path":"/a"}`, `"stale"`, 412},
+		{"update", "PUT", "/admin/route?id=GET%20/a", `{"path":"/a"}`, etag, 200},
+		{"delete without If-Match", "DELETE", "/admin/route?id=GET%20/a", "", "", 428},
+		{"delete unknown route", "DELETE", "/admin/route?id=GET%20/b", "", `"x"`, 404},
+		{"audit", "GET", "/admin/audit?limit=1", "", "", 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+	assert.Equal(t, "ann", editor.actor)
+	assert.Equal(t, "http://v2", editor.route.Upstream)
+}
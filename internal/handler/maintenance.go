@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/middleware"
+)
+
+type MaintenanceAdmin interface {
+	Maintenance() []middleware.MaintenanceStatus
+	SetMaintenance(route string, enabled bool) error
+}
+
+type maintenanceRequest struct {
+	Route   string `json:"route"`
+	Enabled *bool  `json:"enabled"`
+}
+
+func Maintenance(admin MaintenanceAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"maintenance": admin.Maintenance(),
+		})
+	}
+}
+
+// SetMaintenance switches maintenance mode on or off for a route, or for the
+// whole gateway when no route is given.
+func SetMaintenance(admin MaintenanceAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var req maintenanceRequest
+		if err := c.Bind().JSON(&req); err != nil || req.Enabled == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "enabled is required",
+			})
+		}
+		if req.Route == "" {
+			req.Route = middleware.GlobalMaintenance
+		}
+
+		err := admin.SetMaintenance(req.Route, *req.Enabled)
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "route not found",
+			})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "maintenance updated",
+		})
+	}
+}
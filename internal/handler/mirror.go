@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v3"
+
+	"api-gateway/internal/adapter/proxy"
+)
+
+type MirrorDiffSource interface {
+	MirrorDiffs() []proxy.ResponseDiff
+}
+
+// MirrorDiffs lists the most recent differences between primary and shadow
+// responses, newest first.
+func MirrorDiffs(source MirrorDiffSource) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"diffs": source.MirrorDiffs(),
+		})
+	}
+}
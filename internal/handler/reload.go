@@ -1,17 +1,21 @@
 package handler
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v3"
 )
 
-type ReloadHandler func() interface{}
+// ReloadHandler re-reads the config and applies it, or reports why it was
+// rejected; the running config stays in place on error.
+type ReloadHandler func() error
 
 func Reload(reload ReloadHandler) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		result := reload()
-		if result == nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "failed to reload config",
+		if err := reload(); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":   "config not reloaded",
+				"details": errorList(err),
 			})
 		}
 		return c.JSON(fiber.Map{
@@ -19,3 +23,18 @@ func Reload(reload ReloadHandler) fiber.Handler {
 		})
 	}
 }
+
+// errorList splits joined errors, such as every problem found by
+// config.Validate, into one message each.
+func errorList(err error) []string {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return []string{err.Error()}
+	}
+
+	var list []string
+	for _, e := range joined.Unwrap() {
+		list = append(list, e.Error())
+	}
+	return list
+}
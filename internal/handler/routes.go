@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/domain/config"
+	"api-gateway/internal/middleware"
+)
+
+// defaultAuditLimit is how many route changes GET /admin/audit returns
+// without ?limit.
+const defaultAuditLimit = 100
+
+// RouteEditor changes routes at runtime. Routes are addressed by ID and
+// versioned by ETag; bodies are routes in config file form, as JSON.
+type RouteEditor interface {
+	Route(id string) (config.Route, error)
+	CreateRoute(body []byte, actor string) (config.Route, error)
+	UpdateRoute(id, etag string, body []byte, actor string) (config.Route, error)
+	DeleteRoute(id, etag, actor string) error
+	RouteChanges(limit int) ([]config.RouteChange, error)
+}
+
+// GetRoute returns ?id= with its ETag. Secrets are redacted, so updates
+// must send them again; bodies still holding the placeholder are rejected.
+func GetRoute(editor RouteEditor) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		route, err := editor.Route(c.Query("id"))
+		if err != nil {
+			return routeError(c, err)
+		}
+		return routeResponse(c, fiber.StatusOK, route)
+	}
+}
+
+func CreateRoute(editor RouteEditor) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		route, err := editor.CreateRoute(c.Body(), actor(c))
+		if err != nil {
+			return routeError(c, err)
+		}
+		return routeResponse(c, fiber.StatusCreated, route)
+	}
+}
+
+// UpdateRoute replaces ?id=; If-Match must carry the ETag the change is
+// based on.
+func UpdateRoute(editor RouteEditor) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		etag, ok := ifMatch(c)
+		if !ok {
+			return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+				"error": "If-Match with the route's ETag is required",
+			})
+		}
+
+		route, err := editor.UpdateRoute(c.Query("id"), etag, c.Body(), actor(c))
+		if err != nil {
+			return routeError(c, err)
+		}
+		return routeResponse(c, fiber.StatusOK, route)
+	}
+}
+
+func DeleteRoute(editor RouteEditor) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		etag, ok := ifMatch(c)
+		if !ok {
+			return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+				"error": "If-Match with the route's ETag is required",
+			})
+		}
+
+		if err := editor.DeleteRoute(c.Query("id"), etag, actor(c)); err != nil {
+			return routeError(c, err)
+		}
+		return c.JSON(fiber.Map{
+			"status": "route deleted",
+		})
+	}
+}
+
+// RouteChanges returns the audit log, newest first.
+func RouteChanges(editor RouteEditor) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		limit := fiber.Query[int](c, "limit", defaultAuditLimit)
+		changes, err := editor.RouteChanges(limit)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{
+			"changes": changes,
+		})
+	}
+}
+
+func routeResponse(c fiber.Ctx, status int, route config.Route) error {
+	c.Set(fiber.HeaderETag, `"`+route.ETag()+`"`)
+	return c.Status(status).JSON(fiber.Map{
+		"id":    route.ID(),
+		"route": config.Redact(route),
+	})
+}
+
+func routeError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "route not found",
+		})
+	case errors.Is(err, domain.ErrConflict):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "a route with this ID already exists",
+		})
+	case errors.Is(err, domain.ErrVersionMismatch):
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error": "route was changed since the given ETag",
+		})
+	case errors.Is(err, domain.ErrConfigInvalid):
+		var gatewayErr *domain.GatewayError
+		if errors.As(err, &gatewayErr) && gatewayErr.Err != nil {
+			err = gatewayErr.Err
+		}
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":   "route rejected",
+			"details": errorList(err),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+func ifMatch(c fiber.Ctx) (string, bool) {
+	etag := strings.TrimPrefix(strings.TrimSpace(c.Get(fiber.HeaderIfMatch)), "W/")
+	etag = strings.Trim(etag, `"`)
+	return etag, etag != ""
+}
+
+// actor names who made a change for the audit log: the JWT subject, or the
+// X-Admin-User given with the admin token. The latter is self-asserted by
+// whoever holds the token, not authenticated.
+func actor(c fiber.Ctx) string {
+	if id := middleware.GetUserID(c); id != "" {
+		return id
+	}
+	return "unknown"
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/middleware"
+)
+
+type SplitAdmin interface {
+	Splits() []middleware.SplitStatus
+	SetSplitWeights(route string, weights map[string]int) error
+}
+
+type splitWeightsRequest struct {
+	Route   string         `json:"route"`
+	Weights map[string]int `json:"weights"`
+}
+
+func Splits(admin SplitAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"splits": admin.Splits(),
+		})
+	}
+}
+
+// SetSplitWeights changes a route's backend weights in place, e.g. to ramp a
+// canary from 1% to 100% without reloading the config.
+func SetSplitWeights(admin SplitAdmin) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var req splitWeightsRequest
+		if err := c.Bind().JSON(&req); err != nil || req.Route == "" || len(req.Weights) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "route and weights are required",
+			})
+		}
+
+		err := admin.SetSplitWeights(req.Route, req.Weights)
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "traffic split not found",
+			})
+		case errors.Is(err, middleware.ErrInvalidWeights):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": "weights updated",
+		})
+	}
+}
@@ -1,25 +1,105 @@
 package middleware
 
 import (
+	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+
+	"api-gateway/internal/adapter/resilience"
+)
+
+const UpstreamErrorCtxKey = "upstream_error"
+
+var (
+	circuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "Circuit state per breaker and upstream (0=closed, 1=half-open, 2=open)",
+		},
+		[]string{"breaker", "upstream"},
+	)
+
+	circuitBreakerTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Circuit state transitions per breaker and upstream",
+		},
+		[]string{"breaker", "upstream", "from", "to"},
+	)
+)
+
+var (
+	ErrUnknownCircuitState = errors.New("unknown circuit state")
+	ErrUnknownUpstream     = errors.New("unknown upstream")
 )
 
+type CircuitStatus struct {
+	Breaker     string    `json:"breaker"`
+	Upstream    string    `json:"upstream"`
+	State       string    `json:"state"`
+	Forced      bool      `json:"forced"`
+	Failures    int       `json:"consecutive_failures"`
+	Successes   int       `json:"successes"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	OpenedAt    time.Time `json:"opened_at,omitempty"`
+}
+
+// Open reports whether the circuit currently rejects requests.
+func (s CircuitStatus) Open() bool {
+	return s.State == circuitStateOpen
+}
+
+// DefaultCircuitOpenDuration is how long a tripped circuit rejects requests
+// when the policy does not say.
+const DefaultCircuitOpenDuration = 30 * time.Second
+
+type CircuitBreakerPolicy struct {
+	FailureRateThreshold float64
+	ConsecutiveFailures  int
+	Window               time.Duration
+	WindowBuckets        int
+	MinRequests          int
+	OpenDuration         time.Duration
+	HalfOpenRequests     int
+	FailureStatusCodes   []int
+	FailureErrors        []string
+}
+
 type CircuitBreaker struct {
 	mu              sync.RWMutex
 	circuitBreakers map[string]*circuit
-	attempts        int
-	backoff         time.Duration
+	policy          CircuitBreakerPolicy
+	failureStatus   map[int]struct{}
+	failureErrors   map[string]struct{}
+	upstreams       map[string]struct{}
+	name            string
+	logger          *zerolog.Logger
 }
 
 type circuit struct {
-	failures    int
-	successes   int
-	state       string
-	lastFailure time.Time
-	mu          sync.Mutex
+	key              string
+	forced           bool
+	failures         int
+	successes        int
+	state            string
+	lastFailure      time.Time
+	openedAt         time.Time
+	buckets          []windowBucket
+	halfOpenInFlight int
+	halfOpenPassed   int
+	mu               sync.Mutex
+}
+
+type windowBucket struct {
+	start     time.Time
+	successes int
+	failures  int
 }
 
 const (
@@ -28,12 +108,52 @@ const (
 	circuitStateHalfOpen = "half-open"
 )
 
+// NewCircuitBreaker keeps the original semantics: trip after attempts
+// consecutive failures and stay open for attempts*backoff.
 func NewCircuitBreaker(attempts int, backoff time.Duration) *CircuitBreaker {
-	return &CircuitBreaker{
+	return NewCircuitBreakerWithPolicy(LegacyCircuitPolicy(attempts, backoff))
+}
+
+// LegacyCircuitPolicy is the policy behind NewCircuitBreaker.
+func LegacyCircuitPolicy(attempts int, backoff time.Duration) CircuitBreakerPolicy {
+	return CircuitBreakerPolicy{
+		ConsecutiveFailures: attempts,
+		OpenDuration:        backoff * time.Duration(attempts),
+	}
+}
+
+func NewCircuitBreakerWithPolicy(policy CircuitBreakerPolicy) *CircuitBreaker {
+	if policy.Window <= 0 {
+		policy.Window = 10 * time.Second
+	}
+	if policy.WindowBuckets <= 0 {
+		policy.WindowBuckets = 10
+	}
+	if policy.HalfOpenRequests <= 0 {
+		policy.HalfOpenRequests = 1
+	}
+	if policy.OpenDuration <= 0 {
+		// Without it a tripped circuit would half-open at once.
+		policy.OpenDuration = DefaultCircuitOpenDuration
+	}
+	if policy.FailureRateThreshold <= 0 && policy.ConsecutiveFailures <= 0 {
+		policy.ConsecutiveFailures = 5
+	}
+
+	cb := &CircuitBreaker{
 		circuitBreakers: make(map[string]*circuit),
-		attempts:        attempts,
-		backoff:         backoff,
+		policy:          policy,
+		failureStatus:   make(map[int]struct{}, len(policy.FailureStatusCodes)),
+		failureErrors:   make(map[string]struct{}, len(policy.FailureErrors)),
+	}
+	for _, code := range policy.FailureStatusCodes {
+		cb.failureStatus[code] = struct{}{}
+	}
+	for _, kind := range policy.FailureErrors {
+		cb.failureErrors[kind] = struct{}{}
 	}
+
+	return cb
 }
 
 func (cb *CircuitBreaker) getCircuit(key string) *circuit {
@@ -53,12 +173,37 @@ func (cb *CircuitBreaker) getCircuit(key string) *circuit {
 	}
 
 	c = &circuit{
-		state: circuitStateClosed,
+		key:     key,
+		state:   circuitStateClosed,
+		buckets: make([]windowBucket, cb.policy.WindowBuckets),
 	}
 	cb.circuitBreakers[key] = c
+	if cb.name != "" {
+		circuitBreakerState.WithLabelValues(cb.name, key).Set(stateValue(circuitStateClosed))
+	}
 	return c
 }
 
+// Instrument names the breaker for metrics, logs and the admin API.
+func (cb *CircuitBreaker) Instrument(name string, logger zerolog.Logger) *CircuitBreaker {
+	cb.name = name
+	cb.logger = &logger
+	return cb
+}
+
+// Upstreams limits Force to the upstreams the breaker's route forwards to.
+func (cb *CircuitBreaker) Upstreams(upstreams []string) *CircuitBreaker {
+	cb.upstreams = make(map[string]struct{}, len(upstreams))
+	for _, upstream := range upstreams {
+		cb.upstreams[upstream] = struct{}{}
+	}
+	return cb
+}
+
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
 func (cb *CircuitBreaker) Execute(key string, fn func() error) error {
 	if !cb.Allow(key) {
 		return fiber.ErrServiceUnavailable
@@ -75,16 +220,27 @@ func (cb *CircuitBreaker) Allow(key string) bool {
 	circuit.mu.Lock()
 	defer circuit.mu.Unlock()
 
-	if circuit.state != circuitStateOpen {
-		return true
+	if circuit.forced {
+		return circuit.state != circuitStateOpen
 	}
 
-	if time.Since(circuit.lastFailure) > cb.backoff*time.Duration(cb.attempts) {
-		circuit.state = circuitStateHalfOpen
+	switch circuit.state {
+	case circuitStateClosed:
 		return true
+	case circuitStateOpen:
+		if time.Since(circuit.openedAt) <= cb.policy.OpenDuration {
+			return false
+		}
+		cb.transition(circuit, circuitStateHalfOpen)
+		circuit.halfOpenInFlight = 0
+		circuit.halfOpenPassed = 0
 	}
 
-	return false
+	if circuit.halfOpenInFlight >= cb.policy.HalfOpenRequests {
+		return false
+	}
+	circuit.halfOpenInFlight++
+	return true
 }
 
 func (cb *CircuitBreaker) Record(key string, success bool) {
@@ -93,29 +249,227 @@ func (cb *CircuitBreaker) Record(key string, success bool) {
 	circuit.mu.Lock()
 	defer circuit.mu.Unlock()
 
+	now := time.Now()
+
+	if circuit.forced {
+		if success {
+			circuit.successes++
+		} else {
+			circuit.lastFailure = now
+		}
+		return
+	}
+
+	if circuit.state == circuitStateHalfOpen {
+		if circuit.halfOpenInFlight > 0 {
+			circuit.halfOpenInFlight--
+		}
+		if !success {
+			circuit.failures++
+			circuit.lastFailure = now
+			cb.open(circuit, now)
+			return
+		}
+		circuit.successes++
+		circuit.halfOpenPassed++
+		if circuit.halfOpenPassed >= cb.policy.HalfOpenRequests {
+			cb.close(circuit)
+		}
+		return
+	}
+
+	if circuit.state == circuitStateOpen {
+		return
+	}
+
+	bucket := cb.currentBucket(circuit, now)
 	if success {
 		circuit.successes++
 		circuit.failures = 0
-		if circuit.state == circuitStateHalfOpen {
-			circuit.state = circuitStateClosed
-		}
+		bucket.successes++
 		return
 	}
 
 	circuit.failures++
-	circuit.lastFailure = time.Now()
-	if circuit.failures >= cb.attempts {
-		circuit.state = circuitStateOpen
+	circuit.lastFailure = now
+	bucket.failures++
+
+	if cb.policy.ConsecutiveFailures > 0 && circuit.failures >= cb.policy.ConsecutiveFailures {
+		cb.open(circuit, now)
+		return
+	}
+
+	if cb.policy.FailureRateThreshold > 0 {
+		total, failed := cb.windowCounts(circuit, now)
+		if total >= cb.policy.MinRequests && float64(failed)/float64(total) >= cb.policy.FailureRateThreshold {
+			cb.open(circuit, now)
+		}
 	}
 }
 
-var globalCircuitBreaker *CircuitBreaker
+func (cb *CircuitBreaker) open(circuit *circuit, now time.Time) {
+	cb.transition(circuit, circuitStateOpen)
+	circuit.openedAt = now
+	circuit.halfOpenInFlight = 0
+	circuit.halfOpenPassed = 0
+}
 
-func CircuitBreakerMiddleware(attempts int, backoff time.Duration) fiber.Handler {
-	if globalCircuitBreaker == nil {
-		globalCircuitBreaker = NewCircuitBreaker(attempts, backoff)
+func (cb *CircuitBreaker) close(circuit *circuit) {
+	cb.transition(circuit, circuitStateClosed)
+	circuit.failures = 0
+	for i := range circuit.buckets {
+		circuit.buckets[i] = windowBucket{}
 	}
+}
+
+func (cb *CircuitBreaker) transition(circuit *circuit, to string) {
+	from := circuit.state
+	circuit.state = to
+	if from == to || cb.name == "" {
+		return
+	}
+
+	circuitBreakerState.WithLabelValues(cb.name, circuit.key).Set(stateValue(to))
+	circuitBreakerTransitions.WithLabelValues(cb.name, circuit.key, from, to).Inc()
+
+	if cb.logger != nil {
+		event := cb.logger.Info()
+		if to == circuitStateOpen {
+			event = cb.logger.Warn()
+		}
+		event.
+			Str("breaker", cb.name).
+			Str("upstream", circuit.key).
+			Str("from", from).
+			Str("to", to).
+			Bool("forced", circuit.forced).
+			Int("consecutive_failures", circuit.failures).
+			Msg("circuit " + to)
+	}
+}
+
+// Force pins a circuit open or closed until it is released with "auto",
+// which resets it to closed and resumes normal evaluation.
+func (cb *CircuitBreaker) Force(key, state string) error {
+	if _, ok := cb.upstreams[key]; cb.upstreams != nil && !ok {
+		return ErrUnknownUpstream
+	}
+	circuit := cb.getCircuit(key)
+
+	circuit.mu.Lock()
+	defer circuit.mu.Unlock()
+
+	switch state {
+	case circuitStateOpen:
+		circuit.forced = true
+		cb.transition(circuit, circuitStateOpen)
+		circuit.openedAt = time.Now()
+	case circuitStateClosed:
+		circuit.forced = true
+		cb.transition(circuit, circuitStateClosed)
+	case "auto":
+		circuit.forced = false
+		cb.close(circuit)
+	default:
+		return ErrUnknownCircuitState
+	}
+
+	return nil
+}
+
+func (cb *CircuitBreaker) Circuits() []CircuitStatus {
+	cb.mu.RLock()
+	circuits := make([]*circuit, 0, len(cb.circuitBreakers))
+	for _, c := range cb.circuitBreakers {
+		circuits = append(circuits, c)
+	}
+	cb.mu.RUnlock()
 
+	statuses := make([]CircuitStatus, 0, len(circuits))
+	for _, c := range circuits {
+		c.mu.Lock()
+		statuses = append(statuses, CircuitStatus{
+			Breaker:     cb.name,
+			Upstream:    c.key,
+			State:       c.state,
+			Forced:      c.forced,
+			Failures:    c.failures,
+			Successes:   c.successes,
+			LastFailure: c.lastFailure,
+			OpenedAt:    c.openedAt,
+		})
+		c.mu.Unlock()
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Upstream < statuses[j].Upstream })
+	return statuses
+}
+
+func stateValue(state string) float64 {
+	switch state {
+	case circuitStateHalfOpen:
+		return 1
+	case circuitStateOpen:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func (cb *CircuitBreaker) bucketWidth() time.Duration {
+	return cb.policy.Window / time.Duration(cb.policy.WindowBuckets)
+}
+
+func (cb *CircuitBreaker) currentBucket(circuit *circuit, now time.Time) *windowBucket {
+	width := cb.bucketWidth()
+	start := now.Truncate(width)
+	idx := int(start.UnixNano()/int64(width)) % len(circuit.buckets)
+
+	bucket := &circuit.buckets[idx]
+	if !bucket.start.Equal(start) {
+		*bucket = windowBucket{start: start}
+	}
+	return bucket
+}
+
+func (cb *CircuitBreaker) windowCounts(circuit *circuit, now time.Time) (total, failed int) {
+	cutoff := now.Add(-cb.policy.Window)
+	for _, bucket := range circuit.buckets {
+		if bucket.start.After(cutoff) {
+			total += bucket.successes + bucket.failures
+			failed += bucket.failures
+		}
+	}
+	return total, failed
+}
+
+// IsFailure decides whether a finished request counts against the circuit.
+// Without explicit status codes any 5xx counts; without explicit error kinds
+// any upstream transport error counts.
+func (cb *CircuitBreaker) IsFailure(status int, upstreamErr error) bool {
+	if upstreamErr != nil {
+		if len(cb.failureErrors) == 0 {
+			return true
+		}
+		if _, ok := cb.failureErrors["any"]; ok {
+			return true
+		}
+		_, ok := cb.failureErrors[resilience.ClassifyError(upstreamErr)]
+		return ok
+	}
+
+	if len(cb.failureStatus) == 0 {
+		return status >= fiber.StatusInternalServerError
+	}
+	_, ok := cb.failureStatus[status]
+	return ok
+}
+
+func CircuitBreakerMiddleware(attempts int, backoff time.Duration) fiber.Handler {
+	return CircuitBreakerWithBreaker(NewCircuitBreaker(attempts, backoff))
+}
+
+func CircuitBreakerWithBreaker(breaker *CircuitBreaker) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		upstream := c.Locals("upstream")
 		if upstream == nil {
@@ -127,16 +481,18 @@ func CircuitBreakerMiddleware(attempts int, backoff time.Duration) fiber.Handler
 			return c.Next()
 		}
 
-		if !globalCircuitBreaker.Allow(upstreamURL) {
+		if !breaker.Allow(upstreamURL) {
 			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
 				"error": "service temporarily unavailable",
 			})
 		}
 
 		err := c.Next()
-		status := c.Response().StatusCode()
-		success := err == nil && status < fiber.StatusInternalServerError
-		globalCircuitBreaker.Record(upstreamURL, success)
+		upstreamErr, _ := c.Locals(UpstreamErrorCtxKey).(error)
+		if err != nil && upstreamErr == nil {
+			upstreamErr = err
+		}
+		breaker.Record(upstreamURL, !breaker.IsFailure(c.Response().StatusCode(), upstreamErr))
 
 		return err
 	}
@@ -0,0 +1,516 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	cacheadapter "api-gateway/internal/adapter/cache"
+	"api-gateway/internal/domain/cache"
+	"api-gateway/internal/domain/proxy"
+)
+
+const CacheStatusHeader = "X-Cache"
+
+const (
+	CacheHit         = "HIT"
+	CacheMiss        = "MISS"
+	CacheRevalidated = "REVALIDATED"
+	CacheStale       = "STALE"
+	CacheBypass      = "BYPASS"
+)
+
+const defaultCacheRefreshTimeout = 10 * time.Second
+
+var (
+	cacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_requests_total",
+			Help: "Cacheable requests by cache result",
+		},
+		[]string{"route", "result"},
+	)
+
+	cacheRefreshes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_refreshes_total",
+			Help: "Background refreshes of stale cache entries by outcome",
+		},
+		[]string{"route", "result"},
+	)
+)
+
+// Headers that describe the connection or are set per response rather than
+// per representation.
+var uncachedHeaders = map[string]struct{}{
+	"Age":               {},
+	"Connection":        {},
+	"Content-Length":    {},
+	"Date":              {},
+	"Keep-Alive":        {},
+	"Set-Cookie":        {},
+	"Transfer-Encoding": {},
+	CacheStatusHeader:   {},
+}
+
+var cacheableStatuses = map[int]struct{}{
+	http.StatusOK:                   {},
+	http.StatusNonAuthoritativeInfo: {},
+	http.StatusNoContent:            {},
+	http.StatusMultipleChoices:      {},
+	http.StatusMovedPermanently:     {},
+	http.StatusPermanentRedirect:    {},
+	http.StatusNotFound:             {},
+	http.StatusGone:                 {},
+}
+
+// CacheRefresher prepares, from a client request, a repeat of it that runs
+// outside of the request with extra headers such as validators.
+type CacheRefresher func(c fiber.Ctx) func(ctx context.Context, header http.Header) (*proxy.Response, error)
+
+type CacheConfig struct {
+	Store cache.Store
+	Route string
+	// Variant separates the entries of routes that share a path.
+	Variant string
+	// TTL overrides the freshness lifetime the upstream advertises; the stale
+	// windows likewise override stale-while-revalidate and stale-if-error.
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	KeyClaims            []string
+	KeyHeaders           []string
+	// Refresh enables stale-while-revalidate; without it stale entries are
+	// revalidated inline.
+	Refresh        CacheRefresher
+	RefreshTimeout time.Duration
+}
+
+func Cache(cfg CacheConfig) fiber.Handler {
+	if cfg.RefreshTimeout <= 0 {
+		cfg.RefreshTimeout = defaultCacheRefreshTimeout
+	}
+	refreshing := &sync.Map{}
+
+	return func(c fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet {
+			return c.Next()
+		}
+
+		reqDirectives := cacheadapter.ParseCacheControl(c.Get(fiber.HeaderCacheControl))
+		if reqDirectives.NoStore {
+			cacheRequests.WithLabelValues(cfg.Route, CacheBypass).Inc()
+			err := c.Next()
+			c.Set(CacheStatusHeader, CacheBypass)
+			return err
+		}
+
+		ctx := c.Context()
+		now := time.Now()
+		primary := variantCacheKey(c, CacheKey(c, cfg.KeyClaims, cfg.KeyHeaders), cfg.Variant)
+		key, entry := lookupCache(c, cfg.Store, primary)
+
+		if entry != nil && entry.Fresh(now) && !reqDirectives.NoCache {
+			cacheRequests.WithLabelValues(cfg.Route, CacheHit).Inc()
+			return serveCached(c, entry, CacheHit, now)
+		}
+
+		if entry != nil && cfg.Refresh != nil && !reqDirectives.NoCache && entry.StaleWhileRevalidating(now) {
+			refreshCached(c, cfg, refreshing, key, entry)
+			cacheRequests.WithLabelValues(cfg.Route, CacheStale).Inc()
+			return serveCached(c, entry, CacheStale, now)
+		}
+
+		// Conditional requests from the client are answered by the gateway;
+		// upstream only ever sees validators for the stored entry. The client's
+		// values are copied, as the header changes below reuse their bytes.
+		ifNoneMatch := strings.Clone(c.Get(fiber.HeaderIfNoneMatch))
+		ifModifiedSince := strings.Clone(c.Get(fiber.HeaderIfModifiedSince))
+		c.Request().Header.Del(fiber.HeaderIfNoneMatch)
+		c.Request().Header.Del(fiber.HeaderIfModifiedSince)
+		if entry != nil {
+			if entry.ETag != "" {
+				c.Request().Header.Set(fiber.HeaderIfNoneMatch, entry.ETag)
+			}
+			if entry.LastModified != "" {
+				c.Request().Header.Set(fiber.HeaderIfModifiedSince, entry.LastModified)
+			}
+		}
+
+		err := c.Next()
+		restoreHeader(c, fiber.HeaderIfNoneMatch, ifNoneMatch)
+		restoreHeader(c, fiber.HeaderIfModifiedSince, ifModifiedSince)
+
+		status := c.Response().StatusCode()
+		if (err != nil || status >= fiber.StatusInternalServerError) && entry != nil && entry.StaleOnError(now) {
+			cacheRequests.WithLabelValues(cfg.Route, CacheStale).Inc()
+			return serveCached(c, entry, CacheStale, now)
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry != nil && status == fiber.StatusNotModified {
+			refreshed := refreshEntry(entry, responseHeader(c), cfg, now)
+			cfg.Store.Set(ctx, key, refreshed)
+			cacheRequests.WithLabelValues(cfg.Route, CacheRevalidated).Inc()
+			return serveCached(c, refreshed, CacheRevalidated, now)
+		}
+
+		cacheRequests.WithLabelValues(cfg.Route, CacheMiss).Inc()
+		c.Set(CacheStatusHeader, CacheMiss)
+
+		header := responseHeader(c)
+		authorized := c.Get(fiber.HeaderAuthorization) != ""
+		setsCookie := c.GetRespHeader(fiber.HeaderSetCookie) != ""
+		if _, ok := storable(status, header, authorized, setsCookie, cfg, now); ok {
+			storeEntry(c, cfg.Store, primary, newCacheEntry(status, header, c.Response().Body(), cfg, now))
+		}
+
+		return nil
+	}
+}
+
+// CacheKey identifies a cached representation by path and query, plus the
+// configured claims and headers when responses are per user.
+func CacheKey(c fiber.Ctx, claims, headers []string) string {
+	var b strings.Builder
+	b.WriteString(c.Path())
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		b.WriteByte('?')
+		b.Write(query)
+	}
+
+	if len(claims) > 0 {
+		userClaims, _ := c.Locals("user_claims").(map[string]interface{})
+		for _, name := range claims {
+			b.WriteString("\x00")
+			b.WriteString(name)
+			b.WriteByte('=')
+			if value, ok := userClaims[name]; ok {
+				b.WriteString(claimString(value))
+			}
+		}
+	}
+
+	for _, name := range headers {
+		b.WriteString("\x00")
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteByte('=')
+		b.WriteString(c.Get(name))
+	}
+
+	return b.String()
+}
+
+// variantCacheKey keeps entries of routes that share a path, and of the
+// backends of a traffic split, apart while leaving the path first, so
+// purging by prefix still finds them.
+func variantCacheKey(c fiber.Ctx, key, variant string) string {
+	if variant != "" {
+		key += "\x00route=" + variant
+	}
+	if backend, _ := c.Locals(BackendCtxKey).(string); backend != "" {
+		key += "\x00backend=" + backend
+	}
+	return key
+}
+
+func lookupCache(c fiber.Ctx, store cache.Store, primary string) (string, *cache.Entry) {
+	entry, ok := store.Get(c.Context(), primary)
+	if !ok {
+		return primary, nil
+	}
+	if !isVaryIndex(entry) {
+		return primary, entry
+	}
+
+	key := variantKey(c, primary, entry.Vary)
+	variant, ok := store.Get(c.Context(), key)
+	if !ok {
+		return key, nil
+	}
+	return key, variant
+}
+
+func storeEntry(c fiber.Ctx, store cache.Store, primary string, entry *cache.Entry) {
+	vary := parseVary(entry.Header.Get(fiber.HeaderVary))
+	if len(vary) == 0 {
+		store.Set(c.Context(), primary, entry)
+		return
+	}
+
+	store.Set(c.Context(), primary, &cache.Entry{Vary: vary, StoredAt: entry.StoredAt, Expires: entry.Expires})
+	store.Set(c.Context(), variantKey(c, primary, vary), entry)
+}
+
+func isVaryIndex(entry *cache.Entry) bool {
+	return entry.StatusCode == 0 && len(entry.Vary) > 0
+}
+
+func variantKey(c fiber.Ctx, primary string, vary []string) string {
+	var b strings.Builder
+	b.WriteString(primary)
+	b.WriteString("\x00vary")
+	for _, name := range vary {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(c.Get(name))
+	}
+	return b.String()
+}
+
+func parseVary(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// storable decides whether a response may go into a shared cache and for how
+// long it stays fresh.
+func storable(status int, header http.Header, authorized, setsCookie bool, cfg CacheConfig, now time.Time) (time.Duration, bool) {
+	if _, ok := cacheableStatuses[status]; !ok {
+		return 0, false
+	}
+	if setsCookie || strings.Contains(header.Get(fiber.HeaderVary), "*") {
+		return 0, false
+	}
+
+	directives := cacheadapter.ParseCacheControl(header.Get(fiber.HeaderCacheControl))
+	if directives.NoStore {
+		return 0, false
+	}
+
+	perUser := len(cfg.KeyClaims) > 0
+	if directives.Private && !perUser {
+		return 0, false
+	}
+	if authorized && !perUser && !directives.Public && directives.SMaxAge < 0 {
+		return 0, false
+	}
+
+	fresh, explicit := freshness(header, cfg, now)
+	if cfg.TTL > 0 {
+		explicit = true
+	}
+
+	hasValidators := header.Get(fiber.HeaderETag) != "" || header.Get(fiber.HeaderLastModified) != ""
+	servableStale := !directives.MustRevalidate &&
+		(staleWindow(cfg.StaleWhileRevalidate, directives.StaleWhileRevalidate) > 0 ||
+			staleWindow(cfg.StaleIfError, directives.StaleIfError) > 0)
+	if fresh <= 0 && !hasValidators && !servableStale {
+		return 0, false
+	}
+	if !explicit && !hasValidators {
+		return 0, false
+	}
+
+	return fresh, true
+}
+
+func newCacheEntry(status int, header http.Header, body []byte, cfg CacheConfig, now time.Time) *cache.Entry {
+	entry := &cache.Entry{
+		StatusCode:   status,
+		Header:       header,
+		Body:         append([]byte(nil), body...),
+		ETag:         header.Get(fiber.HeaderETag),
+		LastModified: header.Get(fiber.HeaderLastModified),
+	}
+	setLifetime(entry, cfg, now)
+	return entry
+}
+
+func refreshEntry(entry *cache.Entry, header http.Header, cfg CacheConfig, now time.Time) *cache.Entry {
+	refreshed := *entry
+	refreshed.Header = entry.Header.Clone()
+	for _, name := range []string{fiber.HeaderCacheControl, fiber.HeaderExpires, fiber.HeaderETag, fiber.HeaderLastModified} {
+		if value := header.Get(name); value != "" {
+			refreshed.Header.Set(name, value)
+		}
+	}
+	refreshed.ETag = refreshed.Header.Get(fiber.HeaderETag)
+	refreshed.LastModified = refreshed.Header.Get(fiber.HeaderLastModified)
+	setLifetime(&refreshed, cfg, now)
+
+	return &refreshed
+}
+
+func setLifetime(entry *cache.Entry, cfg CacheConfig, now time.Time) {
+	fresh, _ := freshness(entry.Header, cfg, now)
+	entry.StoredAt = now
+	entry.Expires = now.Add(fresh)
+
+	directives := cacheadapter.ParseCacheControl(entry.Header.Get(fiber.HeaderCacheControl))
+	entry.StaleWhileRevalidate, entry.StaleIfError = 0, 0
+	if directives.MustRevalidate {
+		return
+	}
+	entry.StaleWhileRevalidate = staleWindow(cfg.StaleWhileRevalidate, directives.StaleWhileRevalidate)
+	entry.StaleIfError = staleWindow(cfg.StaleIfError, directives.StaleIfError)
+}
+
+func freshness(header http.Header, cfg CacheConfig, now time.Time) (time.Duration, bool) {
+	fresh, explicit := cacheadapter.Freshness(header, now)
+	if cfg.TTL > 0 {
+		fresh = cfg.TTL
+	}
+	if cacheadapter.ParseCacheControl(header.Get(fiber.HeaderCacheControl)).NoCache {
+		fresh = 0
+	}
+	return fresh, explicit
+}
+
+func staleWindow(override, directive time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+	if directive > 0 {
+		return directive
+	}
+	return 0
+}
+
+// refreshCached revalidates a stale entry in the background. At most one
+// refresh per key runs at a time.
+func refreshCached(c fiber.Ctx, cfg CacheConfig, refreshing *sync.Map, key string, entry *cache.Entry) {
+	if _, busy := refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+
+	// Validators come from the stored entry, never from the client.
+	fetch := cfg.Refresh(c)
+	authorized := c.Get(fiber.HeaderAuthorization) != ""
+	header := http.Header{
+		fiber.HeaderIfNoneMatch:     nil,
+		fiber.HeaderIfModifiedSince: nil,
+	}
+	if entry.ETag != "" {
+		header.Set(fiber.HeaderIfNoneMatch, entry.ETag)
+	}
+	if entry.LastModified != "" {
+		header.Set(fiber.HeaderIfModifiedSince, entry.LastModified)
+	}
+
+	go func() {
+		defer refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.RefreshTimeout)
+		defer cancel()
+
+		resp, err := fetch(ctx, header)
+		if err != nil {
+			cacheRefreshes.WithLabelValues(cfg.Route, "error").Inc()
+			return
+		}
+
+		now := time.Now()
+		if resp.StatusCode == http.StatusNotModified {
+			cfg.Store.Set(ctx, key, refreshEntry(entry, filterHeader(resp.Header), cfg, now))
+			cacheRefreshes.WithLabelValues(cfg.Route, "revalidated").Inc()
+			return
+		}
+
+		respHeader := filterHeader(resp.Header)
+		setsCookie := resp.Header.Get(fiber.HeaderSetCookie) != ""
+		if _, ok := storable(resp.StatusCode, respHeader, authorized, setsCookie, cfg, now); !ok {
+			cacheRefreshes.WithLabelValues(cfg.Route, "error").Inc()
+			return
+		}
+
+		cfg.Store.Set(ctx, key, newCacheEntry(resp.StatusCode, respHeader, resp.Body, cfg, now))
+		cacheRefreshes.WithLabelValues(cfg.Route, "updated").Inc()
+	}()
+}
+
+func serveCached(c fiber.Ctx, entry *cache.Entry, result string, now time.Time) error {
+	c.Response().ResetBody()
+	c.Status(entry.StatusCode)
+	for key, values := range entry.Header {
+		c.Response().Header.Del(key)
+		for _, value := range values {
+			c.Response().Header.Add(key, value)
+		}
+	}
+	c.Set(fiber.HeaderAge, strconv.Itoa(int(now.Sub(entry.StoredAt).Seconds())))
+	c.Set(CacheStatusHeader, result)
+
+	if notModified(c, entry) {
+		c.Status(fiber.StatusNotModified)
+		return nil
+	}
+
+	return c.Send(entry.Body)
+}
+
+func notModified(c fiber.Ctx, entry *cache.Entry) bool {
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" {
+		if entry.ETag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(entry.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := c.Get(fiber.HeaderIfModifiedSince); ims != "" && entry.LastModified != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(entry.LastModified)
+		return err == nil && !modified.After(since)
+	}
+
+	return false
+}
+
+func restoreHeader(c fiber.Ctx, name, value string) {
+	if value == "" {
+		c.Request().Header.Del(name)
+		return
+	}
+	c.Request().Header.Set(name, value)
+}
+
+func filterHeader(source http.Header) http.Header {
+	header := make(http.Header, len(source))
+	for name, values := range source {
+		name = http.CanonicalHeaderKey(name)
+		if _, skip := uncachedHeaders[name]; skip {
+			continue
+		}
+		header[name] = append([]string(nil), values...)
+	}
+	return header
+}
+
+func responseHeader(c fiber.Ctx) http.Header {
+	header := make(http.Header)
+	c.Response().Header.VisitAll(func(key, value []byte) {
+		name := http.CanonicalHeaderKey(string(key))
+		if _, skip := uncachedHeaders[name]; skip {
+			return
+		}
+		header.Add(name, string(value))
+	})
+	return header
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"api-gateway/internal/adapter/resilience"
+	"api-gateway/internal/domain/proxy"
+)
+
+var coalescedRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "coalesced_requests_total",
+		Help: "Requests by their role in request coalescing",
+	},
+	[]string{"route", "result"},
+)
+
+// Credentials always take part in the coalescing key so responses are never
+// shared between callers.
+var coalesceCredentialHeaders = []string{fiber.HeaderAuthorization, fiber.HeaderCookie}
+
+type CoalesceConfig struct {
+	Coalescer  *resilience.Coalescer
+	Route      string
+	Variant    string
+	KeyHeaders []string
+}
+
+// Coalesce shares one upstream call between identical concurrent GET and HEAD
+// requests. Waiters that overflow the cap or time out make their own call.
+func Coalesce(cfg CoalesceConfig) fiber.Handler {
+	headers := append(append([]string(nil), coalesceCredentialHeaders...), cfg.KeyHeaders...)
+
+	return func(c fiber.Ctx) error {
+		method := c.Method()
+		if method != fiber.MethodGet && method != fiber.MethodHead {
+			return c.Next()
+		}
+		if strings.Contains(c.Get(fiber.HeaderCacheControl), "no-cache") {
+			return c.Next()
+		}
+
+		key := method + " " + variantCacheKey(c, CacheKey(c, nil, headers), cfg.Variant)
+		flight, leader, err := cfg.Coalescer.Join(key)
+		if err != nil {
+			coalescedRequests.WithLabelValues(cfg.Route, "overflow").Inc()
+			return c.Next()
+		}
+
+		if !leader {
+			resp, err := cfg.Coalescer.Wait(c.Context(), flight)
+			if err != nil {
+				result := "timeout"
+				if errors.Is(err, resilience.ErrFlightFailed) {
+					result = "failed"
+				}
+				coalescedRequests.WithLabelValues(cfg.Route, result).Inc()
+				return c.Next()
+			}
+
+			coalescedRequests.WithLabelValues(cfg.Route, "joined").Inc()
+			return writeShared(c, resp)
+		}
+
+		coalescedRequests.WithLabelValues(cfg.Route, "leader").Inc()
+
+		var shared *proxy.Response
+		defer func() {
+			cfg.Coalescer.Complete(key, flight, shared)
+		}()
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		shared = &proxy.Response{
+			StatusCode: c.Response().StatusCode(),
+			Header:     responseHeader(c),
+			Body:       append([]byte(nil), c.Response().Body()...),
+		}
+		return nil
+	}
+}
+
+func writeShared(c fiber.Ctx, resp *proxy.Response) error {
+	c.Response().ResetBody()
+	c.Status(resp.StatusCode)
+	for key, values := range resp.Header {
+		c.Response().Header.Del(key)
+		for _, value := range values {
+			c.Response().Header.Add(key, value)
+		}
+	}
+
+	if c.Method() == http.MethodHead {
+		return nil
+	}
+	return c.Send(resp.Body)
+}
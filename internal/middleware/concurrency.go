@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"api-gateway/internal/adapter/resilience"
+	"api-gateway/internal/domain"
+)
+
+var (
+	concurrencyLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "concurrency_limit",
+			Help: "Current concurrency limit per limiter",
+		},
+		[]string{"limiter"},
+	)
+
+	concurrencyInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "concurrency_in_flight",
+			Help: "Requests currently holding a concurrency slot per limiter",
+		},
+		[]string{"limiter"},
+	)
+
+	concurrencyRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "concurrency_rejected_total",
+			Help: "Requests shed by the concurrency limiter",
+		},
+		[]string{"limiter", "reason"},
+	)
+)
+
+func ConcurrencyLimit(name string, limiter *resilience.ConcurrencyLimiter) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return limitConcurrency(c, name, limiter)
+	}
+}
+
+// ConcurrencyLimitByUpstream limits each request with the limiter of the
+// upstream a traffic split picked for it. limiters are keyed by upstream and
+// named "upstream:<upstream>".
+func ConcurrencyLimitByUpstream(limiters map[string]*resilience.ConcurrencyLimiter) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		upstream, _ := c.Locals("upstream").(string)
+		limiter, ok := limiters[upstream]
+		if !ok {
+			return c.Next()
+		}
+		return limitConcurrency(c, "upstream:"+upstream, limiter)
+	}
+}
+
+func limitConcurrency(c fiber.Ctx, name string, limiter *resilience.ConcurrencyLimiter) (err error) {
+	release, err := limiter.Acquire(c.Context())
+	if err != nil {
+		concurrencyRejected.WithLabelValues(name, rejectReason(err)).Inc()
+
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "service overloaded",
+			"code":  domain.ErrCodeServiceUnavailable,
+		})
+	}
+
+	observeConcurrency(name, limiter)
+	defer observeConcurrency(name, limiter)
+	defer func() {
+		release(isOverloadSignal(c, err))
+	}()
+
+	return c.Next()
+}
+
+func observeConcurrency(name string, limiter *resilience.ConcurrencyLimiter) {
+	stats := limiter.Stats()
+	concurrencyLimit.WithLabelValues(name).Set(float64(stats.Limit))
+	concurrencyInFlight.WithLabelValues(name).Set(float64(stats.InFlight))
+}
+
+func rejectReason(err error) string {
+	switch {
+	case err == resilience.ErrQueueTimeout:
+		return "queue_timeout"
+	case errors.Is(err, domain.ErrServiceUnavailable):
+		return "limit"
+	default:
+		return "canceled"
+	}
+}
+
+func isOverloadSignal(c fiber.Ctx, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch c.Response().StatusCode() {
+	case fiber.StatusBadGateway, fiber.StatusServiceUnavailable, fiber.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
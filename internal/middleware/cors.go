@@ -60,7 +60,9 @@ func CORS(config CORSConfig) fiber.Handler {
 			}
 		}
 
-		if c.Method() == "OPTIONS" {
+		// Only preflights are answered here; other OPTIONS requests are
+		// routed like any other method.
+		if c.Method() == "OPTIONS" && c.Get("Access-Control-Request-Method") != "" {
 			return c.SendStatus(fiber.StatusNoContent)
 		}
 
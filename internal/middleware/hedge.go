@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"api-gateway/internal/adapter/resilience"
+)
+
+const HedgePolicyCtxKey = "hedge_policy"
+
+var (
+	hedgesSent = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_hedges_total",
+			Help: "Hedged attempts sent to upstreams",
+		},
+		[]string{"route"},
+	)
+
+	hedgeWins = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_hedge_wins_total",
+			Help: "Hedged requests by which attempt answered first",
+		},
+		[]string{"route", "winner"},
+	)
+)
+
+type HedgeConfig struct {
+	Route      string
+	Delay      time.Duration
+	Percentile float64
+	MinDelay   time.Duration
+	MaxHedges  int
+	Targets    []string
+	Methods    []string
+}
+
+type hedgeObserver string
+
+func (o hedgeObserver) Hedged() {
+	hedgesSent.WithLabelValues(string(o)).Inc()
+}
+
+func (o hedgeObserver) Won(hedge bool) {
+	winner := "primary"
+	if hedge {
+		winner = "hedge"
+	}
+	hedgeWins.WithLabelValues(string(o), winner).Inc()
+}
+
+func Hedge(cfg HedgeConfig) fiber.Handler {
+	policy := resilience.NewHedgePolicy(resilience.HedgePolicyOptions{
+		Delay:      cfg.Delay,
+		Percentile: cfg.Percentile,
+		MinDelay:   cfg.MinDelay,
+		MaxHedges:  cfg.MaxHedges,
+		Targets:    cfg.Targets,
+		Methods:    cfg.Methods,
+		Observer:   hedgeObserver(cfg.Route),
+	})
+
+	return func(c fiber.Ctx) error {
+		c.Locals(HedgePolicyCtxKey, policy)
+		return c.Next()
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
@@ -64,7 +65,7 @@ func JWT(config JWTConfig) fiber.Handler {
 		if userID, ok := claims["sub"].(string); ok {
 			c.Locals(UserIDCtxKey, userID)
 		}
-		c.Locals(UserClaimsCtxKey, claims)
+		c.Locals(UserClaimsCtxKey, map[string]interface{}(claims))
 
 		return c.Next()
 	}
@@ -83,3 +84,39 @@ func GetUserClaims(c fiber.Ctx) map[string]interface{} {
 	}
 	return nil
 }
+
+// RequireAdmin must run after JWT and only admits tokens with admin: true.
+func RequireAdmin() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if admin, ok := GetUserClaims(c)["admin"].(bool); !ok || !admin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "admin privileges required",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// AdminUserHeader names the operator behind an admin token request, for the
+// audit log. It is taken on trust from whoever holds the token.
+const AdminUserHeader = "X-Admin-User"
+
+// AdminToken guards the separate admin listener with a static bearer token,
+// compared in constant time.
+func AdminToken(token string) fiber.Handler {
+	expected := []byte("Bearer " + token)
+	return func(c fiber.Ctx) error {
+		if token == "" || subtle.ConstantTimeCompare([]byte(c.Get("Authorization")), expected) != 1 {
+			c.Set("WWW-Authenticate", "Bearer")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid admin token",
+			})
+		}
+		user := c.Get(AdminUserHeader)
+		if user == "" {
+			user = "admin-token"
+		}
+		c.Locals(UserIDCtxKey, user)
+		return c.Next()
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// GlobalMaintenance names the gateway-wide maintenance switch, as opposed to
+// a route's own.
+const GlobalMaintenance = "*"
+
+const defaultMaintenanceBody = `{"error":"service under maintenance"}`
+
+type MaintenanceConfig struct {
+	Route   string
+	Enabled bool
+	// RetryAfter is sent as Retry-After, rounded up to whole seconds.
+	RetryAfter  time.Duration
+	Body        string
+	ContentType string
+	// AllowIPs are IPs or CIDRs that are let through while enabled.
+	AllowIPs []string
+}
+
+type MaintenanceStatus struct {
+	Route   string `json:"route"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Maintenance answers 503 while enabled. It can be switched at runtime.
+type Maintenance struct {
+	cfg     MaintenanceConfig
+	allow   []netip.Prefix
+	enabled atomic.Bool
+}
+
+func NewMaintenance(cfg MaintenanceConfig) (*Maintenance, error) {
+	if cfg.Body == "" {
+		cfg.Body = defaultMaintenanceBody
+		cfg.ContentType = fiber.MIMEApplicationJSON
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = fiber.MIMETextPlainCharsetUTF8
+	}
+
+	m := &Maintenance{cfg: cfg}
+	for _, entry := range cfg.AllowIPs {
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		m.allow = append(m.allow, prefix)
+	}
+	m.enabled.Store(cfg.Enabled)
+	return m, nil
+}
+
+func (m *Maintenance) Handler() fiber.Handler {
+	retryAfter := ""
+	if m.cfg.RetryAfter > 0 {
+		retryAfter = strconv.Itoa(int(math.Ceil(m.cfg.RetryAfter.Seconds())))
+	}
+
+	return func(c fiber.Ctx) error {
+		if !m.enabled.Load() || m.allowed(c.IP()) {
+			return c.Next()
+		}
+
+		if retryAfter != "" {
+			c.Set(fiber.HeaderRetryAfter, retryAfter)
+		}
+		c.Set(fiber.HeaderContentType, m.cfg.ContentType)
+		return c.Status(fiber.StatusServiceUnavailable).SendString(m.cfg.Body)
+	}
+}
+
+func (m *Maintenance) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+func (m *Maintenance) Status() MaintenanceStatus {
+	return MaintenanceStatus{Route: m.cfg.Route, Enabled: m.enabled.Load()}
+}
+
+func (m *Maintenance) allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range m.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP %q: %w", entry, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const routeMatchCtxKey = "route_match"
+
+// MatchRule requires Name to be present and, when given, equal to Value or
+// match Regex.
+type MatchRule struct {
+	Name  string
+	Value string
+	Regex string
+}
+
+type RouteMatchConfig struct {
+	Hosts   []string
+	Headers []MatchRule
+	Query   []MatchRule
+	Cookies []MatchRule
+}
+
+// RouteMatch decides whether a request that matched a route's path and
+// method also satisfies its host, header, query and cookie conditions.
+type RouteMatch struct {
+	hosts   []string
+	headers []valueMatch
+	query   []valueMatch
+	cookies []valueMatch
+}
+
+type valueMatch struct {
+	name  string
+	value string
+	regex *regexp.Regexp
+}
+
+func NewRouteMatch(cfg RouteMatchConfig) (*RouteMatch, error) {
+	m := &RouteMatch{}
+	for _, host := range cfg.Hosts {
+		m.hosts = append(m.hosts, strings.ToLower(host))
+	}
+
+	var err error
+	if m.headers, err = compileMatchRules("header", cfg.Headers); err != nil {
+		return nil, err
+	}
+	if m.query, err = compileMatchRules("query", cfg.Query); err != nil {
+		return nil, err
+	}
+	if m.cookies, err = compileMatchRules("cookie", cfg.Cookies); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *RouteMatch) Matches(c fiber.Ctx) bool {
+	if len(m.hosts) > 0 && !matchHost(m.hosts, requestHostname(c)) {
+		return false
+	}
+
+	for _, rule := range m.headers {
+		if !rule.matchAny(c.Request().Header.PeekAll(rule.name)) {
+			return false
+		}
+	}
+
+	args := c.Request().URI().QueryArgs()
+	for _, rule := range m.query {
+		if !rule.matchAny(args.PeekMulti(rule.name)) {
+			return false
+		}
+	}
+
+	for _, rule := range m.cookies {
+		var values [][]byte
+		c.Request().Header.VisitAllCookie(func(key, value []byte) {
+			if string(key) == rule.name {
+				values = append(values, value)
+			}
+		})
+		if !rule.matchAny(values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Guard wraps a route's handlers so they only run for requests the match
+// accepts. Other requests pass through every handler untouched and fall
+// through to the next route registered for the same path.
+func (m *RouteMatch) Guard(handlers []fiber.Handler) []fiber.Handler {
+	guarded := make([]fiber.Handler, len(handlers))
+	for i, handler := range handlers {
+		first := i == 0
+		guarded[i] = func(c fiber.Ctx) error {
+			if first {
+				if m.Matches(c) {
+					c.Locals(routeMatchCtxKey, m)
+				} else {
+					c.Locals(routeMatchCtxKey, nil)
+				}
+			}
+			if owner, _ := c.Locals(routeMatchCtxKey).(*RouteMatch); owner != m {
+				return c.Next()
+			}
+			return handler(c)
+		}
+	}
+	return guarded
+}
+
+func (r valueMatch) matchAny(values [][]byte) bool {
+	for _, value := range values {
+		switch {
+		case r.regex != nil:
+			if r.regex.Match(value) {
+				return true
+			}
+		case r.value != "":
+			if string(value) == r.value {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func compileMatchRules(kind string, rules []MatchRule) ([]valueMatch, error) {
+	compiled := make([]valueMatch, 0, len(rules))
+	for _, rule := range rules {
+		match := valueMatch{name: rule.Name, value: rule.Value}
+		if rule.Regex != "" {
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("match %s %s: %w", kind, rule.Name, err)
+			}
+			match.regex = re
+		}
+		compiled = append(compiled, match)
+	}
+	return compiled, nil
+}
+
+// matchHost accepts exact hosts and "*.example.com", which matches any
+// subdomain of example.com but not example.com itself.
+func matchHost(hosts []string, host string) bool {
+	for _, pattern := range hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if len(host) > len(suffix) && strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func requestHostname(c fiber.Ctx) string {
+	host := strings.ToLower(string(c.Request().Host()))
+	if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') {
+		host = host[:i]
+	}
+	return strings.TrimSuffix(host, ".")
+}
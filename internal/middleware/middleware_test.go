@@ -2,7 +2,12 @@ package middleware
 
 import (
 	"context"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,7 +15,10 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 
+	cacheadapter "api-gateway/internal/adapter/cache"
 	"api-gateway/internal/adapter/ratelimit"
+	"api-gateway/internal/adapter/resilience"
+	"api-gateway/internal/domain/proxy"
 )
 
 func TestRequestID_Generated(t *testing.T) {
@@ -60,6 +68,7 @@ var corsTests = []struct {
 	config         CORSConfig
 	origin         string
 	method         string
+	requestMethod  string
 	expectedStatus int
 	checkHeaders   bool
 }{
@@ -101,9 +110,20 @@ var corsTests = []struct {
 		},
 		origin:         "http://example.com",
 		method:         "OPTIONS",
+		requestMethod:  "POST",
 		expectedStatus: 204,
 		checkHeaders:   true,
 	},
+	{
+		name: "plain OPTIONS routed",
+		config: CORSConfig{
+			AllowOrigins: []string{"*"},
+		},
+		origin:         "http://example.com",
+		method:         "OPTIONS",
+		expectedStatus: 200,
+		checkHeaders:   true,
+	},
 }
 
 func TestCORS(t *testing.T) {
@@ -120,6 +140,9 @@ func TestCORS(t *testing.T) {
 
 			req := httptest.NewRequest(tt.method, "/test", nil)
 			req.Header.Set("Origin", tt.origin)
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
 			resp, err := app.Test(req)
 
 			assert.NoError(t, err)
@@ -185,7 +208,6 @@ func TestRetry_AllFailures(t *testing.T) {
 }
 
 func TestCircuitBreaker_ClosedState(t *testing.T) {
-	resetGlobalBreaker()
 	cb := NewCircuitBreaker(3, 10)
 
 	err := cb.Execute("test", func() error {
@@ -205,7 +227,6 @@ func TestCircuitBreaker_HalfOpenState(t *testing.T) {
 }
 
 func TestCircuitBreakerMiddleware_BlocksAfterFailure(t *testing.T) {
-	resetGlobalBreaker()
 
 	app := fiber.New()
 	app.Use(func(c fiber.Ctx) error {
@@ -268,12 +289,11 @@ func TestRateLimiter_RefillsOverTime(t *testing.T) {
 }
 
 func TestRateLimit_Middleware(t *testing.T) {
-	limitersMu.Lock()
-	limiters = make(map[string]*ratelimit.TokenBucket)
-	limitersMu.Unlock()
+	registry := NewLimiterRegistry(0)
+	defer registry.Close()
 
 	app := fiber.New()
-	app.Use(RateLimit(2, 2))
+	app.Use(RateLimit(registry, 2, 2))
 	app.Get("/test", func(c fiber.Ctx) error {
 		return c.SendString("ok")
 	})
@@ -292,12 +312,12 @@ func TestRateLimit_Middleware(t *testing.T) {
 }
 
 func TestRateLimitWithConfig_GlobalLimit(t *testing.T) {
-	limitersMu.Lock()
-	limiters = make(map[string]*ratelimit.TokenBucket)
-	limitersMu.Unlock()
+	registry := NewLimiterRegistry(0)
+	defer registry.Close()
 
 	app := fiber.New()
 	app.Use(RateLimitWithConfig(RateLimitConfig{
+		Registry:    registry,
 		GlobalRPS:   1,
 		GlobalBurst: 1,
 		GlobalKeyBy: "global",
@@ -318,9 +338,8 @@ func TestRateLimitWithConfig_GlobalLimit(t *testing.T) {
 }
 
 func TestRateLimitWithConfig_UserKey(t *testing.T) {
-	limitersMu.Lock()
-	limiters = make(map[string]*ratelimit.TokenBucket)
-	limitersMu.Unlock()
+	registry := NewLimiterRegistry(0)
+	defer registry.Close()
 
 	app := fiber.New()
 	app.Use(func(c fiber.Ctx) error {
@@ -328,6 +347,7 @@ func TestRateLimitWithConfig_UserKey(t *testing.T) {
 		return c.Next()
 	})
 	app.Use(RateLimitWithConfig(RateLimitConfig{
+		Registry:   registry,
 		RouteID:    "/test",
 		RouteRPS:   1,
 		RouteBurst: 1,
@@ -353,6 +373,7 @@ func TestRateLimitWithConfig_UserKey(t *testing.T) {
 		return c.Next()
 	})
 	thirdApp.Use(RateLimitWithConfig(RateLimitConfig{
+		Registry:   registry,
 		RouteID:    "/test",
 		RouteRPS:   1,
 		RouteBurst: 1,
@@ -368,6 +389,846 @@ func TestRateLimitWithConfig_UserKey(t *testing.T) {
 	assert.Equal(t, 200, thirdResp.StatusCode)
 }
 
-func resetGlobalBreaker() {
-	globalCircuitBreaker = nil
+func TestConcurrencyLimit_ShedsWhenSaturated(t *testing.T) {
+	limiter := resilience.NewConcurrencyLimiter(resilience.ConcurrencyOptions{Limit: 1})
+	hold, err := limiter.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer hold(false)
+
+	app := fiber.New()
+	app.Use(ConcurrencyLimit("test", limiter))
+	app.Get("/test", func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+}
+
+func TestConcurrencyLimitByUpstream_UsesPickedUpstream(t *testing.T) {
+	saturated := resilience.NewConcurrencyLimiter(resilience.ConcurrencyOptions{Limit: 1})
+	hold, err := saturated.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer hold(false)
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("upstream", c.Query("upstream"))
+		return c.Next()
+	})
+	app.Use(ConcurrencyLimitByUpstream(map[string]*resilience.ConcurrencyLimiter{
+		"http://a": saturated,
+		"http://b": resilience.NewConcurrencyLimiter(resilience.ConcurrencyOptions{Limit: 1}),
+	}))
+	app.Get("/test", func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/test?upstream=http://a", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+
+	for i := 0; i < 2; i++ {
+		resp, err = app.Test(httptest.NewRequest("GET", "/test?upstream=http://b", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+	}
+}
+
+func TestAdmission_ClassifiesByHeader(t *testing.T) {
+	controller := resilience.NewAdmissionController(resilience.AdmissionOptions{MaxInFlight: 1})
+	defer controller.Close()
+	hold, err := controller.Acquire(0)
+	assert.NoError(t, err)
+	defer hold()
+
+	app := fiber.New()
+	app.Use(Admission(AdmissionConfig{
+		Controller:   controller,
+		DefaultClass: "batch",
+		Classes: []PriorityClass{
+			{Name: "critical", ShedAt: 0},
+			{Name: "batch", ShedAt: 0.8},
+		},
+		Rules: []PriorityRule{
+			{Class: "critical", Header: "X-Priority", HeaderValue: "high"},
+		},
+	}))
+	app.Get("/test", func(c fiber.Ctx) error {
+		return c.SendString(c.Locals(PriorityClassCtxKey).(string))
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Priority", "high")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestLimiterRegistry_ReconfiguresInPlace(t *testing.T) {
+	registry := NewLimiterRegistry(0)
+	defer registry.Close()
+
+	first := registry.Get(RouteLimiterID("/test"), 1, 1, 0)
+	allowed, _ := first.Allow(context.Background(), "key")
+	assert.True(t, allowed)
+
+	second := registry.Get(RouteLimiterID("/test"), 5, 1, 10)
+	assert.Same(t, first, second)
+
+	allowed, _ = second.Allow(context.Background(), "key")
+	assert.False(t, allowed)
+
+	stats := registry.Stats()
+	assert.Len(t, stats, 1)
+	assert.Equal(t, 5, stats[0].RPS)
+	assert.Equal(t, 10, stats[0].MaxKeys)
+	assert.Equal(t, 1, stats[0].TrackedKeys)
+
+	registry.Retain(nil)
+	assert.Empty(t, registry.Stats())
+}
+
+func TestCircuitBreaker_FailureRateWithMinRequests(t *testing.T) {
+	cb := NewCircuitBreakerWithPolicy(CircuitBreakerPolicy{
+		FailureRateThreshold: 0.5,
+		MinRequests:          4,
+		Window:               time.Second,
+		OpenDuration:         time.Minute,
+	})
+
+	cb.Record("up", false)
+	cb.Record("up", false)
+	assert.Equal(t, circuitStateClosed, cb.getCircuit("up").state)
+
+	cb.Record("up", true)
+	cb.Record("up", false)
+	assert.Equal(t, circuitStateOpen, cb.getCircuit("up").state)
+	assert.False(t, cb.Allow("up"))
+}
+
+func TestCircuitBreaker_DefaultOpenDuration(t *testing.T) {
+	cb := NewCircuitBreakerWithPolicy(CircuitBreakerPolicy{ConsecutiveFailures: 1})
+
+	cb.Record("up", false)
+	time.Sleep(5 * time.Millisecond)
+
+	assert.False(t, cb.Allow("up"))
+	assert.Equal(t, circuitStateOpen, cb.getCircuit("up").state)
+}
+
+func TestCircuitBreaker_HalfOpenProbes(t *testing.T) {
+	cb := NewCircuitBreakerWithPolicy(CircuitBreakerPolicy{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Millisecond,
+		HalfOpenRequests:    2,
+	})
+
+	cb.Record("up", false)
+	time.Sleep(5 * time.Millisecond)
+
+	assert.True(t, cb.Allow("up"))
+	assert.True(t, cb.Allow("up"))
+	assert.False(t, cb.Allow("up"))
+
+	cb.Record("up", true)
+	assert.Equal(t, circuitStateHalfOpen, cb.getCircuit("up").state)
+	cb.Record("up", true)
+	assert.Equal(t, circuitStateClosed, cb.getCircuit("up").state)
+}
+
+func TestCircuitBreaker_FailureClassification(t *testing.T) {
+	cb := NewCircuitBreakerWithPolicy(CircuitBreakerPolicy{
+		ConsecutiveFailures: 1,
+		FailureStatusCodes:  []int{503},
+		FailureErrors:       []string{"timeout"},
+	})
+
+	assert.True(t, cb.IsFailure(503, nil))
+	assert.False(t, cb.IsFailure(500, nil))
+	assert.True(t, cb.IsFailure(502, context.DeadlineExceeded))
+	assert.False(t, cb.IsFailure(502, assert.AnError))
+}
+
+func TestCircuitBreaker_ForceOpenAndRelease(t *testing.T) {
+	cb := NewCircuitBreaker(3, time.Minute).Instrument("test-route", zerolog.Nop())
+
+	assert.NoError(t, cb.Force("up", "open"))
+	assert.False(t, cb.Allow("up"))
+
+	cb.Record("up", true)
+	assert.Equal(t, circuitStateOpen, cb.getCircuit("up").state)
+
+	assert.NoError(t, cb.Force("up", "auto"))
+	assert.True(t, cb.Allow("up"))
+
+	assert.ErrorIs(t, cb.Force("up", "sideways"), ErrUnknownCircuitState)
+
+	cb.Upstreams([]string{"up"})
+	assert.ErrorIs(t, cb.Force("elsewhere", "open"), ErrUnknownUpstream)
+
+	statuses := cb.Circuits()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "test-route", statuses[0].Breaker)
+	assert.Equal(t, "closed", statuses[0].State)
+	assert.False(t, statuses[0].Forced)
+}
+
+func TestCircuitBreaker_ForceClosedIgnoresFailures(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Minute)
+
+	assert.NoError(t, cb.Force("up", "closed"))
+	cb.Record("up", false)
+	cb.Record("up", false)
+
+	assert.True(t, cb.Allow("up"))
+}
+
+func TestCache_HitAfterMiss(t *testing.T) {
+	calls := 0
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0), Route: "test"}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		calls++
+		c.Set("Cache-Control", "max-age=60")
+		return c.SendString("payload")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/items?page=1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, CacheMiss, resp.Header.Get(CacheStatusHeader))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/items?page=1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, CacheHit, resp.Header.Get(CacheStatusHeader))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "payload", string(body))
+	assert.Equal(t, 1, calls)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/items?page=2", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, CacheMiss, resp.Header.Get(CacheStatusHeader))
+	assert.Equal(t, 2, calls)
+}
+
+func TestCache_RespectsNoStore(t *testing.T) {
+	calls := 0
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0), TTL: time.Minute}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		calls++
+		c.Set("Cache-Control", "no-store")
+		return c.SendString("secret")
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/x", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, CacheMiss, resp.Header.Get(CacheStatusHeader))
+	}
+	assert.Equal(t, 2, calls)
+
+	req := httptest.NewRequest("GET", "/x", nil)
+	req.Header.Set("Cache-Control", "no-store")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, CacheBypass, resp.Header.Get(CacheStatusHeader))
+}
+
+func TestCache_RevalidatesWithETag(t *testing.T) {
+	var conditional []string
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0)}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		conditional = append(conditional, c.Get("If-None-Match"))
+		c.Set("ETag", `"v1"`)
+		c.Set("Cache-Control", "no-cache")
+		if c.Get("If-None-Match") == `"v1"` {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		return c.SendString("versioned")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/doc", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, CacheMiss, resp.Header.Get(CacheStatusHeader))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/doc", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, CacheRevalidated, resp.Header.Get(CacheStatusHeader))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "versioned", string(body))
+	assert.Equal(t, []string{"", `"v1"`}, conditional)
+
+	req := httptest.NewRequest("GET", "/doc", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotModified, resp.StatusCode)
+}
+
+func TestCache_RevalidatedEntryIgnoresOtherETag(t *testing.T) {
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0)}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		c.Set("ETag", `"v1"`)
+		c.Set("Cache-Control", "no-cache")
+		if c.Get("If-None-Match") == `"v1"` {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		return c.SendString("versioned")
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/doc", nil))
+	assert.NoError(t, err)
+
+	// The client's validator must survive the upstream revalidation, which
+	// rewrites the request headers it was read from.
+	req := httptest.NewRequest("GET", "/doc", nil)
+	req.Header.Set("If-None-Match", `"v0"`)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, CacheRevalidated, resp.Header.Get(CacheStatusHeader))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "versioned", string(body))
+}
+
+func TestCache_Vary(t *testing.T) {
+	calls := 0
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0), TTL: time.Minute}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		calls++
+		c.Set("Vary", "Accept-Language")
+		return c.SendString("lang=" + c.Get("Accept-Language"))
+	})
+
+	for _, lang := range []string{"en", "fr", "en", "fr"} {
+		req := httptest.NewRequest("GET", "/greeting", nil)
+		req.Header.Set("Accept-Language", lang)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "lang="+lang, string(body))
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestCache_PerUserKey(t *testing.T) {
+	calls := 0
+	store := cacheadapter.NewMemoryStore(0)
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("user_claims", map[string]interface{}{"sub": c.Get("X-User")})
+		return c.Next()
+	})
+	app.Use(Cache(CacheConfig{Store: store, KeyClaims: []string{"sub"}}))
+	app.Get("/me", func(c fiber.Ctx) error {
+		calls++
+		c.Set("Cache-Control", "private, max-age=60")
+		return c.SendString("user " + c.Get("X-User"))
+	})
+
+	for _, user := range []string{"alice", "bob", "alice"} {
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("X-User", user)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "user "+user, string(body))
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	calls := 0
+	var refreshes atomic.Int32
+	refresh := func(c fiber.Ctx) func(context.Context, http.Header) (*proxy.Response, error) {
+		return func(ctx context.Context, header http.Header) (*proxy.Response, error) {
+			refreshes.Add(1)
+			h := http.Header{}
+			h.Set("Cache-Control", "max-age=60")
+			return &proxy.Response{StatusCode: 200, Header: h, Body: []byte("fresh")}, nil
+		}
+	}
+
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0), Refresh: refresh}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		calls++
+		c.Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		return c.SendString("original")
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/feed", nil))
+	assert.NoError(t, err)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/feed", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, CacheStale, resp.Header.Get(CacheStatusHeader))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "original", string(body))
+
+	assert.Eventually(t, func() bool {
+		resp, err := app.Test(httptest.NewRequest("GET", "/feed", nil))
+		if err != nil || resp.Header.Get(CacheStatusHeader) != CacheHit {
+			return false
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body) == "fresh"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int32(1), refreshes.Load())
+}
+
+func TestCache_StaleIfError(t *testing.T) {
+	failing := false
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0), StaleIfError: time.Minute}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		if failing {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "service temporarily unavailable"})
+		}
+		c.Set("Cache-Control", "max-age=0")
+		return c.SendString("last good")
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/report", nil))
+	assert.NoError(t, err)
+
+	failing = true
+	resp, err := app.Test(httptest.NewRequest("GET", "/report", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, CacheStale, resp.Header.Get(CacheStatusHeader))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "last good", string(body))
+}
+
+func TestCache_MustRevalidateDisablesStale(t *testing.T) {
+	failing := false
+	app := fiber.New()
+	app.Use(Cache(CacheConfig{Store: cacheadapter.NewMemoryStore(0), StaleIfError: time.Minute}))
+	app.Get("/*", func(c fiber.Ctx) error {
+		if failing {
+			return c.SendStatus(fiber.StatusBadGateway)
+		}
+		c.Set("Cache-Control", "max-age=0, must-revalidate")
+		c.Set("ETag", `"v1"`)
+		return c.SendString("strict")
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/strict", nil))
+	assert.NoError(t, err)
+
+	failing = true
+	resp, err := app.Test(httptest.NewRequest("GET", "/strict", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadGateway, resp.StatusCode)
+}
+
+func TestCoalesce_SharesConcurrentRequests(t *testing.T) {
+	var calls atomic.Int32
+	app := fiber.New()
+	app.Use(Coalesce(CoalesceConfig{
+		Coalescer: resilience.NewCoalescer(0, time.Second),
+		Route:     "test",
+	}))
+	app.Get("/hot", func(c fiber.Ctx) error {
+		calls.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		c.Set("X-Upstream", "yes")
+		return c.SendString("shared")
+	})
+
+	const clients = 5
+	var wg sync.WaitGroup
+	bodies := make(chan string, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.Test(httptest.NewRequest("GET", "/hot", nil))
+			if assert.NoError(t, err) {
+				body, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, "yes", resp.Header.Get("X-Upstream"))
+				bodies <- string(body)
+			}
+		}()
+	}
+	wg.Wait()
+	close(bodies)
+
+	for body := range bodies {
+		assert.Equal(t, "shared", body)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCoalesce_KeepsCredentialsApart(t *testing.T) {
+	var calls atomic.Int32
+	app := fiber.New()
+	app.Use(Coalesce(CoalesceConfig{Coalescer: resilience.NewCoalescer(0, time.Second)}))
+	app.Get("/me", func(c fiber.Ctx) error {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return c.SendString(c.Get("Authorization"))
+	})
+
+	var wg sync.WaitGroup
+	for _, token := range []string{"Bearer a", "Bearer b"} {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/me", nil)
+			req.Header.Set("Authorization", token)
+			resp, err := app.Test(req)
+			if assert.NoError(t, err) {
+				body, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, token, string(body))
+			}
+		}(token)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCoalesce_IgnoresWrites(t *testing.T) {
+	var calls atomic.Int32
+	app := fiber.New()
+	app.Use(Coalesce(CoalesceConfig{Coalescer: resilience.NewCoalescer(0, time.Second)}))
+	app.Post("/orders", func(c fiber.Ctx) error {
+		calls.Add(1)
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(httptest.NewRequest("POST", "/orders", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRouteMatch_Matches(t *testing.T) {
+	match, err := NewRouteMatch(RouteMatchConfig{
+		Hosts:   []string{"api.example.com", "*.tenants.example.com"},
+		Headers: []MatchRule{{Name: "X-API-Version", Value: "2"}, {Name: "X-Client", Regex: `^mobile-`}},
+		Query:   []MatchRule{{Name: "beta"}},
+		Cookies: []MatchRule{{Name: "region", Value: "eu"}},
+	})
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Get("/", func(c fiber.Ctx) error {
+		if match.Matches(c) {
+			return c.SendString("match")
+		}
+		return c.SendString("miss")
+	})
+
+	tests := []struct {
+		name   string
+		host   string
+		url    string
+		header map[string]string
+		want   string
+	}{
+		{"all conditions", "api.example.com:8080", "/?beta", map[string]string{"X-API-Version": "2", "X-Client": "mobile-ios", "Cookie": "region=eu"}, "match"},
+		{"wildcard subdomain", "acme.tenants.example.com", "/?beta=1", map[string]string{"X-API-Version": "2", "X-Client": "mobile-android", "Cookie": "a=b; region=eu"}, "match"},
+		{"wildcard parent", "tenants.example.com", "/?beta", map[string]string{"X-API-Version": "2", "X-Client": "mobile-ios", "Cookie": "region=eu"}, "miss"},
+		{"wrong host", "other.com", "/?beta", map[string]string{"X-API-Version": "2", "X-Client": "mobile-ios", "Cookie": "region=eu"}, "miss"},
+		{"wrong header value", "api.example.com", "/?beta", map[string]string{"X-API-Version": "1", "X-Client": "mobile-ios", "Cookie": "region=eu"}, "miss"},
+		{"regex mismatch", "api.example.com", "/?beta", map[string]string{"X-API-Version": "2", "X-Client": "web", "Cookie": "region=eu"}, "miss"},
+		{"missing query", "api.example.com", "/", map[string]string{"X-API-Version": "2", "X-Client": "mobile-ios", "Cookie": "region=eu"}, "miss"},
+		{"wrong cookie", "api.example.com", "/?beta", map[string]string{"X-API-Version": "2", "X-Client": "mobile-ios", "Cookie": "region=us"}, "miss"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.Host = tt.host
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestRouteMatch_GuardFallsThrough(t *testing.T) {
+	v2, err := NewRouteMatch(RouteMatchConfig{Headers: []MatchRule{{Name: "X-API-Version", Value: "2"}}})
+	assert.NoError(t, err)
+
+	var v2Middleware atomic.Int32
+	v2Handlers := v2.Guard([]fiber.Handler{
+		func(c fiber.Ctx) error {
+			v2Middleware.Add(1)
+			return c.Next()
+		},
+		func(c fiber.Ctx) error { return c.SendString("v2") },
+	})
+
+	app := fiber.New()
+	app.Get("/users", v2Handlers[1], v2Handlers[0])
+	app.Get("/users", func(c fiber.Ctx) error { return c.SendString("v1") })
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-API-Version", "2")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "v2", string(body))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/users", nil))
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, "v1", string(body))
+	assert.Equal(t, int32(1), v2Middleware.Load())
+}
+
+func TestRouteMatch_InvalidRegex(t *testing.T) {
+	_, err := NewRouteMatch(RouteMatchConfig{Headers: []MatchRule{{Name: "X-A", Regex: "("}}})
+	assert.Error(t, err)
+}
+
+func splitBackend(t *testing.T, app *fiber.App, req *http.Request) string {
+	t.Helper()
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestTrafficSplit_StickyUserRamp(t *testing.T) {
+	split := NewTrafficSplit(TrafficSplitConfig{
+		Route:  "/",
+		Sticky: "user",
+		Backends: []Backend{
+			{Name: "stable", Upstream: "http://v1", Weight: 99},
+			{Name: "canary", Upstream: "http://v2", Weight: 1, Canary: true},
+		},
+	})
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("user_id", c.Get("X-User"))
+		return c.Next()
+	})
+	app.Use(split.Handler())
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString(c.Locals("upstream").(string))
+	})
+
+	onCanary := func() map[string]bool {
+		users := make(map[string]bool)
+		for i := 0; i < 500; i++ {
+			user := "user-" + strconv.Itoa(i)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-User", user)
+			if splitBackend(t, app, req) == "http://v2" {
+				users[user] = true
+			}
+		}
+		return users
+	}
+
+	before := onCanary()
+	assert.Equal(t, before, onCanary(), "assignment must be stable")
+
+	assert.NoError(t, split.SetWeights(map[string]int{"stable": 50, "canary": 50}))
+	after := onCanary()
+	assert.Greater(t, len(after), len(before))
+	assert.InDelta(t, 250, len(after), 60)
+	for user := range before {
+		assert.True(t, after[user], "ramping up must keep %s on the canary", user)
+	}
+
+	assert.NoError(t, split.SetWeights(map[string]int{"stable": 0, "canary": 100}))
+	assert.Len(t, onCanary(), 500)
+}
+
+func TestTrafficSplit_Override(t *testing.T) {
+	split := NewTrafficSplit(TrafficSplitConfig{
+		Route: "/",
+		Backends: []Backend{
+			{Name: "stable", Upstream: "http://v1", Weight: 100},
+			{Name: "canary", Upstream: "http://v2", Weight: 0, Canary: true},
+		},
+	})
+	app := fiber.New()
+	app.Use(split.Handler())
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString(c.Locals("upstream").(string))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Canary", "true")
+	assert.Equal(t, "http://v2", splitBackend(t, app, req))
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Canary", "stable")
+	assert.Equal(t, "http://v1", splitBackend(t, app, req))
+
+	assert.Equal(t, "http://v1", splitBackend(t, app, httptest.NewRequest("GET", "/", nil)))
+}
+
+func TestTrafficSplit_StickyCookie(t *testing.T) {
+	split := NewTrafficSplit(TrafficSplitConfig{
+		Route:  "/",
+		Sticky: "cookie",
+		Backends: []Backend{
+			{Name: "stable", Upstream: "http://v1", Weight: 50},
+			{Name: "canary", Upstream: "http://v2", Weight: 50},
+		},
+	})
+	app := fiber.New()
+	app.Use(split.Handler())
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString(c.Locals("upstream").(string))
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == DefaultSplitCookie {
+			cookie = c
+		}
+	}
+	if assert.NotNil(t, cookie) {
+		body, _ := io.ReadAll(resp.Body)
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(cookie)
+			assert.Equal(t, string(body), splitBackend(t, app, req))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultSplitCookie, Value: "9999"})
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Cookies())
+}
+
+func TestTrafficSplit_SetWeightsErrors(t *testing.T) {
+	split := NewTrafficSplit(TrafficSplitConfig{
+		Backends: []Backend{{Name: "a", Upstream: "http://a", Weight: 1}},
+	})
+
+	assert.ErrorIs(t, split.SetWeights(map[string]int{"b": 1}), ErrInvalidWeights)
+	assert.ErrorIs(t, split.SetWeights(map[string]int{"a": -1}), ErrInvalidWeights)
+	assert.ErrorIs(t, split.SetWeights(map[string]int{"a": 0}), ErrInvalidWeights)
+	assert.Equal(t, 1, split.Status().Backends[0].Weight)
+}
+
+func TestMaintenance(t *testing.T) {
+	m, err := NewMaintenance(MaintenanceConfig{Route: "/", RetryAfter: 1500 * time.Millisecond})
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(m.Handler())
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	m.SetEnabled(true)
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, defaultMaintenanceBody, string(body))
+	assert.Equal(t, MaintenanceStatus{Route: "/", Enabled: true}, m.Status())
+}
+
+func TestMaintenance_AllowIPs(t *testing.T) {
+	_, err := NewMaintenance(MaintenanceConfig{AllowIPs: []string{"not-an-ip"}})
+	assert.Error(t, err)
+
+	m, err := NewMaintenance(MaintenanceConfig{Enabled: true, Body: "back soon", AllowIPs: []string{"10.0.0.0/8", "0.0.0.0"}})
+	assert.NoError(t, err)
+	assert.True(t, m.allowed("10.1.2.3"))
+	assert.True(t, m.allowed("::ffff:10.1.2.3"))
+	assert.False(t, m.allowed("192.168.1.1"))
+
+	app := fiber.New()
+	app.Use(m.Handler())
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	// app.Test connects from 0.0.0.0.
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	m, err = NewMaintenance(MaintenanceConfig{Enabled: true, Body: "back soon"})
+	assert.NoError(t, err)
+	app = fiber.New()
+	app.Use(m.Handler())
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, fiber.MIMETextPlainCharsetUTF8, resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Retry-After"))
+}
+
+func TestAdminToken(t *testing.T) {
+	app := fiber.New()
+	app.Get("/admin/routes", func(c fiber.Ctx) error {
+		return c.SendString(GetUserID(c))
+	}, AdminToken("s3cret"))
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{"valid", "Bearer s3cret", 200},
+		{"missing", "", 401},
+		{"wrong token", "Bearer nope", 401},
+		{"wrong scheme", "Basic s3cret", 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/routes", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/admin/routes", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	req.Header.Set(AdminUserHeader, "ann")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "ann", string(body))
 }
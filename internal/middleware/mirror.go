@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+var (
+	mirrorRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mirror_requests_total",
+			Help: "Shadow requests by outcome",
+		},
+		[]string{"route", "outcome"},
+	)
+
+	mirrorComparisons = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mirror_comparisons_total",
+			Help: "Shadow responses compared with the primary response",
+		},
+		[]string{"route", "result"},
+	)
+
+	compareRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "compare_requests_total",
+			Help: "Compare mode requests to the new backend by outcome",
+		},
+		[]string{"route", "outcome"},
+	)
+
+	compareResults = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "compare_results_total",
+			Help: "Compare mode responses matching or differing from the primary",
+		},
+		[]string{"route", "result"},
+	)
+
+	compareDifferences = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "compare_differences_total",
+			Help: "Compare mode differences by kind (status, header, body)",
+		},
+		[]string{"route", "kind"},
+	)
+)
+
+// MirrorMetrics records the outcome of a route's shadow requests.
+type MirrorMetrics string
+
+func (m MirrorMetrics) Mirrored(outcome string) {
+	mirrorRequests.WithLabelValues(string(m), outcome).Inc()
+}
+
+func (m MirrorMetrics) Compared(method, path string, differences []string) {
+	mirrorComparisons.WithLabelValues(string(m), comparisonResult(differences)).Inc()
+}
+
+func comparisonResult(differences []string) string {
+	if len(differences) == 0 {
+		return "match"
+	}
+	return "diff"
+}
+
+// CompareLog records compare mode results for a route and logs every
+// response that differs from the primary one.
+type CompareLog struct {
+	Route  string
+	Logger zerolog.Logger
+}
+
+func (l CompareLog) Mirrored(outcome string) {
+	compareRequests.WithLabelValues(l.Route, outcome).Inc()
+}
+
+func (l CompareLog) Compared(method, path string, differences []string) {
+	compareResults.WithLabelValues(l.Route, comparisonResult(differences)).Inc()
+	if len(differences) == 0 {
+		return
+	}
+
+	for _, difference := range differences {
+		kind, _, _ := strings.Cut(difference, " ")
+		compareDifferences.WithLabelValues(l.Route, kind).Inc()
+	}
+	l.Logger.Warn().
+		Str("route", l.Route).
+		Str("method", method).
+		Str("path", path).
+		Strs("differences", differences).
+		Msg("compare mode response mismatch")
+}
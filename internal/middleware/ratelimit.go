@@ -2,31 +2,176 @@ package middleware
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"api-gateway/internal/adapter/ratelimit"
 )
 
 var (
-	limiters   = make(map[string]*ratelimit.TokenBucket)
-	limitersMu sync.RWMutex
+	rateLimiterKeys = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rate_limiter_tracked_keys",
+			Help: "Number of keys tracked per rate limiter",
+		},
+		[]string{"limiter"},
+	)
+
+	rateLimiterEvictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limiter_evictions_total",
+			Help: "Keys evicted from a rate limiter because it reached max_keys",
+		},
+		[]string{"limiter"},
+	)
+)
+
+const (
+	GlobalLimiterID       = "global"
+	DefaultLimiterMaxKeys = 100000
 )
 
 type RateLimitConfig struct {
-	RouteID     string
-	RouteRPS    int
-	RouteBurst  int
-	RouteKeyBy  string
-	GlobalRPS   int
-	GlobalBurst int
-	GlobalKeyBy string
+	Registry      *LimiterRegistry
+	RouteID       string
+	RouteRPS      int
+	RouteBurst    int
+	RouteKeyBy    string
+	RouteMaxKeys  int
+	GlobalRPS     int
+	GlobalBurst   int
+	GlobalKeyBy   string
+	GlobalMaxKeys int
+}
+
+type LimiterStats struct {
+	ID          string `json:"id"`
+	RPS         int    `json:"rps"`
+	Burst       int    `json:"burst"`
+	MaxKeys     int    `json:"max_keys"`
+	TrackedKeys int    `json:"tracked_keys"`
+}
+
+// LimiterRegistry owns the token buckets shared by rate limit middleware.
+// Limiters are keyed by ID; asking for an existing ID with different limits
+// reconfigures it in place so per-key counters survive. A maxKeys of zero
+// falls back to the registry default.
+type LimiterRegistry struct {
+	mu       sync.Mutex
+	limiters map[string]*ratelimit.TokenBucket
+	maxKeys  int
+	closed   bool
+}
+
+func NewLimiterRegistry(maxKeys int) *LimiterRegistry {
+	return &LimiterRegistry{
+		limiters: make(map[string]*ratelimit.TokenBucket),
+		maxKeys:  maxKeys,
+	}
+}
+
+func (r *LimiterRegistry) Get(id string, rps, burst, maxKeys int) *ratelimit.TokenBucket {
+	if maxKeys <= 0 {
+		maxKeys = r.maxKeys
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if limiter, exists := r.limiters[id]; exists {
+		if curRPS, curBurst := limiter.Limits(); curRPS != rps || curBurst != burst {
+			limiter.SetLimits(rps, burst)
+		}
+		if limiter.MaxKeys() != maxKeys {
+			limiter.SetMaxKeys(maxKeys)
+		}
+		return limiter
+	}
+
+	limiter := ratelimit.NewTokenBucketWithOptions(ratelimit.Options{
+		RPS:      rps,
+		Burst:    burst,
+		MaxKeys:  maxKeys,
+		Observer: limiterObserver(id),
+	})
+	if r.closed {
+		limiter.Close()
+	}
+	r.limiters[id] = limiter
+	return limiter
 }
 
-func RateLimit(rps, burst int) fiber.Handler {
+// Retain closes and drops every limiter whose ID is not listed.
+func (r *LimiterRegistry) Retain(ids []string) {
+	keep := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		keep[id] = struct{}{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, limiter := range r.limiters {
+		if _, ok := keep[id]; !ok {
+			limiter.Close()
+			delete(r.limiters, id)
+			rateLimiterKeys.DeleteLabelValues(id)
+		}
+	}
+}
+
+func (r *LimiterRegistry) Stats() []LimiterStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]LimiterStats, 0, len(r.limiters))
+	for id, limiter := range r.limiters {
+		rps, burst := limiter.Limits()
+		stats = append(stats, LimiterStats{
+			ID:          id,
+			RPS:         rps,
+			Burst:       burst,
+			MaxKeys:     limiter.MaxKeys(),
+			TrackedKeys: limiter.Len(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+func (r *LimiterRegistry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	for id, limiter := range r.limiters {
+		limiter.Close()
+		rateLimiterKeys.DeleteLabelValues(id)
+	}
+}
+
+type limiterObserver string
+
+func (o limiterObserver) KeysChanged(n int) {
+	rateLimiterKeys.WithLabelValues(string(o)).Set(float64(n))
+}
+
+func (o limiterObserver) KeyEvicted() {
+	rateLimiterEvictions.WithLabelValues(string(o)).Inc()
+}
+
+func RouteLimiterID(routeID string) string {
+	return "route:" + routeID
+}
+
+func RateLimit(registry *LimiterRegistry, rps, burst int) fiber.Handler {
 	return RateLimitWithConfig(RateLimitConfig{
+		Registry:   registry,
 		RouteID:    "legacy",
 		RouteRPS:   rps,
 		RouteBurst: burst,
@@ -34,10 +179,24 @@ func RateLimit(rps, burst int) fiber.Handler {
 	})
 }
 
+// RateLimitWithConfig limits requests with buckets from cfg.Registry, which
+// is required: the caller owns and closes it.
 func RateLimitWithConfig(cfg RateLimitConfig) fiber.Handler {
+	registry := cfg.Registry
+	if registry == nil {
+		panic("middleware: RateLimitConfig.Registry is required")
+	}
+
+	var globalLimiter, routeLimiter *ratelimit.TokenBucket
+	if cfg.GlobalRPS > 0 && cfg.GlobalBurst > 0 {
+		globalLimiter = registry.Get(GlobalLimiterID, cfg.GlobalRPS, cfg.GlobalBurst, cfg.GlobalMaxKeys)
+	}
+	if cfg.RouteRPS > 0 && cfg.RouteBurst > 0 && cfg.RouteID != "" {
+		routeLimiter = registry.Get(RouteLimiterID(cfg.RouteID), cfg.RouteRPS, cfg.RouteBurst, cfg.RouteMaxKeys)
+	}
+
 	return func(c fiber.Ctx) error {
-		if cfg.GlobalRPS > 0 && cfg.GlobalBurst > 0 {
-			globalLimiter := getLimiter("global", cfg.GlobalRPS, cfg.GlobalBurst)
+		if globalLimiter != nil {
 			globalKey := buildRateLimitKey(c, cfg.GlobalKeyBy)
 			if allowed, err := globalLimiter.Allow(context.Background(), globalKey); err != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -52,14 +211,13 @@ func RateLimitWithConfig(cfg RateLimitConfig) fiber.Handler {
 		}
 
 		if cfg.RouteRPS > 0 && cfg.RouteBurst > 0 {
-			routeID := cfg.RouteID
-			if routeID == "" {
-				routeID = c.Route().Path
+			limiter := routeLimiter
+			if limiter == nil {
+				limiter = registry.Get(RouteLimiterID(c.Route().Path), cfg.RouteRPS, cfg.RouteBurst, cfg.RouteMaxKeys)
 			}
 
-			routeLimiter := getLimiter("route:"+routeID, cfg.RouteRPS, cfg.RouteBurst)
 			routeKey := buildRateLimitKey(c, cfg.RouteKeyBy)
-			allowed, err := routeLimiter.Allow(context.Background(), routeKey)
+			allowed, err := limiter.Allow(context.Background(), routeKey)
 			if err != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"error": "rate limit error",
@@ -78,27 +236,6 @@ func RateLimitWithConfig(cfg RateLimitConfig) fiber.Handler {
 	}
 }
 
-func getLimiter(id string, rps, burst int) *ratelimit.TokenBucket {
-	limitersMu.RLock()
-	limiter, exists := limiters[id]
-	limitersMu.RUnlock()
-
-	if exists {
-		return limiter
-	}
-
-	limitersMu.Lock()
-	defer limitersMu.Unlock()
-
-	if limiter, exists = limiters[id]; exists {
-		return limiter
-	}
-
-	limiter = ratelimit.NewTokenBucket(rps, burst)
-	limiters[id] = limiter
-	return limiter
-}
-
 func buildRateLimitKey(c fiber.Ctx, strategy string) string {
 	mode := strings.ToLower(strings.TrimSpace(strategy))
 	switch mode {
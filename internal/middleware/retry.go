@@ -4,20 +4,40 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v3"
+
+	"api-gateway/internal/adapter/resilience"
 )
 
+const RetryPolicyCtxKey = "retry_policy"
+
 type RetryConfig struct {
-	Attempts   int
-	Backoff    time.Duration
-	MaxBackoff time.Duration
+	Attempts            int
+	Backoff             time.Duration
+	MaxBackoff          time.Duration
+	Jitter              bool
+	PerTryTimeout       time.Duration
+	RetryOn             []string
+	Methods             []string
+	AllowIdempotencyKey bool
+	Budget              *resilience.RetryBudget
 }
 
 func Retry(cfg RetryConfig) fiber.Handler {
+	policy := resilience.NewRetryPolicy(resilience.RetryPolicyOptions{
+		Attempts:            cfg.Attempts,
+		Backoff:             cfg.Backoff,
+		MaxBackoff:          cfg.MaxBackoff,
+		Jitter:              cfg.Jitter,
+		PerTryTimeout:       cfg.PerTryTimeout,
+		RetryOn:             cfg.RetryOn,
+		Methods:             cfg.Methods,
+		AllowIdempotencyKey: cfg.AllowIdempotencyKey,
+		Budget:              cfg.Budget,
+	})
+
 	return func(c fiber.Ctx) error {
 		if cfg.Attempts > 0 {
-			c.Locals("retry_attempts", cfg.Attempts)
-			c.Locals("retry_backoff", cfg.Backoff)
-			c.Locals("retry_max_backoff", cfg.MaxBackoff)
+			c.Locals(RetryPolicyCtxKey, policy)
 		}
 
 		return c.Next()
@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const BackendCtxKey = "backend"
+
+const (
+	DefaultSplitCookie         = "gw_split"
+	DefaultSplitOverrideHeader = "X-Canary"
+
+	// splitBuckets is the resolution of sticky assignment; weights are
+	// spread over this many buckets.
+	splitBuckets = 10000
+)
+
+var (
+	splitRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "split_requests_total",
+			Help: "Requests per traffic split backend",
+		},
+		[]string{"route", "backend", "status"},
+	)
+
+	splitRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "split_request_duration_seconds",
+			Help:    "Request duration per traffic split backend",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"route", "backend"},
+	)
+)
+
+var ErrInvalidWeights = errors.New("invalid split weights")
+
+type Backend struct {
+	Name     string
+	Upstream string
+	Weight   int
+	// Canary marks the backend X-Canary: true selects.
+	Canary bool
+}
+
+type TrafficSplitConfig struct {
+	Route    string
+	Backends []Backend
+	// Sticky is "user" (hash of the JWT user ID), "cookie" (a bucket kept in
+	// Cookie) or empty for an independent pick per request.
+	Sticky         string
+	Cookie         string
+	OverrideHeader string
+}
+
+type SplitStatus struct {
+	Route    string          `json:"route"`
+	Sticky   string          `json:"sticky,omitempty"`
+	Backends []BackendStatus `json:"backends"`
+}
+
+type BackendStatus struct {
+	Name     string `json:"name"`
+	Upstream string `json:"upstream"`
+	Weight   int    `json:"weight"`
+	Canary   bool   `json:"canary,omitempty"`
+}
+
+// TrafficSplit routes each request of a route to one of several backends by
+// weight. Requests are hashed into buckets and the buckets assigned in
+// backend order, so raising a later backend's weight only moves users onto
+// it and never reshuffles those already there.
+type TrafficSplit struct {
+	cfg TrafficSplitConfig
+
+	mu      sync.RWMutex
+	weights []int
+}
+
+func NewTrafficSplit(cfg TrafficSplitConfig) *TrafficSplit {
+	if cfg.Cookie == "" {
+		cfg.Cookie = DefaultSplitCookie
+	}
+	if cfg.OverrideHeader == "" {
+		cfg.OverrideHeader = DefaultSplitOverrideHeader
+	}
+
+	weights := make([]int, len(cfg.Backends))
+	for i, backend := range cfg.Backends {
+		weights[i] = backend.Weight
+	}
+
+	return &TrafficSplit{cfg: cfg, weights: weights}
+}
+
+func (s *TrafficSplit) Handler() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		backend, newBucket := s.pick(c)
+		c.Locals("upstream", backend.Upstream)
+		c.Locals(BackendCtxKey, backend.Name)
+
+		start := time.Now()
+		err := c.Next()
+
+		// Set after the chain: the proxy replaces the whole response.
+		if newBucket >= 0 {
+			c.Cookie(&fiber.Cookie{
+				Name:     s.cfg.Cookie,
+				Value:    strconv.Itoa(newBucket),
+				Path:     "/",
+				MaxAge:   int((30 * 24 * time.Hour).Seconds()),
+				HTTPOnly: true,
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+		}
+
+		splitRequests.WithLabelValues(s.cfg.Route, backend.Name, statusToString(c.Response().StatusCode())).Inc()
+		splitRequestDuration.WithLabelValues(s.cfg.Route, backend.Name).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// SetWeights replaces the weights of the named backends; backends left out
+// keep theirs.
+func (s *TrafficSplit) SetWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := append([]int(nil), s.weights...)
+	for name, weight := range weights {
+		i := s.index(name)
+		if i < 0 {
+			return fmt.Errorf("%w: unknown backend %q", ErrInvalidWeights, name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("%w: negative weight for %q", ErrInvalidWeights, name)
+		}
+		next[i] = weight
+	}
+
+	total := 0
+	for _, weight := range next {
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("%w: weights must not all be zero", ErrInvalidWeights)
+	}
+
+	s.weights = next
+	return nil
+}
+
+func (s *TrafficSplit) Status() SplitStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := SplitStatus{Route: s.cfg.Route, Sticky: s.cfg.Sticky}
+	for i, backend := range s.cfg.Backends {
+		status.Backends = append(status.Backends, BackendStatus{
+			Name:     backend.Name,
+			Upstream: backend.Upstream,
+			Weight:   s.weights[i],
+			Canary:   backend.Canary,
+		})
+	}
+	return status
+}
+
+// pick returns the backend for a request and, when a new sticky bucket was
+// drawn for the cookie, that bucket (otherwise -1).
+func (s *TrafficSplit) pick(c fiber.Ctx) (Backend, int) {
+	if value := c.Get(s.cfg.OverrideHeader); value != "" {
+		if backend, ok := s.override(value); ok {
+			return backend, -1
+		}
+	}
+
+	newBucket := -1
+	var bucket int
+	switch s.cfg.Sticky {
+	case "user":
+		if userID := GetUserID(c); userID != "" {
+			h := fnv.New32a()
+			h.Write([]byte(userID))
+			bucket = int(h.Sum32() % splitBuckets)
+		} else {
+			bucket = rand.IntN(splitBuckets)
+		}
+	case "cookie":
+		if n, err := strconv.Atoi(c.Cookies(s.cfg.Cookie)); err == nil && n >= 0 && n < splitBuckets {
+			bucket = n
+		} else {
+			bucket = rand.IntN(splitBuckets)
+			newBucket = bucket
+		}
+	default:
+		bucket = rand.IntN(splitBuckets)
+	}
+
+	return s.backendAt(bucket), newBucket
+}
+
+// override honours X-Canary: "true" picks the canary backend, "false" the
+// first other one, and a backend name picks that backend, whatever its
+// weight.
+func (s *TrafficSplit) override(value string) (Backend, bool) {
+	for _, backend := range s.cfg.Backends {
+		switch {
+		case strings.EqualFold(value, "true") && backend.Canary,
+			strings.EqualFold(value, "false") && !backend.Canary,
+			value == backend.Name:
+			return backend, true
+		}
+	}
+	return Backend{}, false
+}
+
+func (s *TrafficSplit) backendAt(bucket int) Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total := 0
+	for _, weight := range s.weights {
+		total += weight
+	}
+	if total == 0 {
+		return s.cfg.Backends[0]
+	}
+
+	point := bucket * total / splitBuckets
+	for i, weight := range s.weights {
+		if point < weight {
+			return s.cfg.Backends[i]
+		}
+		point -= weight
+	}
+	return s.cfg.Backends[len(s.cfg.Backends)-1]
+}
+
+func (s *TrafficSplit) index(name string) int {
+	for i, backend := range s.cfg.Backends {
+		if backend.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"api-gateway/internal/adapter/proxy"
+	"api-gateway/internal/handler"
+	"api-gateway/internal/middleware"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// upstreamProbeTimeout bounds each request made by an upstream probe.
+const upstreamProbeTimeout = 2 * time.Second
+
+// SetReloader enables POST /admin/reload. Call it before Setup or
+// MountAdmin.
+func (r *Router) SetReloader(reload handler.ReloadHandler) {
+	r.reload = reload
+}
+
+// SetRouteEditor enables route changes through the admin API when the
+// config has a route store. Call it before Setup or MountAdmin.
+func (r *Router) SetRouteEditor(editor handler.RouteEditor) {
+	r.editor = editor
+}
+
+// MountAdmin registers the admin API on group, which must already carry
+// its authentication.
+func (r *Router) MountAdmin(group fiber.Router) {
+	group.Get("/config", handler.EffectiveConfig(r))
+	group.Get("/routes", handler.Routes(r))
+	group.Get("/upstreams", handler.Upstreams(r))
+	group.Get("/limiters", handler.Limiters(r))
+	if r.reload != nil {
+		group.Post("/reload", handler.Reload(r.reload))
+	}
+	if r.editor != nil && r.cfg.Load().RouteStore != nil {
+		group.Get("/route", handler.GetRoute(r.editor))
+		group.Post("/route", handler.CreateRoute(r.editor))
+		group.Put("/route", handler.UpdateRoute(r.editor))
+		group.Delete("/route", handler.DeleteRoute(r.editor))
+		group.Get("/audit", handler.RouteChanges(r.editor))
+	}
+
+	group.Get("/circuits", handler.Circuits(r))
+	group.Post("/circuits/force", handler.ForceCircuit(r))
+	group.Post("/cache/purge", handler.PurgeCache(r))
+	group.Get("/mirror/diffs", handler.MirrorDiffs(r))
+	group.Get("/splits", handler.Splits(r))
+	group.Put("/splits/weights", handler.SetSplitWeights(r))
+	group.Get("/maintenance", handler.Maintenance(r))
+	group.Put("/maintenance", handler.SetMaintenance(r))
+}
+
+func (r *Router) EffectiveConfig() map[string]interface{} {
+	return r.cfg.Load().Redacted()
+}
+
+// RouteTable lists routes in the order they are matched.
+func (r *Router) RouteTable() []handler.RouteInfo {
+	routes := orderRoutes(r.cfg.Load().Routes)
+	table := make([]handler.RouteInfo, 0, len(routes))
+	for _, route := range routes {
+		table = append(table, handler.RouteInfo{
+			ID:           route.ID(),
+			Path:         route.Path,
+			Methods:      route.MethodList(),
+			Kind:         route.Kind(),
+			Upstreams:    route.Upstreams(),
+			AuthRequired: route.AuthRequired,
+		})
+	}
+	return table
+}
+
+// UpstreamHealth reports every upstream the routes forward to. An upstream
+// is healthy while none of its circuits is open and, when probed, it
+// answered at all; any status code counts as reachable.
+func (r *Router) UpstreamHealth(probe bool) []handler.UpstreamHealth {
+	index := make(map[string]int)
+	health := []handler.UpstreamHealth{}
+	for _, route := range r.cfg.Load().Routes {
+		for _, upstream := range route.Upstreams() {
+			i, ok := index[upstream]
+			if !ok {
+				i = len(health)
+				index[upstream] = i
+				health = append(health, handler.UpstreamHealth{
+					Upstream: upstream,
+					Routes:   []string{},
+					Circuits: []middleware.CircuitStatus{},
+					Healthy:  true,
+				})
+			}
+			health[i].Routes = append(health[i].Routes, route.ID())
+		}
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].Upstream < health[j].Upstream })
+
+	for _, circuit := range r.Circuits() {
+		for i := range health {
+			if health[i].Upstream == circuit.Upstream {
+				health[i].Circuits = append(health[i].Circuits, circuit)
+				if circuit.Open() {
+					health[i].Healthy = false
+				}
+			}
+		}
+	}
+
+	if probe {
+		var wg sync.WaitGroup
+		for i := range health {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.probe(&health[i])
+			}()
+		}
+		wg.Wait()
+	}
+	return health
+}
+
+func (r *Router) probe(health *handler.UpstreamHealth) {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := r.proxy.Do(ctx, proxy.NewRequest(http.MethodGet, health.Upstream, nil))
+	health.LatencyMs = time.Since(start).Milliseconds()
+
+	reachable := err == nil
+	health.Reachable = &reachable
+	if err != nil {
+		health.Error = err.Error()
+		health.Healthy = false
+		return
+	}
+	health.Status = resp.StatusCode
+}
+
+func (r *Router) LimiterStats() []middleware.LimiterStats {
+	return r.state.limiters.Stats()
+}
@@ -1,9 +1,17 @@
 package router
 
 import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"api-gateway/internal/adapter/cache"
 	"api-gateway/internal/adapter/proxy"
+	"api-gateway/internal/adapter/resilience"
+	"api-gateway/internal/domain"
 	"api-gateway/internal/domain/config"
 	"api-gateway/internal/handler"
 	"api-gateway/internal/middleware"
@@ -12,29 +20,87 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// mirrorDiffLogSize is how many shadow response diffs are kept for review.
+const mirrorDiffLogSize = 200
+
 type Router struct {
-	app    *fiber.App
-	cfg    *config.Config
-	logger zerolog.Logger
-	proxy  *proxy.HTTPClient
+	app *fiber.App
+	// cfg changes in place when only split weights do, while the admin
+	// API reads it.
+	cfg         atomic.Pointer[config.Config]
+	logger      zerolog.Logger
+	proxy       *proxy.HTTPClient
+	state       *State
+	limiterIDs  []string
+	concurrency map[string]*resilience.ConcurrencyLimiter
+	admission   *resilience.AdmissionController
+	breakers    map[string]*middleware.CircuitBreaker
+	splits      map[string]*middleware.TrafficSplit
+	cache       *cache.MemoryStore
+	diffs       *proxy.DiffLog
+	maintenance map[string]*middleware.Maintenance
+	reload      handler.ReloadHandler
+	editor      handler.RouteEditor
 }
 
-func New(app *fiber.App, cfg *config.Config, logger zerolog.Logger) *Router {
+// New builds a router for cfg. state is shared by the routers of successive
+// configs, so what it holds survives reloads; the caller closes it.
+func New(app *fiber.App, cfg *config.Config, logger zerolog.Logger, state *State) *Router {
+	trusted, err := proxy.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		logger.Error().Err(err).Msg("ignoring invalid trusted proxies")
+	}
+
 	httpClient := proxy.NewHTTPClient(proxy.Options{
-		DialTimeout:         5,
-		ReadTimeout:         10,
-		WriteTimeout:        10,
-		IdleConnTimeout:     30,
+		DialTimeout:         5 * time.Second,
+		ReadTimeout:         10 * time.Second,
+		WriteTimeout:        10 * time.Second,
+		IdleConnTimeout:     30 * time.Second,
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 100,
+		TrustedProxies:      trusted,
 	})
 
-	return &Router{
-		app:    app,
-		cfg:    cfg,
-		logger: logger,
-		proxy:  httpClient,
+	r := &Router{
+		app:         app,
+		logger:      logger,
+		proxy:       httpClient,
+		state:       state,
+		concurrency: make(map[string]*resilience.ConcurrencyLimiter),
+		breakers:    make(map[string]*middleware.CircuitBreaker),
+		splits:      make(map[string]*middleware.TrafficSplit),
+		diffs:       proxy.NewDiffLog(mirrorDiffLogSize),
+		maintenance: make(map[string]*middleware.Maintenance),
+	}
+
+	r.cfg.Store(cfg)
+
+	var cacheBytes int64
+	if cfg.Cache != nil {
+		cacheBytes = cfg.Cache.MaxBytes
+	}
+	r.cache = cache.NewMemoryStore(cacheBytes)
+
+	if cfg.Admission != nil {
+		r.admission = resilience.NewAdmissionController(resilience.AdmissionOptions{
+			MaxInFlight:    cfg.Admission.MaxInFlight,
+			CPUThreshold:   cfg.Admission.CPUThreshold,
+			SampleInterval: cfg.Admission.SampleInterval(),
+		})
 	}
+
+	return r
+}
+
+func (r *Router) Close() {
+	if r.admission != nil {
+		r.admission.Close()
+	}
+	r.proxy.Close()
+}
+
+func (r *Router) Limiters() *middleware.LimiterRegistry {
+	return r.state.limiters
 }
 
 func (r *Router) Setup() {
@@ -44,104 +110,793 @@ func (r *Router) Setup() {
 	r.app.Get("/docs", handler.SwaggerUI())
 	r.app.Get("/openapi.json", handler.OpenAPI())
 
+	// With a separate admin listener the server mounts the admin API there
+	// instead.
+	if cfg := r.cfg.Load(); cfg.Server.Admin == nil {
+		r.MountAdmin(r.app.Group("/admin", middleware.JWT(middleware.JWTConfig{
+			Secret: cfg.JWT.Secret,
+			Issuer: cfg.JWT.Issuer,
+		}), middleware.RequireAdmin()))
+	}
+
 	r.setupRoutes()
 }
 
+func (r *Router) Circuits() []middleware.CircuitStatus {
+	names := make([]string, 0, len(r.breakers))
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := []middleware.CircuitStatus{}
+	for _, name := range names {
+		statuses = append(statuses, r.breakers[name].Circuits()...)
+	}
+	return statuses
+}
+
+func (r *Router) ForceCircuit(breaker, upstream, state string) error {
+	cb, ok := r.breakers[breaker]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	return cb.Force(upstream, state)
+}
+
+func (r *Router) PurgeCache(prefix string) int {
+	return r.cache.Purge(context.Background(), prefix)
+}
+
+func (r *Router) MirrorDiffs() []proxy.ResponseDiff {
+	return r.diffs.Entries()
+}
+
+func (r *Router) Splits() []middleware.SplitStatus {
+	names := make([]string, 0, len(r.splits))
+	for name := range r.splits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := []middleware.SplitStatus{}
+	for _, name := range names {
+		statuses = append(statuses, r.splits[name].Status())
+	}
+	return statuses
+}
+
+func (r *Router) SetSplitWeights(route string, weights map[string]int) error {
+	split, ok := r.splits[route]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	return split.SetWeights(weights)
+}
+
+// Maintenance lists the global maintenance switch, named
+// middleware.GlobalMaintenance, followed by every route's.
+func (r *Router) Maintenance() []middleware.MaintenanceStatus {
+	names := make([]string, 0, len(r.maintenance))
+	for name := range r.maintenance {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := []middleware.MaintenanceStatus{}
+	for _, name := range names {
+		statuses = append(statuses, r.maintenance[name].Status())
+	}
+	return statuses
+}
+
+func (r *Router) SetMaintenance(route string, enabled bool) error {
+	m, ok := r.maintenance[route]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	m.SetEnabled(enabled)
+	r.state.setMaintenance(route, enabled)
+	return nil
+}
+
+// UpdateWeights applies next in place when it only changes traffic split
+// weights, and reports whether it did; anything else needs a rebuild.
+func (r *Router) UpdateWeights(next *config.Config) bool {
+	if !config.SameExceptWeights(r.cfg.Load(), next) {
+		return false
+	}
+
+	for _, route := range next.Routes {
+		split, ok := r.splits[route.ID()]
+		if !ok || route.Split == nil {
+			continue
+		}
+		weights := make(map[string]int, len(route.Split.Backends))
+		for _, backend := range route.Split.Backends {
+			weights[backend.Name] = backend.Weight
+		}
+		if err := split.SetWeights(weights); err != nil {
+			r.logger.Error().Err(err).Str("route", route.Path).Msg("failed to update split weights")
+			return false
+		}
+	}
+
+	r.cfg.Store(next)
+	return true
+}
+
 func (r *Router) setupRoutes() {
-	for _, route := range r.cfg.Routes {
-		methods := route.Methods
-		if len(methods) == 0 {
-			methods = []string{"GET"}
+	r.limiterIDs = r.limiterIDs[:0]
+	defer func() {
+		r.state.limiters.Retain(r.limiterIDs)
+		r.state.retainMaintenance(r.maintenance)
+		r.state.retainBreakers(r.breakers)
+		r.state.retainConcurrency(r.concurrency)
+	}()
+
+	cfg := r.cfg.Load()
+	routes := orderRoutes(cfg.Routes)
+	r.maintenanceSwitch(middleware.GlobalMaintenance, cfg.Maintenance, nil)
+
+	// HEAD is derived from GET unless some route declares it for the same
+	// path and match conditions.
+	explicitHead := make(map[string]bool)
+	var paths []string
+	seenPaths := make(map[string]bool)
+	for _, route := range routes {
+		for _, method := range route.MethodList() {
+			if method == fiber.MethodHead || method == config.MethodAny {
+				explicitHead[route.MatchID()] = true
+			}
 		}
+		if !seenPaths[route.Path] {
+			seenPaths[route.Path] = true
+			paths = append(paths, route.Path)
+		}
+	}
+
+	for _, route := range routes {
+		methods := route.MethodList()
 
 		handlers := r.buildMiddlewareList(&route)
+		if route.Match != nil {
+			match, err := r.routeMatch(&route)
+			if err != nil {
+				r.logger.Error().Err(err).Str("route", route.Path).Msg("invalid match, route disabled")
+				continue
+			}
+			handlers = match.Guard(handlers)
+		}
 
-		for _, method := range methods {
-			switch method {
-			case "GET":
-				r.app.Get(route.Path, handlers[0], handlers[1:]...)
-			case "POST":
-				r.app.Post(route.Path, handlers[0], handlers[1:]...)
-			case "PUT":
-				r.app.Put(route.Path, handlers[0], handlers[1:]...)
-			case "DELETE":
-				r.app.Delete(route.Path, handlers[0], handlers[1:]...)
-			case "PATCH":
-				r.app.Patch(route.Path, handlers[0], handlers[1:]...)
+		// Fiber appends the handler argument after the middleware, so the
+		// proxy goes last and everything before it runs in order.
+		last := len(handlers) - 1
+		handler, chain := handlers[last], handlers[:last]
+
+		if slices.Contains(methods, config.MethodAny) {
+			r.app.All(route.Path, handler, chain...)
+			continue
+		}
+		if slices.Contains(methods, fiber.MethodGet) && !explicitHead[route.MatchID()] {
+			methods = append(methods, fiber.MethodHead)
+		}
+		r.app.Add(methods, route.Path, handler, chain...)
+	}
+
+	// Answer CORS preflights on every route path, including those that do
+	// not list OPTIONS; other OPTIONS requests there get a 405.
+	preflight := r.cors()
+	for _, path := range paths {
+		r.app.Options(path, func(c fiber.Ctx) error {
+			return fiber.ErrMethodNotAllowed
+		}, preflight)
+	}
+}
+
+// RequestMethods are the methods the Fiber app has to accept: Fiber's
+// defaults plus any custom verbs the routes declare.
+func RequestMethods(cfg *config.Config) []string {
+	methods := append([]string(nil), fiber.DefaultMethods...)
+	for _, route := range cfg.Routes {
+		for _, method := range route.MethodList() {
+			if method != config.MethodAny && !slices.Contains(methods, method) {
+				methods = append(methods, method)
 			}
 		}
 	}
+	return methods
 }
 
-type routeConfig struct {
-	Upstream    string
-	StripPrefix string
-	Headers     map[string]string
+// orderRoutes keeps routes in config order, except that routes sharing a
+// path are registered most specific first so Fiber tries them in that order.
+func orderRoutes(routes []config.Route) []config.Route {
+	first := make(map[string]int, len(routes))
+	for i, route := range routes {
+		if _, ok := first[route.Path]; !ok {
+			first[route.Path] = i
+		}
+	}
+
+	ordered := append([]config.Route(nil), routes...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if first[a.Path] != first[b.Path] {
+			return first[a.Path] < first[b.Path]
+		}
+		aHost, aConds := a.Match.Specificity()
+		bHost, bConds := b.Match.Specificity()
+		if aHost != bHost {
+			return aHost > bHost
+		}
+		return aConds > bConds
+	})
+	return ordered
+}
+
+func (r *Router) mirror(route *config.Route) *proxy.Mirror {
+	opts := proxy.MirrorOptions{
+		Route:       route.ID(),
+		Upstream:    route.Mirror.Upstream,
+		Percent:     route.Mirror.Percent,
+		Timeout:     route.Mirror.Timeout(),
+		MaxInFlight: route.Mirror.MaxInFlight,
+		Observer:    middleware.MirrorMetrics(route.ID()),
+	}
+	if route.Mirror.RecordDiffs {
+		opts.Diffs = r.diffs
+	}
+
+	mirror, err := proxy.NewMirror(opts)
+	if err != nil {
+		r.logger.Error().Err(err).Str("route", route.Path).Msg("invalid mirror, mirroring disabled")
+		return nil
+	}
+	return mirror
+}
+
+// compare runs compare mode on the mirror machinery: the new backend is the
+// shadow and every difference is recorded.
+func (r *Router) compare(route *config.Route) *proxy.Mirror {
+	percent := route.Compare.Percent
+	if percent == 0 {
+		percent = 100
+	}
+
+	mirror, err := proxy.NewMirror(proxy.MirrorOptions{
+		Route:       route.ID(),
+		Upstream:    route.Compare.Upstream,
+		Percent:     percent,
+		Timeout:     route.Compare.Timeout(),
+		MaxInFlight: route.Compare.MaxInFlight,
+		Diffs:       r.diffs,
+		Comparison:  proxy.NewComparison(route.Compare.IgnoreHeaders, route.Compare.IgnoreFields),
+		Observer:    middleware.CompareLog{Route: route.ID(), Logger: r.logger},
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Str("route", route.Path).Msg("invalid compare, compare mode disabled")
+		return nil
+	}
+	return mirror
+}
+
+func (r *Router) trafficSplit(route *config.Route) *middleware.TrafficSplit {
+	backends := make([]middleware.Backend, len(route.Split.Backends))
+	for i, backend := range route.Split.Backends {
+		backends[i] = middleware.Backend{
+			Name:     backend.Name,
+			Upstream: backend.Upstream,
+			Weight:   backend.Weight,
+			Canary:   backend.Canary,
+		}
+	}
+
+	split := middleware.NewTrafficSplit(middleware.TrafficSplitConfig{
+		Route:          route.ID(),
+		Backends:       backends,
+		Sticky:         route.Split.Sticky,
+		Cookie:         route.Split.Cookie,
+		OverrideHeader: route.Split.OverrideHeader,
+	})
+	r.splits[route.ID()] = split
+	return split
+}
+
+func (r *Router) cors() fiber.Handler {
+	cors := r.cfg.Load().CORS
+	return middleware.CORS(middleware.CORSConfig{
+		AllowOrigins:     cors.AllowOrigins,
+		AllowMethods:     cors.AllowMethods,
+		AllowHeaders:     cors.AllowHeaders,
+		AllowCredentials: cors.AllowCredentials,
+		ExposeHeaders:    cors.ExposeHeaders,
+		MaxAge:           cors.MaxAge,
+	})
+}
+
+func (r *Router) routeMatch(route *config.Route) (*middleware.RouteMatch, error) {
+	return middleware.NewRouteMatch(middleware.RouteMatchConfig{
+		Hosts:   route.Match.Hosts,
+		Headers: matchRules(route.Match.Headers),
+		Query:   matchRules(route.Match.Query),
+		Cookies: matchRules(route.Match.Cookies),
+	})
+}
+
+func matchRules(rules []config.MatchRule) []middleware.MatchRule {
+	out := make([]middleware.MatchRule, len(rules))
+	for i, rule := range rules {
+		out[i] = middleware.MatchRule{Name: rule.Name, Value: rule.Value, Regex: rule.Regex}
+	}
+	return out
 }
 
 func (r *Router) buildMiddlewareList(route *config.Route) []fiber.Handler {
 	var handlers []fiber.Handler
 
+	upstream := route.Upstream
+	if upstream == "" && route.Split != nil && len(route.Split.Backends) > 0 {
+		upstream = route.Split.Backends[0].Upstream
+	}
+
+	routeCfg := proxy.RouteConfig{
+		Upstream:         upstream,
+		StripPrefix:      route.StripPrefix,
+		Headers:          route.Headers,
+		RequestHeaders:   r.headerTransform(route, "request_headers", route.RequestHeaders),
+		ResponseHeaders:  r.headerTransform(route, "response_headers", route.ResponseHeaders),
+		RequestBody:      r.bodyTransform(route, "request_body", route.RequestBody),
+		ResponseBody:     r.bodyTransform(route, "response_body", route.ResponseBody),
+		PreserveHost:     route.PreserveHost,
+		StripCredentials: route.StripCredentials,
+	}
+	if route.Rewrite != nil {
+		routeCfg.Rewrite = r.pathRewrite(route)
+	}
+	if route.Mirror != nil {
+		routeCfg.Mirror = r.mirror(route)
+	}
+	if route.Compare != nil {
+		routeCfg.Mirror = r.compare(route)
+	}
+	if route.Cookies != nil {
+		routeCfg.Cookies = &proxy.CookieRewrite{
+			Domains:  route.Cookies.Domains,
+			Paths:    make(map[string]string, len(route.Cookies.Paths)),
+			Secure:   route.Cookies.Secure,
+			HTTPOnly: route.Cookies.HTTPOnly,
+			SameSite: route.Cookies.SameSite,
+		}
+		for _, path := range route.Cookies.Paths {
+			routeCfg.Cookies.Paths[path.From] = path.To
+		}
+	}
+	if _, err := proxy.NewLegacyHeaderTransform(route.Headers); err != nil {
+		r.logger.Error().Err(err).Str("route", route.Path).Msg("invalid headers template, headers disabled")
+	}
+
 	handlers = append(handlers, func(c fiber.Ctx) error {
-		c.Locals("upstream", route.Upstream)
+		c.Locals("upstream", upstream)
 		return c.Next()
 	})
 
 	handlers = append(handlers, middleware.RequestID())
 	handlers = append(handlers, middleware.Logger(r.logger))
 	handlers = append(handlers, middleware.Metrics())
-	handlers = append(handlers, middleware.CORS(middleware.CORSConfig{
-		AllowOrigins:     r.cfg.CORS.AllowOrigins,
-		AllowMethods:     r.cfg.CORS.AllowMethods,
-		AllowHeaders:     r.cfg.CORS.AllowHeaders,
-		AllowCredentials: r.cfg.CORS.AllowCredentials,
-		ExposeHeaders:    r.cfg.CORS.ExposeHeaders,
-		MaxAge:           r.cfg.CORS.MaxAge,
-	}))
+	handlers = append(handlers, r.cors())
+
+	if global := r.maintenance[middleware.GlobalMaintenance]; global != nil {
+		handlers = append(handlers, global.Handler())
+	}
+	if m := r.maintenanceSwitch(route.ID(), route.Maintenance, r.cfg.Load().Maintenance); m != nil {
+		handlers = append(handlers, m.Handler())
+	}
 
 	if route.AuthRequired {
+		jwt := r.cfg.Load().JWT
 		handlers = append(handlers, middleware.JWT(middleware.JWTConfig{
-			Secret: r.cfg.JWT.Secret,
-			Issuer: r.cfg.JWT.Issuer,
+			Secret: jwt.Secret,
+			Issuer: jwt.Issuer,
 		}))
 	}
 
-	if r.cfg.GlobalRateLimit != nil {
+	if global := r.cfg.Load().GlobalRateLimit; global != nil {
+		r.limiterIDs = append(r.limiterIDs, middleware.GlobalLimiterID)
 		handlers = append(handlers, middleware.RateLimitWithConfig(middleware.RateLimitConfig{
-			GlobalRPS:   r.cfg.GlobalRateLimit.RPS,
-			GlobalBurst: r.cfg.GlobalRateLimit.Burst,
-			GlobalKeyBy: r.cfg.GlobalRateLimit.KeyBy,
+			Registry:      r.state.limiters,
+			GlobalRPS:     global.RPS,
+			GlobalBurst:   global.Burst,
+			GlobalKeyBy:   global.KeyBy,
+			GlobalMaxKeys: global.MaxKeys,
 		}))
 	}
 
 	if route.RateLimit != nil {
+		r.limiterIDs = append(r.limiterIDs, middleware.RouteLimiterID(route.ID()))
 		handlers = append(handlers, middleware.RateLimitWithConfig(middleware.RateLimitConfig{
-			RouteID:    route.Path,
-			RouteRPS:   route.RateLimit.RPS,
-			RouteBurst: route.RateLimit.Burst,
-			RouteKeyBy: route.RateLimit.KeyBy,
+			Registry:     r.state.limiters,
+			RouteID:      route.ID(),
+			RouteRPS:     route.RateLimit.RPS,
+			RouteBurst:   route.RateLimit.Burst,
+			RouteKeyBy:   route.RateLimit.KeyBy,
+			RouteMaxKeys: route.RateLimit.MaxKeys,
 		}))
 	}
 
+	if route.Split != nil {
+		handlers = append(handlers, r.trafficSplit(route).Handler())
+	}
+
+	// Routes sharing a path keep their cached and coalesced responses apart,
+	// as do split backends. A stale entry is refreshed from the backend the
+	// split picked for the request that found it, which is the entry's own.
+	var variant string
+	if r.sharesPath(route) {
+		variant = route.ID()
+	}
+
+	if route.Cache != nil {
+		handlers = append(handlers, middleware.Cache(middleware.CacheConfig{
+			Store:                r.cache,
+			Route:                route.ID(),
+			Variant:              variant,
+			TTL:                  route.Cache.TTL(),
+			StaleWhileRevalidate: route.Cache.StaleWhileRevalidate(),
+			StaleIfError:         route.Cache.StaleIfError(),
+			KeyClaims:            route.Cache.KeyClaims,
+			KeyHeaders:           route.Cache.KeyHeaders,
+			Refresh:              r.proxy.Fetch(routeCfg),
+			RefreshTimeout:       route.Timeout(),
+		}))
+	}
+
+	if route.Coalesce != nil {
+		handlers = append(handlers, middleware.Coalesce(middleware.CoalesceConfig{
+			Coalescer:  resilience.NewCoalescer(route.Coalesce.MaxWaiters, route.Coalesce.Timeout()),
+			Route:      route.ID(),
+			Variant:    variant,
+			KeyHeaders: route.Coalesce.KeyHeaders,
+		}))
+	}
+
+	if r.admission != nil {
+		handlers = append(handlers, middleware.Admission(r.admissionConfig(route)))
+	}
+
+	if cc := route.Concurrency; cc != nil && cc.MaxConcurrent > 0 {
+		switch {
+		case cc.Scope == "upstream" && route.Split != nil:
+			// The split has picked the backend by now; limit its upstream.
+			limiters := make(map[string]*resilience.ConcurrencyLimiter)
+			for _, upstream := range route.Upstreams() {
+				limiters[upstream] = r.concurrencyLimiter("upstream:"+upstream, cc)
+			}
+			handlers = append(handlers, middleware.ConcurrencyLimitByUpstream(limiters))
+		case cc.Scope == "upstream":
+			name := "upstream:" + route.Upstream
+			handlers = append(handlers, middleware.ConcurrencyLimit(name, r.concurrencyLimiter(name, cc)))
+		default:
+			name := "route:" + route.ID()
+			handlers = append(handlers, middleware.ConcurrencyLimit(name, r.concurrencyLimiter(name, cc)))
+		}
+	}
+
 	handlers = append(handlers, middleware.OTel())
 	handlers = append(handlers, middleware.Timeout(route.Timeout()))
 	handlers = append(handlers, middleware.Recovery(r.logger))
 
+	if policy, ok := circuitPolicy(route); ok {
+		breaker := r.state.circuitBreaker(route.ID(), policy, route.Upstreams(), r.logger)
+		r.breakers[route.ID()] = breaker
+		handlers = append(handlers, middleware.CircuitBreakerWithBreaker(breaker))
+	}
+
 	if route.Retry != nil && route.Retry.Attempts > 0 {
-		handlers = append(handlers, middleware.CircuitBreakerMiddleware(route.Retry.Attempts, route.Retry.Backoff()))
+		var budget *resilience.RetryBudget
+		if b := route.Retry.Budget; b != nil {
+			budget = resilience.NewRetryBudget(b.RatioPercent/100, b.MinRetriesPerSecond, b.Window())
+		}
+
 		handlers = append(handlers, middleware.Retry(middleware.RetryConfig{
-			Attempts:   route.Retry.Attempts,
-			Backoff:    route.Retry.Backoff(),
-			MaxBackoff: 5 * time.Second,
+			Attempts:            route.Retry.Attempts,
+			Backoff:             route.Retry.Backoff(),
+			MaxBackoff:          route.Retry.MaxBackoff(),
+			Jitter:              route.Retry.JitterEnabled(),
+			PerTryTimeout:       route.Retry.PerTryTimeout(),
+			RetryOn:             route.Retry.RetryOn,
+			Methods:             route.Retry.Methods,
+			AllowIdempotencyKey: route.Retry.AllowIdempotencyKey,
+			Budget:              budget,
 		}))
 	}
 
-	routeCfg := routeConfig{
-		Upstream:    route.Upstream,
-		StripPrefix: route.StripPrefix,
-		Headers:     route.Headers,
+	if route.Hedge != nil {
+		handlers = append(handlers, middleware.Hedge(middleware.HedgeConfig{
+			Route:      route.ID(),
+			Delay:      route.Hedge.Delay(),
+			Percentile: route.Hedge.Percentile,
+			MinDelay:   route.Hedge.MinDelay(),
+			MaxHedges:  route.Hedge.MaxHedges,
+			Targets:    route.Hedge.Targets,
+			Methods:    route.Hedge.Methods,
+		}))
+	}
+
+	switch {
+	case route.Composite != nil:
+		handlers = append(handlers, r.composite(route))
+	case route.Response != nil:
+		handlers = append(handlers, r.staticResponse(route))
+	case route.Redirect != nil:
+		handlers = append(handlers, r.redirect(route))
+	case route.Files != nil:
+		handlers = append(handlers, r.fileServer(route))
+	default:
+		handlers = append(handlers, r.proxy.Forward(routeCfg))
 	}
-	handlers = append(handlers, r.proxy.Forward(routeCfg))
 
 	return handlers
 }
+
+// sharesPath reports whether another route has the same path, differing in
+// methods or match conditions.
+func (r *Router) sharesPath(route *config.Route) bool {
+	for _, other := range r.cfg.Load().Routes {
+		if other.Path == route.Path && other.ID() != route.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceSwitch registers the maintenance switch for a route, or the
+// global one. A route without its own settings takes the global ones,
+// starting disabled. A switch flipped through the admin API stays that way
+// across rebuilds until the config changes its enabled setting.
+func (r *Router) maintenanceSwitch(name string, cfg, inherit *config.MaintenanceConfig) *middleware.Maintenance {
+	settings := config.MaintenanceConfig{}
+	switch {
+	case cfg != nil:
+		settings = *cfg
+	case inherit != nil:
+		settings = *inherit
+		settings.Enabled = false
+	}
+
+	m, err := middleware.NewMaintenance(middleware.MaintenanceConfig{
+		Route:       name,
+		Enabled:     r.state.maintenanceEnabled(name, settings.Enabled),
+		RetryAfter:  settings.RetryAfter(),
+		Body:        settings.Body,
+		ContentType: settings.ContentType,
+		AllowIPs:    settings.AllowIPs,
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Str("route", name).Msg("invalid maintenance, maintenance switch disabled")
+		return nil
+	}
+	r.maintenance[name] = m
+	return m
+}
+
+func (r *Router) staticResponse(route *config.Route) fiber.Handler {
+	h, err := proxy.StaticResponse(proxy.StaticResponseOptions{
+		Status:  route.Response.Status,
+		Headers: route.Response.Headers,
+		Body:    route.Response.Body,
+		File:    route.Response.File,
+	})
+	if err != nil {
+		return r.misconfigured(route, "response", err)
+	}
+	return h
+}
+
+func (r *Router) redirect(route *config.Route) fiber.Handler {
+	h, err := proxy.Redirect(proxy.RedirectOptions{
+		To:            route.Redirect.To,
+		Status:        route.Redirect.Status,
+		PreserveQuery: route.Redirect.PreserveQuery,
+	})
+	if err != nil {
+		return r.misconfigured(route, "redirect", err)
+	}
+	return h
+}
+
+func (r *Router) fileServer(route *config.Route) fiber.Handler {
+	files, err := proxy.NewFileServer(proxy.FileServerOptions{
+		Root:          route.Files.Root,
+		StripPrefix:   route.StripPrefix,
+		Index:         route.Files.Index,
+		SPA:           route.Files.SPA,
+		Precompressed: route.Files.Precompressed,
+		MaxAge:        route.Files.MaxAge(),
+	})
+	if err != nil {
+		return r.misconfigured(route, "files", err)
+	}
+	return files.Handler()
+}
+
+// misconfigured stands in for a route handler that could not be built.
+func (r *Router) misconfigured(route *config.Route, block string, err error) fiber.Handler {
+	r.logger.Error().Err(err).Str("route", route.Path).Msgf("invalid %s, route disabled", block)
+	return func(c fiber.Ctx) error {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": block + " route misconfigured",
+		})
+	}
+}
+
+func (r *Router) composite(route *config.Route) fiber.Handler {
+	opts := proxy.CompositeOptions{ForwardHeaders: route.Composite.ForwardHeaders}
+	for _, call := range route.Composite.Calls {
+		opts.Calls = append(opts.Calls, proxy.CompositeCall{
+			Name:      call.Name,
+			Method:    strings.ToUpper(call.Method),
+			URL:       call.URL,
+			Timeout:   call.Timeout(),
+			DependsOn: call.DependsOn,
+			Required:  call.Required,
+			Fallback:  call.Fallback,
+		})
+	}
+	for _, field := range route.Composite.Merge {
+		opts.Merge = append(opts.Merge, proxy.CompositeField{From: field.From, To: field.To})
+	}
+
+	composite, err := proxy.NewComposite(opts)
+	if err != nil {
+		return r.misconfigured(route, "composite", err)
+	}
+	return r.proxy.Compose(composite)
+}
+
+// concurrencyLimiter returns the named limiter. Routes with scope
+// "upstream" share one limiter per upstream; the first route to reference an
+// upstream defines its settings. Limiters with unchanged settings carry over
+// from the previous build.
+func (r *Router) concurrencyLimiter(name string, cc *config.ConcurrencyConfig) *resilience.ConcurrencyLimiter {
+	if limiter, ok := r.concurrency[name]; ok {
+		return limiter
+	}
+
+	limiter := r.state.concurrencyLimiter(name, resilience.ConcurrencyOptions{
+		Limit:            cc.MaxConcurrent,
+		MinLimit:         cc.MinLimit,
+		MaxLimit:         cc.MaxLimit,
+		MaxQueue:         cc.MaxQueue,
+		QueueTimeout:     cc.QueueTimeout(),
+		Algorithm:        cc.Adaptive,
+		LatencyThreshold: cc.LatencyThreshold(),
+	})
+	r.concurrency[name] = limiter
+	return limiter
+}
+
+func (r *Router) admissionConfig(route *config.Route) middleware.AdmissionConfig {
+	ac := r.cfg.Load().Admission
+	cfg := middleware.AdmissionConfig{
+		Controller:   r.admission,
+		RoutePath:    route.Path,
+		DefaultClass: ac.DefaultClass,
+	}
+
+	for _, class := range ac.Classes {
+		cfg.Classes = append(cfg.Classes, middleware.PriorityClass{
+			Name:   class.Name,
+			ShedAt: class.ShedAt,
+		})
+	}
+
+	for _, rule := range ac.Rules {
+		cfg.Rules = append(cfg.Rules, middleware.PriorityRule{
+			Class:       rule.Class,
+			Routes:      rule.Routes,
+			Header:      rule.Header,
+			HeaderValue: rule.HeaderValue,
+			Claim:       rule.Claim,
+			ClaimValue:  rule.ClaimValue,
+		})
+	}
+
+	return cfg
+}
+
+func (r *Router) headerTransform(route *config.Route, block string, rules *config.HeaderRules) *proxy.HeaderTransform {
+	if rules == nil {
+		return nil
+	}
+
+	transform, err := proxy.NewHeaderTransform(proxy.HeaderRules{
+		Add:    rules.Add,
+		Set:    rules.Set,
+		Remove: rules.Remove,
+		Rename: rules.Rename,
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Str("route", route.Path).Msgf("invalid %s, rules disabled", block)
+		return nil
+	}
+	return transform
+}
+
+func (r *Router) pathRewrite(route *config.Route) *proxy.PathRewrite {
+	opts := proxy.PathRewriteOptions{
+		PrefixFrom:  route.Rewrite.PrefixFrom,
+		PrefixTo:    route.Rewrite.PrefixTo,
+		Regex:       route.Rewrite.Regex,
+		Replacement: route.Rewrite.Replacement,
+		Target:      route.Rewrite.Target,
+	}
+	if q := route.Rewrite.Query; q != nil {
+		opts.QueryRemove = q.Remove
+		opts.QueryAdd = make(map[string]string, len(q.Add))
+		for _, param := range q.Add {
+			opts.QueryAdd[param.Name] = param.Value
+		}
+		opts.QueryRename = make(map[string]string, len(q.Rename))
+		for _, rename := range q.Rename {
+			opts.QueryRename[rename.From] = rename.To
+		}
+	}
+
+	rewrite, err := proxy.NewPathRewrite(opts)
+	if err != nil {
+		r.logger.Error().Err(err).Str("route", route.Path).Msg("invalid rewrite, rewrite disabled")
+		return nil
+	}
+	return rewrite
+}
+
+func (r *Router) bodyTransform(route *config.Route, block string, rules *config.BodyRules) *proxy.BodyTransform {
+	if rules == nil {
+		return nil
+	}
+
+	opts := proxy.BodyRules{
+		Unwrap: rules.Unwrap,
+		Remove: rules.Remove,
+		Rename: make(map[string]string, len(rules.Rename)),
+		Add:    make(map[string]interface{}, len(rules.Add)),
+		Wrap:   rules.Wrap,
+	}
+	for _, rename := range rules.Rename {
+		opts.Rename[rename.From] = rename.To
+	}
+	for _, add := range rules.Add {
+		opts.Add[add.Field] = add.Value
+	}
+
+	transform, err := proxy.NewBodyTransform(opts)
+	if err != nil {
+		r.logger.Error().Err(err).Str("route", route.Path).Msgf("invalid %s, rules disabled", block)
+		return nil
+	}
+	return transform
+}
+
+// circuitPolicy returns the breaker policy for a route. An explicit
+// circuit_breaker block wins; otherwise routes with retries keep the legacy
+// breaker derived from the retry attempts and backoff.
+func circuitPolicy(route *config.Route) (middleware.CircuitBreakerPolicy, bool) {
+	if cbc := route.CircuitBreaker; cbc != nil {
+		return middleware.CircuitBreakerPolicy{
+			FailureRateThreshold: cbc.FailureRateThreshold / 100,
+			ConsecutiveFailures:  cbc.ConsecutiveFailures,
+			Window:               cbc.Window(),
+			MinRequests:          cbc.MinRequests,
+			OpenDuration:         cbc.OpenDuration(),
+			HalfOpenRequests:     cbc.HalfOpenRequests,
+			FailureStatusCodes:   cbc.FailureStatusCodes,
+			FailureErrors:        cbc.FailureErrors,
+		}, true
+	}
+
+	if route.Retry != nil && route.Retry.Attempts > 0 {
+		return middleware.LegacyCircuitPolicy(route.Retry.Attempts, route.Retry.Backoff()), true
+	}
+
+	return middleware.CircuitBreakerPolicy{}, false
+}
@@ -0,0 +1,614 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"api-gateway/internal/domain"
+	"api-gateway/internal/domain/config"
+	"api-gateway/internal/middleware"
+)
+
+func newTestRouter(t *testing.T, routes []config.Route) *fiber.App {
+	t.Helper()
+
+	cfg := &config.Config{
+		CORS:   config.CORSConfig{AllowOrigins: []string{"*"}},
+		Routes: routes,
+	}
+	assert.NoError(t, cfg.Validate())
+
+	app := fiber.New(fiber.Config{RequestMethods: RequestMethods(cfg)})
+	r := New(app, cfg, zerolog.Nop(), newTestState(t))
+	t.Cleanup(r.Close)
+	r.Setup()
+	return app
+}
+
+func newTestState(t *testing.T) *State {
+	state := NewState()
+	t.Cleanup(state.Close)
+	return state
+}
+
+func TestRouter_Methods(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	app := newTestRouter(t, []config.Route{
+		{Path: "/items", Upstream: upstream.URL},
+		{Path: "/dav", Upstream: upstream.URL, Methods: []string{"propfind", "MKCOL"}},
+		{Path: "/any", Upstream: upstream.URL, Methods: []string{"ANY"}},
+		{Path: "/options", Upstream: upstream.URL, Methods: []string{"OPTIONS"}},
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantMethod string
+	}{
+		{"configured GET", http.MethodGet, "/items", http.StatusOK, http.MethodGet},
+		{"HEAD derived from GET", http.MethodHead, "/items", http.StatusOK, http.MethodHead},
+		{"unlisted method", http.MethodPost, "/items", http.StatusMethodNotAllowed, ""},
+		{"custom verb", "PROPFIND", "/dav", http.StatusOK, "PROPFIND"},
+		{"second custom verb", "MKCOL", "/dav", http.StatusOK, "MKCOL"},
+		{"ANY with DELETE", http.MethodDelete, "/any", http.StatusOK, http.MethodDelete},
+		{"ANY with custom verb", "PROPFIND", "/any", http.StatusOK, "PROPFIND"},
+		{"listed OPTIONS proxied", http.MethodOptions, "/options", http.StatusOK, http.MethodOptions},
+		{"unlisted OPTIONS", http.MethodOptions, "/items", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantMethod, resp.Header.Get("X-Method"))
+		})
+	}
+}
+
+func TestRouter_UpstreamTimeoutsAreDurations(t *testing.T) {
+	// The client timeouts were once bare integers, i.e. nanoseconds, which
+	// failed every upstream call.
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	app := newTestRouter(t, []config.Route{{Path: "/slow", Upstream: upstream.URL}})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRouter_PreflightWithoutOptions(t *testing.T) {
+	app := newTestRouter(t, []config.Route{
+		{Path: "/items", Upstream: "http://127.0.0.1:1", Methods: []string{"POST"}, AuthRequired: true},
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/items", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestRouter_ExplicitHeadRoute(t *testing.T) {
+	get := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "get")
+	}))
+	defer get.Close()
+	head := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "head")
+	}))
+	defer head.Close()
+
+	app := newTestRouter(t, []config.Route{
+		{Path: "/items", Upstream: get.URL},
+		{Path: "/items", Upstream: head.URL, Methods: []string{"HEAD"}},
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodHead, "/items", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "head", resp.Header.Get("X-Upstream"))
+}
+
+func TestRequestMethods(t *testing.T) {
+	methods := RequestMethods(&config.Config{Routes: []config.Route{
+		{Methods: []string{"GET", "purge"}},
+		{Methods: []string{"ANY", "PURGE"}},
+	}})
+	assert.Equal(t, append(append([]string(nil), fiber.DefaultMethods...), "PURGE"), methods)
+}
+
+func TestRouter_CompareServesPrimary(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"version":1}`))
+	}))
+	defer primary.Close()
+
+	called := make(chan struct{}, 1)
+	candidate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"version":2}`))
+	}))
+	defer candidate.Close()
+
+	app := newTestRouter(t, []config.Route{
+		{Path: "/items", Upstream: primary.URL, Compare: &config.CompareConfig{Upstream: candidate.URL}},
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/items", nil))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"version":1}`, string(body))
+
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("new backend not called")
+	}
+}
+
+func TestRouter_CompareRecordsEachRequestPath(t *testing.T) {
+	backend := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"version":` + version + `}`))
+		}))
+	}
+	primary, candidate := backend("1"), backend("2")
+	defer primary.Close()
+	defer candidate.Close()
+
+	cfg := &config.Config{Routes: []config.Route{
+		{Path: "/items/*", Upstream: primary.URL, Compare: &config.CompareConfig{Upstream: candidate.URL}},
+	}}
+	assert.NoError(t, cfg.Validate())
+	app := fiber.New()
+	r := New(app, cfg, zerolog.Nop(), newTestState(t))
+	t.Cleanup(r.Close)
+	r.Setup()
+
+	// Mismatches are recorded after the response, when the next request
+	// may already reuse the first one's buffers.
+	for i, path := range []string{"/items/aaaa", "/items/bbbb"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return len(r.diffs.Entries()) == i+1 }, time.Second, 5*time.Millisecond)
+	}
+
+	entries := r.diffs.Entries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "/items/bbbb", entries[0].Path)
+	assert.Equal(t, "/items/aaaa", entries[1].Path)
+	assert.Equal(t, http.MethodGet, entries[1].Method)
+}
+
+func TestRouter_StaticResponsesAndRedirects(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "robots.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("User-agent: *\n"), 0o644))
+
+	app := newTestRouter(t, []config.Route{
+		{Path: "/ping", Response: &config.ResponseConfig{Status: 202, Body: `{"pong":true}`, Headers: map[string]string{"content-type": "application/json", "x-static": "1"}}},
+		{Path: "/robots.txt", Response: &config.ResponseConfig{File: file}},
+		{Path: "/old/:id", Redirect: &config.RedirectConfig{To: "https://new.example.com/users/{{.Params.id}}", Status: 308, PreserveQuery: true}},
+		{Path: "/moved", Redirect: &config.RedirectConfig{To: "/elsewhere"}},
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		header   string
+		value    string
+		wantBody string
+	}{
+		{"inline body", "/ping", 202, "X-Static", "1", `{"pong":true}`},
+		{"file body", "/robots.txt", 200, "Content-Type", "text/plain; charset=utf-8", "User-agent: *\n"},
+		{"templated redirect", "/old/42?tab=orders", 308, "Location", "https://new.example.com/users/42?tab=orders", ""},
+		{"default redirect", "/moved?x=1", 302, "Location", "/elsewhere", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.value, resp.Header.Get(tt.header))
+			if tt.wantBody != "" {
+				body, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
+
+func TestRouter_Maintenance(t *testing.T) {
+	cfg := &config.Config{
+		Maintenance: &config.MaintenanceConfig{RetryAfterMs: 60000, Body: "down for maintenance"},
+		Routes: []config.Route{
+			{Path: "/a", Response: &config.ResponseConfig{Body: "a"}},
+			{Path: "/b", Response: &config.ResponseConfig{Body: "b"}, Maintenance: &config.MaintenanceConfig{Enabled: true}},
+		},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	app := fiber.New()
+	r := New(app, cfg, zerolog.Nop(), newTestState(t))
+	t.Cleanup(r.Close)
+	r.Setup()
+
+	status := func(path string) int {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 200, status("/a"))
+	assert.Equal(t, 503, status("/b"))
+
+	assert.NoError(t, r.SetMaintenance("GET /a", true))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/a", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "down for maintenance", string(body))
+
+	assert.NoError(t, r.SetMaintenance("GET /a", false))
+	assert.NoError(t, r.SetMaintenance(middleware.GlobalMaintenance, true))
+	assert.Equal(t, 503, status("/a"))
+	assert.Equal(t, 200, status("/health"))
+
+	assert.ErrorIs(t, r.SetMaintenance("/missing", true), domain.ErrNotFound)
+	assert.Len(t, r.Maintenance(), 3)
+}
+
+func TestRouter_RebuildKeepsRateLimits(t *testing.T) {
+	cfg := &config.Config{
+		Routes: []config.Route{{
+			Path:      "/a",
+			Response:  &config.ResponseConfig{Body: "a"},
+			RateLimit: &config.RateLimitConfig{RPS: 1, Burst: 1, KeyBy: "ip"},
+		}},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	state := newTestState(t)
+	build := func() *fiber.App {
+		app := fiber.New()
+		r := New(app, cfg, zerolog.Nop(), state)
+		t.Cleanup(r.Close)
+		r.Setup()
+		return app
+	}
+
+	resp, err := build().Test(httptest.NewRequest(http.MethodGet, "/a", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// A reload builds a new router; the client's bucket is still empty.
+	resp, err = build().Test(httptest.NewRequest(http.MethodGet, "/a", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+}
+
+func TestRouter_RebuildKeepsMaintenanceSwitches(t *testing.T) {
+	state := newTestState(t)
+	build := func(routes ...config.Route) (*Router, *fiber.App) {
+		cfg := &config.Config{Routes: routes}
+		assert.NoError(t, cfg.Validate())
+		app := fiber.New()
+		r := New(app, cfg, zerolog.Nop(), state)
+		t.Cleanup(r.Close)
+		r.Setup()
+		return r, app
+	}
+	status := func(app *fiber.App) int {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/a", nil))
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	a := config.Route{Path: "/a", Response: &config.ResponseConfig{Body: "a"}}
+	b := config.Route{Path: "/b", Response: &config.ResponseConfig{Body: "b"}}
+	r, _ := build(a, b)
+	assert.NoError(t, r.SetMaintenance("GET /a", true))
+
+	// Editing another route rebuilds the router; /a stays in maintenance.
+	b.Response = &config.ResponseConfig{Body: "b2"}
+	r, app := build(a, b)
+	assert.Equal(t, 503, status(app))
+
+	// A config that changes /a's own setting wins over the switch, which
+	// then sticks again.
+	assert.NoError(t, r.SetMaintenance("GET /a", false))
+	a.Maintenance = &config.MaintenanceConfig{Enabled: true}
+	r, app = build(a, b)
+	assert.Equal(t, 503, status(app))
+	assert.NoError(t, r.SetMaintenance("GET /a", false))
+	_, app = build(a, b)
+	assert.Equal(t, 200, status(app))
+}
+
+func TestRouter_RebuildKeepsForcedCircuits(t *testing.T) {
+	state := newTestState(t)
+	build := func(routes ...config.Route) (*Router, *fiber.App) {
+		cfg := &config.Config{Routes: routes}
+		assert.NoError(t, cfg.Validate())
+		app := fiber.New()
+		r := New(app, cfg, zerolog.Nop(), state)
+		t.Cleanup(r.Close)
+		r.Setup()
+		return r, app
+	}
+	status := func(app *fiber.App) int {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/a", nil))
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	upstream := "http://127.0.0.1:1"
+	a := config.Route{Path: "/a", Upstream: upstream, CircuitBreaker: &config.CircuitBreakerConfig{ConsecutiveFailures: 5}}
+	b := config.Route{Path: "/b", Response: &config.ResponseConfig{Body: "b"}}
+	r, _ := build(a, b)
+	assert.NoError(t, r.ForceCircuit("GET /a", upstream, "open"))
+
+	// Editing another route rebuilds the router; the circuit stays forced.
+	b.Response = &config.ResponseConfig{Body: "b2"}
+	r, app := build(a, b)
+	assert.Equal(t, 503, status(app))
+	circuits := r.Circuits()
+	if assert.Len(t, circuits, 1) {
+		assert.True(t, circuits[0].Forced)
+	}
+
+	// New breaker settings start a fresh breaker.
+	a.CircuitBreaker = &config.CircuitBreakerConfig{ConsecutiveFailures: 3}
+	_, app = build(a, b)
+	assert.Equal(t, 502, status(app))
+}
+
+func TestRouter_RebuildKeepsConcurrencyLimiters(t *testing.T) {
+	state := newTestState(t)
+	build := func(routes ...config.Route) *Router {
+		cfg := &config.Config{Routes: routes}
+		assert.NoError(t, cfg.Validate())
+		r := New(fiber.New(), cfg, zerolog.Nop(), state)
+		t.Cleanup(r.Close)
+		r.Setup()
+		return r
+	}
+
+	a := config.Route{Path: "/a", Upstream: "http://127.0.0.1:1", Concurrency: &config.ConcurrencyConfig{MaxConcurrent: 1}}
+	b := config.Route{Path: "/b", Response: &config.ResponseConfig{Body: "b"}}
+	limiter := build(a, b).concurrency["route:GET /a"]
+	assert.NotNil(t, limiter)
+
+	// Editing another route keeps the limiter and the slots it holds.
+	b.Response = &config.ResponseConfig{Body: "b2"}
+	assert.Same(t, limiter, build(a, b).concurrency["route:GET /a"])
+
+	a.Concurrency = &config.ConcurrencyConfig{MaxConcurrent: 2}
+	assert.NotSame(t, limiter, build(a, b).concurrency["route:GET /a"])
+}
+
+func TestRouter_Files(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o644))
+
+	app := newTestRouter(t, []config.Route{
+		{Path: "/app/*", StripPrefix: "/app", Files: &config.FilesConfig{Root: dir, SPA: true}},
+	})
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		resp, err := app.Test(httptest.NewRequest(method, "/app/orders/42", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.NotEmpty(t, resp.Header.Get("X-Request-ID"), "route middleware still runs")
+	}
+}
+
+func TestRouter_AdminInspection(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{Secret: "jwt-secret"},
+		Server: config.ServerConfig{
+			Admin: &config.AdminConfig{Address: "127.0.0.1:0", Token: "admin-token"},
+		},
+		Routes: []config.Route{
+			{Path: "/a", Upstream: upstream.URL, AuthRequired: true},
+			{Path: "/b", Upstream: upstream.URL, Methods: []string{"POST"}},
+			{Path: "/c", Upstream: "http://127.0.0.1:1"},
+			{Path: "/d", Redirect: &config.RedirectConfig{To: "/a"}},
+		},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	app := fiber.New()
+	r := New(app, cfg, zerolog.Nop(), newTestState(t))
+	t.Cleanup(r.Close)
+	r.Setup()
+
+	// The admin API is served by the admin listener only.
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/routes", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	routes := r.RouteTable()
+	assert.Len(t, routes, 4)
+	assert.Equal(t, "GET /a", routes[0].ID)
+	assert.True(t, routes[0].AuthRequired)
+	assert.Equal(t, []string{"POST"}, routes[1].Methods)
+	assert.Equal(t, config.KindRedirect, routes[3].Kind)
+	assert.Empty(t, routes[3].Upstreams)
+
+	health := r.UpstreamHealth(true)
+	assert.Len(t, health, 2)
+	for _, h := range health {
+		switch h.Upstream {
+		case upstream.URL:
+			assert.Equal(t, []string{"GET /a", "POST /b"}, h.Routes)
+			assert.True(t, h.Healthy)
+			assert.True(t, *h.Reachable)
+			assert.Equal(t, 404, h.Status)
+		default:
+			assert.False(t, h.Healthy)
+			assert.False(t, *h.Reachable)
+			assert.NotEmpty(t, h.Error)
+		}
+	}
+
+	effective := r.EffectiveConfig()
+	assert.Equal(t, config.RedactedValue, effective["jwt"].(map[string]interface{})["secret"])
+}
+
+func TestRouter_CacheRefreshSendsUpstreamHost(t *testing.T) {
+	hosts := make(chan string, 4)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host + " " + r.Header.Get("X-Forwarded-Host")
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		_, _ = w.Write([]byte("feed"))
+	}))
+	defer upstream.Close()
+
+	app := newTestRouter(t, []config.Route{{
+		Path:     "/feed",
+		Upstream: upstream.URL,
+		Cache:    &config.CacheConfig{StaleWhileRevalidateMs: 60000},
+	}})
+
+	for _, want := range []string{middleware.CacheMiss, middleware.CacheStale} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "http://client.example/feed", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, want, resp.Header.Get(middleware.CacheStatusHeader))
+	}
+
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+	for _, want := range []string{"forwarded", "refreshed"} {
+		select {
+		case host := <-hosts:
+			assert.Equal(t, upstreamHost+" client.example", host, want)
+		case <-time.After(time.Second):
+			t.Fatalf("upstream not %s", want)
+		}
+	}
+}
+
+func TestRouter_CacheKeepsSplitBackendsApart(t *testing.T) {
+	refreshed := make(chan string, 4)
+	backend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			refreshed <- name
+			w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+			_, _ = w.Write([]byte(name))
+		}))
+	}
+	stable, canary := backend("stable"), backend("canary")
+	defer stable.Close()
+	defer canary.Close()
+
+	app := newTestRouter(t, []config.Route{{
+		Path: "/feed",
+		Split: &config.SplitConfig{Backends: []config.BackendConfig{
+			{Name: "stable", Upstream: stable.URL, Weight: 1},
+			{Name: "canary", Upstream: canary.URL, Weight: 1},
+		}},
+		Cache: &config.CacheConfig{StaleWhileRevalidateMs: 60000},
+	}})
+
+	get := func(name string) (string, string) {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		req.Header.Set(middleware.DefaultSplitOverrideHeader, name)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.Header.Get(middleware.CacheStatusHeader)
+	}
+
+	body, status := get("canary")
+	assert.Equal(t, "canary", body)
+	assert.Equal(t, middleware.CacheMiss, status)
+	assert.Equal(t, "canary", <-refreshed)
+
+	body, status = get("stable")
+	assert.Equal(t, "stable", body)
+	assert.Equal(t, middleware.CacheMiss, status)
+	assert.Equal(t, "stable", <-refreshed)
+
+	// A stale canary entry is refreshed from the canary.
+	body, status = get("canary")
+	assert.Equal(t, "canary", body)
+	assert.Equal(t, middleware.CacheStale, status)
+	select {
+	case name := <-refreshed:
+		assert.Equal(t, "canary", name)
+	case <-time.After(time.Second):
+		t.Fatal("entry not refreshed")
+	}
+}
+
+func TestRouter_UpdateWeightsWhileInspected(t *testing.T) {
+	withWeights := func(stable, canary int) *config.Config {
+		cfg := &config.Config{Routes: []config.Route{{
+			Path: "/feed",
+			Split: &config.SplitConfig{Backends: []config.BackendConfig{
+				{Name: "stable", Upstream: "http://127.0.0.1:1", Weight: stable},
+				{Name: "canary", Upstream: "http://127.0.0.1:2", Weight: canary},
+			}},
+		}}}
+		assert.NoError(t, cfg.Validate())
+		return cfg
+	}
+
+	r := New(fiber.New(), withWeights(90, 10), zerolog.Nop(), newTestState(t))
+	t.Cleanup(r.Close)
+	r.Setup()
+
+	// Run with -race: weight-only reloads swap the config the admin API reads.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.True(t, r.UpdateWeights(withWeights(100-i, i)))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = r.EffectiveConfig()
+		_ = r.RouteTable()
+	}
+	wg.Wait()
+
+	backends := r.EffectiveConfig()["routes"].([]interface{})[0].(map[string]interface{})["split"].(map[string]interface{})["backends"].([]interface{})
+	assert.Equal(t, 1, backends[0].(map[string]interface{})["weight"])
+}
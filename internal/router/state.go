@@ -0,0 +1,150 @@
+package router
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"api-gateway/internal/adapter/resilience"
+	"api-gateway/internal/middleware"
+)
+
+// State is shared by the routers built for successive configs, so a reload
+// keeps rate limit counters, concurrency limiters, circuit breakers and the
+// maintenance switches operators flipped through the admin API. Create it
+// once and Close it when done.
+type State struct {
+	limiters *middleware.LimiterRegistry
+
+	mu          sync.Mutex
+	maintenance map[string]maintenanceState
+	breakers    map[string]sharedBreaker
+	concurrency map[string]sharedLimiter
+}
+
+// sharedLimiter is a concurrency limiter with the options it was built from.
+type sharedLimiter struct {
+	opts    resilience.ConcurrencyOptions
+	limiter *resilience.ConcurrencyLimiter
+}
+
+// sharedBreaker is a route's breaker with the settings it was built from.
+type sharedBreaker struct {
+	policy    middleware.CircuitBreakerPolicy
+	upstreams []string
+	breaker   *middleware.CircuitBreaker
+}
+
+// maintenanceState is a maintenance switch as last set through the admin
+// API, along with what the config said at the time. A config that says
+// otherwise later wins over the switch.
+type maintenanceState struct {
+	configured bool
+	enabled    bool
+}
+
+func NewState() *State {
+	return &State{
+		limiters:    middleware.NewLimiterRegistry(middleware.DefaultLimiterMaxKeys),
+		maintenance: make(map[string]maintenanceState),
+		breakers:    make(map[string]sharedBreaker),
+		concurrency: make(map[string]sharedLimiter),
+	}
+}
+
+func (s *State) Close() {
+	s.limiters.Close()
+}
+
+// maintenanceEnabled returns whether the named switch starts enabled when
+// the config says configured.
+func (s *State) maintenanceEnabled(name string, configured bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.maintenance[name]
+	if !ok || state.configured != configured {
+		state = maintenanceState{configured: configured, enabled: configured}
+		s.maintenance[name] = state
+	}
+	return state.enabled
+}
+
+func (s *State) setMaintenance(name string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.maintenance[name]
+	state.enabled = enabled
+	s.maintenance[name] = state
+}
+
+// retainMaintenance forgets the switches of routes that are gone.
+func (s *State) retainMaintenance(switches map[string]*middleware.Maintenance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name := range s.maintenance {
+		if _, ok := switches[name]; !ok {
+			delete(s.maintenance, name)
+		}
+	}
+}
+
+// circuitBreaker returns the named breaker, keeping its circuits, forced
+// states and failure windows when policy and upstreams are unchanged.
+func (s *State) circuitBreaker(name string, policy middleware.CircuitBreakerPolicy, upstreams []string, logger zerolog.Logger) *middleware.CircuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shared, ok := s.breakers[name]
+	if ok && reflect.DeepEqual(shared.policy, policy) && slices.Equal(shared.upstreams, upstreams) {
+		return shared.breaker
+	}
+
+	breaker := middleware.NewCircuitBreakerWithPolicy(policy).Instrument(name, logger).Upstreams(upstreams)
+	s.breakers[name] = sharedBreaker{policy: policy, upstreams: upstreams, breaker: breaker}
+	return breaker
+}
+
+// retainBreakers forgets the breakers of routes that are gone.
+func (s *State) retainBreakers(breakers map[string]*middleware.CircuitBreaker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name := range s.breakers {
+		if _, ok := breakers[name]; !ok {
+			delete(s.breakers, name)
+		}
+	}
+}
+
+// concurrencyLimiter returns the named limiter, keeping its in-flight and
+// queued requests and its adaptive limit when opts are unchanged.
+func (s *State) concurrencyLimiter(name string, opts resilience.ConcurrencyOptions) *resilience.ConcurrencyLimiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shared, ok := s.concurrency[name]
+	if ok && shared.opts == opts {
+		return shared.limiter
+	}
+
+	limiter := resilience.NewConcurrencyLimiter(opts)
+	s.concurrency[name] = sharedLimiter{opts: opts, limiter: limiter}
+	return limiter
+}
+
+// retainConcurrency forgets the limiters no route uses anymore.
+func (s *State) retainConcurrency(limiters map[string]*resilience.ConcurrencyLimiter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name := range s.concurrency {
+		if _, ok := limiters[name]; !ok {
+			delete(s.concurrency, name)
+		}
+	}
+}
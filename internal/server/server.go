@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"api-gateway/internal/domain/config"
+	"api-gateway/internal/handler"
 	"api-gateway/internal/middleware"
 	"api-gateway/internal/router"
 
@@ -19,19 +20,33 @@ import (
 )
 
 type Server struct {
-	app    *fiber.App
-	cfg    *config.Config
-	logger zerolog.Logger
+	app      *fiber.App
+	adminApp *fiber.App
+	cfg      *config.Config
+	logger   zerolog.Logger
+	router   *router.Router
+	state    *router.State
+	admin    Admin
+}
+
+// Admin holds the admin API operations that outlive a server: reloading the
+// config and changing routes. Either may be nil.
+type Admin struct {
+	Reload handler.ReloadHandler
+	Routes handler.RouteEditor
 }
 
 var ErrReloadRequested = errors.New("reload requested")
 
-func New(cfg *config.Config, logger zerolog.Logger) *Server {
+// New builds a server for cfg. state outlives the server, so rate limit
+// counters and runtime switches carry over to the server of the next config.
+func New(cfg *config.Config, logger zerolog.Logger, state *router.State, admin Admin) *Server {
 	app := fiber.New(fiber.Config{
-		ReadTimeout:  cfg.Server.ReadTimeout(),
-		WriteTimeout: cfg.Server.WriteTimeout(),
-		IdleTimeout:  cfg.Server.IdleTimeout(),
-		AppName:      "api-gateway",
+		ReadTimeout:    cfg.Server.ReadTimeout(),
+		WriteTimeout:   cfg.Server.WriteTimeout(),
+		IdleTimeout:    cfg.Server.IdleTimeout(),
+		AppName:        "api-gateway",
+		RequestMethods: router.RequestMethods(cfg),
 	})
 
 	app.Use(recover.New())
@@ -40,18 +55,28 @@ func New(cfg *config.Config, logger zerolog.Logger) *Server {
 		app:    app,
 		cfg:    cfg,
 		logger: logger,
+		state:  state,
+		admin:  admin,
 	}
 }
 
-func (s *Server) Start(reloadCh <-chan struct{}) error {
+// Start serves until shutdown or a reload. Reloads that only change traffic
+// split weights are applied in place; any other change returns
+// ErrReloadRequested so the caller can rebuild the server.
+func (s *Server) Start(reloadCh <-chan *config.Config) error {
 	if s.cfg.OTel.Endpoint != "" {
 		if err := middleware.InitOTel(s.cfg.OTel.Endpoint, s.cfg.OTel.ServiceName); err != nil {
 			s.logger.Warn().Err(err).Msg("failed to initialize OTel")
 		}
 	}
 
-	r := router.New(s.app, s.cfg, s.logger)
-	r.Setup()
+	s.router = router.New(s.app, s.cfg, s.logger, s.state)
+	s.router.SetReloader(s.admin.Reload)
+	s.router.SetRouteEditor(s.admin.Routes)
+	s.router.Setup()
+	if s.cfg.Server.Admin != nil {
+		s.startAdmin()
+	}
 
 	addr := fmt.Sprintf("%s:%d", s.cfg.Server.Host, s.cfg.Server.Port)
 	s.logger.Info().Str("addr", addr).Msg("starting server")
@@ -72,27 +97,65 @@ func (s *Server) Start(reloadCh <-chan struct{}) error {
 		return s.shutdownApp()
 	}
 
-	select {
-	case <-quit:
-		s.logger.Info().Msg("shutting down server...")
-		return s.shutdownApp()
-	case <-reloadCh:
-		s.logger.Info().Msg("config reload requested, restarting server...")
-		if err := s.shutdownApp(); err != nil {
-			return err
+	for {
+		select {
+		case <-quit:
+			s.logger.Info().Msg("shutting down server...")
+			return s.shutdownApp()
+		case next := <-reloadCh:
+			if next != nil && s.router.UpdateWeights(next) {
+				s.cfg = next
+				s.logger.Info().Msg("traffic split weights updated")
+				continue
+			}
+
+			s.logger.Info().Msg("config reload requested, restarting server...")
+			if err := s.shutdownApp(); err != nil {
+				return err
+			}
+			return ErrReloadRequested
 		}
-		return ErrReloadRequested
 	}
 }
 
+// startAdmin serves the admin API on its own listener, behind the admin
+// token instead of JWTs.
+func (s *Server) startAdmin() {
+	admin := s.cfg.Server.Admin
+	s.adminApp = fiber.New(fiber.Config{
+		ReadTimeout:  s.cfg.Server.ReadTimeout(),
+		WriteTimeout: s.cfg.Server.WriteTimeout(),
+		IdleTimeout:  s.cfg.Server.IdleTimeout(),
+		AppName:      "api-gateway-admin",
+	})
+	s.adminApp.Use(recover.New())
+	s.router.MountAdmin(s.adminApp.Group("/admin", middleware.AdminToken(admin.Token)))
+
+	s.logger.Info().Str("addr", admin.Address).Msg("starting admin server")
+	go func() {
+		if err := s.adminApp.Listen(admin.Address, fiber.ListenConfig{DisableStartupMessage: true}); err != nil {
+			s.logger.Error().Err(err).Msg("admin server error")
+		}
+	}()
+}
+
 func (s *Server) shutdownApp() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if s.adminApp != nil {
+		if err := s.adminApp.ShutdownWithContext(ctx); err != nil {
+			s.logger.Warn().Err(err).Msg("admin server shutdown error")
+		}
+	}
 	if err := s.app.ShutdownWithContext(ctx); err != nil {
 		return fmt.Errorf("server shutdown failed: %w", err)
 	}
 
+	if s.router != nil {
+		s.router.Close()
+	}
+
 	if err := middleware.ShutdownOTel(); err != nil {
 		s.logger.Warn().Err(err).Msg("OTel shutdown error")
 	}